@@ -3,8 +3,10 @@ module github.com/200sc/oakcalc
 go 1.17
 
 require (
+	github.com/flopp/go-findfont v0.1.0
 	github.com/oakmound/oak/v3 v3.2.1-0.20211212014414-3fb418ddb056
 	golang.org/x/image v0.0.0-20211028202545-6944b10bf410
+	golang.org/x/mobile v0.0.0-20211207041440-4e6c2922fdee
 )
 
 require (
@@ -12,7 +14,6 @@ require (
 	github.com/BurntSushi/xgb v0.0.0-20210121224620-deaf085860bc // indirect
 	github.com/BurntSushi/xgbutil v0.0.0-20190907113008-ad855c713046 // indirect
 	github.com/disintegration/gift v1.2.1 // indirect
-	github.com/flopp/go-findfont v0.1.0 // indirect
 	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20211204153444-caad923f49f4 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/hajimehoshi/go-mp3 v0.3.2 // indirect
@@ -20,7 +21,6 @@ require (
 	github.com/oakmound/w32 v2.1.0+incompatible // indirect
 	github.com/oov/directsound-go v0.0.0-20141101201356-e53e59c700bf // indirect
 	github.com/yobert/alsa v0.0.0-20200618200352-d079056f5370 // indirect
-	golang.org/x/mobile v0.0.0-20211207041440-4e6c2922fdee // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
 	golang.org/x/sys v0.0.0-20211210111614-af8b64212486 // indirect
 )
@@ -1,31 +1,61 @@
 package arith
 
 import (
+	"errors"
 	"fmt"
-	"io"
-	"math"
+	"math/big"
 	"strconv"
+	"strings"
 )
 
 type Token struct {
 	// One of:
-	Number *int64
+	Number *big.Rat
 	Op     *Op
+	Ident  *string
+	Date   *DateLiteral
 }
 
 func (t Token) Copy() Token {
 	t2 := Token{}
 	if t.Number != nil {
-		t2.Number = new(int64)
-		*t2.Number = *t.Number
+		t2.Number = new(big.Rat).Set(t.Number)
 	}
 	if t.Op != nil {
 		t2.Op = new(Op)
 		*t2.Op = *t.Op
 	}
+	if t.Ident != nil {
+		t2.Ident = new(string)
+		*t2.Ident = *t.Ident
+	}
+	if t.Date != nil {
+		t2.Date = new(DateLiteral)
+		*t2.Date = *t.Date
+	}
 	return t2
 }
 
+// is reports whether t is the operator o.
+func (t Token) is(o Op) bool {
+	return t.Op != nil && *t.Op == o
+}
+
+func (t Token) String() string {
+	switch {
+	case t.Number != nil:
+		return Rat{t.Number}.String()
+	case t.Op != nil:
+		return string(*t.Op)
+	case t.Ident != nil:
+		return *t.Ident
+	case t.Date != nil:
+		return t.Date.String()
+	default:
+		return "<empty token>"
+	}
+}
+
 type Op string
 
 const (
@@ -38,18 +68,92 @@ const (
 	OpOpenParen  Op = "("
 	OpCloseParen Op = ")"
 	OpSquareRoot Op = "√"
+	OpComma      Op = ","
+	OpPower      Op = "^"
+	// The brackets enclose list literals, as in "[1, 2, 3]".
+	OpOpenBracket  Op = "["
+	OpCloseBracket Op = "]"
+	// OpMatMul is the matrix product, as in "[[1, 2], [3, 4]] @ [5, 6]".
+	// The other arithmetic operators apply to matrices element by element.
+	OpMatMul Op = "@"
+	// OpModulo is the remainder of floored division, so it takes the sign
+	// of the divisor: "-7 % 3" is 2. Written after its operand, with no
+	// operand following, it is a percentage instead, dividing by one
+	// hundred, so "10%" is 0.1; see isPercent.
+	OpModulo Op = "%"
+	// OpFloorDivide divides and rounds toward negative infinity.
+	OpFloorDivide Op = "//"
+	OpFactorial   Op = "!"
+	// The bitwise operators treat integers as infinite two's complement
+	// bit strings, or as words when the Evaluator has a WordSize.
+	OpAnd        Op = "&"
+	OpOr         Op = "|"
+	OpXor        Op = "xor"
+	OpNot        Op = "~"
+	OpShiftLeft  Op = "<<"
+	OpShiftRight Op = ">>"
+	// OpDecimalPoint, like OpEquals and OpBackspace, is an editing key for
+	// building up tokens rather than part of an expression.
+	OpDecimalPoint Op = "."
+	// The range operators apply to a body over every value of a bound
+	// variable between two bounds; see RangeOpNode.
+	OpIntegral Op = "∫"
+	OpSum      Op = "Σ"
+	OpProduct  Op = "Π"
 )
 
+// Associativity determines how a chain of operators sharing the same
+// binding power groups. "10-3-2" is (10-3)-2 because minus is left
+// associative.
+type Associativity uint8
+
+const (
+	AssocLeft Associativity = iota
+	AssocRight
+)
+
+// Precedence describes how tightly an operator binds its operands. Higher
+// binding powers bind tighter.
+type Precedence struct {
+	Binding int
+	Assoc   Associativity
+}
+
+// The precedence table. Every operator the parser understands in a given
+// position is listed here; an operator missing from a table is not valid
+// in that position.
 var (
-	unaryOps = map[Op]struct{}{
-		OpSquareRoot: {},
-		OpMinus:      {},
+	unaryOps = map[Op]Precedence{
+		OpSquareRoot: {Binding: 7, Assoc: AssocRight},
+		OpMinus:      {Binding: 7, Assoc: AssocRight},
+		OpNot:        {Binding: 7, Assoc: AssocRight},
+	}
+	binaryOps = map[Op]Precedence{
+		OpOr:          {Binding: 1, Assoc: AssocLeft},
+		OpXor:         {Binding: 2, Assoc: AssocLeft},
+		OpAnd:         {Binding: 3, Assoc: AssocLeft},
+		OpShiftLeft:   {Binding: 4, Assoc: AssocLeft},
+		OpShiftRight:  {Binding: 4, Assoc: AssocLeft},
+		OpPlus:        {Binding: 5, Assoc: AssocLeft},
+		OpMinus:       {Binding: 5, Assoc: AssocLeft},
+		OpMultiply:    {Binding: 6, Assoc: AssocLeft},
+		OpDivide:      {Binding: 6, Assoc: AssocLeft},
+		OpModulo:      {Binding: 6, Assoc: AssocLeft},
+		OpFloorDivide: {Binding: 6, Assoc: AssocLeft},
+		OpMatMul:      {Binding: 6, Assoc: AssocLeft},
+		// ^ binds tighter than unary operators, so "-2^2" is -(2^2).
+		OpPower: {Binding: 8, Assoc: AssocRight},
 	}
-	binaryOps = map[Op]struct{}{
-		OpPlus:     {},
-		OpDivide:   {},
-		OpMultiply: {},
-		OpMinus:    {},
+	postfixOps = map[Op]Precedence{
+		OpFactorial: {Binding: 9, Assoc: AssocLeft},
+		OpModulo:    {Binding: 9, Assoc: AssocLeft},
+	}
+	// rangeOps take a parenthesized argument list rather than an operand,
+	// so they have no precedence.
+	rangeOps = map[Op]bool{
+		OpIntegral: true,
+		OpSum:      true,
+		OpProduct:  true,
 	}
 )
 
@@ -63,11 +167,44 @@ func (o Op) IsUnary() bool {
 	return ok
 }
 
+func (o Op) IsPostfix() bool {
+	_, ok := postfixOps[o]
+	return ok
+}
+
+// IsRange reports whether o is a range operator such as Σ.
+func (o Op) IsRange() bool {
+	return rangeOps[o]
+}
+
+// BinaryPrecedence returns the precedence of o when used as a binary
+// operator, if it is one.
+func (o Op) BinaryPrecedence() (Precedence, bool) {
+	p, ok := binaryOps[o]
+	return p, ok
+}
+
+// UnaryPrecedence returns the precedence of o when used as a prefix
+// operator, if it is one.
+func (o Op) UnaryPrecedence() (Precedence, bool) {
+	p, ok := unaryOps[o]
+	return p, ok
+}
+
+// PostfixPrecedence returns the precedence of o when used as a postfix
+// operator, if it is one.
+func (o Op) PostfixPrecedence() (Precedence, bool) {
+	p, ok := postfixOps[o]
+	return p, ok
+}
+
 type Node interface {
 	isNode()
 }
 
-type NumberNode int64
+type NumberNode struct {
+	*big.Rat
+}
 
 func (n NumberNode) isNode() {}
 
@@ -85,243 +222,200 @@ type UnaryOpNode struct {
 
 func (n UnaryOpNode) isNode() {}
 
+// PostfixOpNode applies an operator written after its operand, as in "5!"
+// or "10%".
+type PostfixOpNode struct {
+	Inner Node
+	Op
+}
+
+func (n PostfixOpNode) isNode() {}
+
+// isPercent returns n if it is a percentage, the postfix reading of %, as
+// in "10%".
+func isPercent(n Node) (PostfixOpNode, bool) {
+	pct, ok := n.(PostfixOpNode)
+	return pct, ok && pct.Op == OpModulo
+}
+
 type ParenWrappedNode struct {
 	Inner Node
 }
 
 func (n ParenWrappedNode) isNode() {}
 
-func Eval(n Node) int64 {
-	// assumes a well formed tree
-	switch v := n.(type) {
-	case NumberNode:
-		return int64(v)
-	case BinaryOpNode:
-		lhs := Eval(v.LHS)
-		rhs := Eval(v.RHS)
-		switch v.Op {
-		case OpDivide:
-			// todo: divide by zero detection
-			return lhs / rhs
-		case OpMultiply:
-			return lhs * rhs
-		case OpMinus:
-			return lhs - rhs
-		case OpPlus:
-			return lhs + rhs
-		}
-		return 0
-	case UnaryOpNode:
-		inner := Eval(v.Inner)
-		switch v.Op {
-		case OpSquareRoot:
-			//  TODO: math.BigFloat
-			return int64(math.Sqrt(float64(inner)))
-		case OpMinus:
-			return inner * -1
-		default:
-			return 0
-		}
-	case ParenWrappedNode:
-		return Eval(v.Inner)
-	default:
-		panic("invalid node")
-	}
+// VariableNode refers to a value bound in an Environment.
+type VariableNode struct {
+	Name string
+}
+
+func (n VariableNode) isNode() {}
+
+// ConstantNode refers to a named constant such as π.
+type ConstantNode struct {
+	Name string
+	// Symbol is how the constant is written, e.g. "π" for pi. Empty means
+	// Name.
+	Symbol string
+}
+
+func (n ConstantNode) isNode() {}
+
+// AssignNode binds the value of an expression to a name, as in "x = 3".
+type AssignNode struct {
+	Name  string
+	Value Node
+}
+
+func (n AssignNode) isNode() {}
+
+// CallNode applies a named function to its arguments, as in "max(1, 2)".
+type CallNode struct {
+	Name string
+	Args []Node
+}
+
+func (n CallNode) isNode() {}
+
+// FunctionDefNode defines a function in terms of its parameters, as in
+// "f(x) = x*x + 1".
+type FunctionDefNode struct {
+	Name   string
+	Params []string
+	Body   Node
+}
+
+func (n FunctionDefNode) isNode() {}
+
+// EquationNode states that two expressions are equal, as in "x^2 - 2 = 0".
+// Equations are not evaluated but solved; see Solver.
+type EquationNode struct {
+	LHS, RHS Node
+}
+
+func (n EquationNode) isNode() {}
+
+// RangeOpNode applies a range operator to Body for the values of the
+// variable Var from From to To, as in "Σ(k^2, k, 1, 10)" or
+// "∫(x^2, x, 0, 1)". Var is bound in Body only.
+type RangeOpNode struct {
+	Op
+	Body     Node
+	Var      string
+	From, To Node
 }
 
+func (n RangeOpNode) isNode() {}
+
+// ListNode is a list literal, as in "[1, 2, 3]".
+type ListNode struct {
+	Elems []Node
+}
+
+func (n ListNode) isNode() {}
+
+// DateNode is a date literal, as in "2024-03-15".
+type DateNode struct {
+	DateLiteral
+}
+
+func (n DateNode) isNode() {}
+
+// UnitNode refers to a named unit such as km, read by a Parser with a
+// UnitRegistry. It evaluates to a Quantity of one of the unit, so "5 km"
+// is 5 times km.
+type UnitNode struct {
+	Name string
+}
+
+func (n UnitNode) isNode() {}
+
+// ConvertNode expresses the value of an expression in another unit, as in
+// "90 min to h". Unit is usually a UnitNode or a product or quotient of
+// them, such as "km / h".
+type ConvertNode struct {
+	Value, Unit Node
+}
+
+func (n ConvertNode) isNode() {}
+
+// Pretty writes a tree as text with the zero Formatter.
 func Pretty(n Node) string {
-	switch v := n.(type) {
-	case NumberNode:
-		return strconv.FormatInt(int64(v), 10)
-	case BinaryOpNode:
-		lhs := Pretty(v.LHS)
-		rhs := Pretty(v.RHS)
-		return lhs + " " + string(v.Op) + " " + rhs
-	case UnaryOpNode:
-		return string(v.Op) + Pretty(v.Inner)
-	case ParenWrappedNode:
-		return "(" + Pretty(v.Inner) + ")"
-	default:
-		panic(fmt.Sprintf("invalid node: %T", n))
-	}
+	return Formatter{}.Pretty(n)
 }
 
-func Parse(tokens []Token) (tree Node, err error) {
-	var lhs Node
-	if len(tokens) == 0 {
-		return nil, io.EOF
-	}
-	i := 0
-	thisToken := tokens[i]
-	if len(tokens) == 1 {
-		if thisToken.Number == nil {
-			return nil, fmt.Errorf("expected number as final token")
-		}
-		lhs = NumberNode(*thisToken.Number)
-		return lhs, nil
-	}
-	switch {
-	case thisToken.Number != nil: // eq = number
-		lhs = NumberNode(*thisToken.Number)
-	case thisToken.Op != nil && thisToken.Op.IsUnary():
-		i++
-		nextToken := tokens[i]
-		// if we call parse, how do we stop parse from consuming the entire rest of the tree?
-		var inner Node
-		switch {
-		case nextToken.Op != nil && *nextToken.Op == OpOpenParen:
-			i++
-			inner, i, err = parseParenExpr(i, tokens)
-			if err != nil {
-				return nil, err
-			}
-		case nextToken.Number != nil:
-			inner = NumberNode(*nextToken.Number)
-		default:
-			return nil, fmt.Errorf("expected number after -")
-		}
-		lhs = UnaryOpNode{
-			Inner: inner,
-			Op:    *thisToken.Op,
-		}
-	case thisToken.Op != nil && *thisToken.Op == OpOpenParen:
-		i++
-		lhs, i, err = parseParenExpr(i, tokens)
-		if err != nil {
-			return lhs, err
-		}
-	default:
-		return lhs, fmt.Errorf("bad token for starting production")
-	}
-	i++
-	if i >= len(tokens) {
-		return lhs, nil
-	}
-	nextToken := tokens[i]
-	// based on our productions, next token has to be a binop.
-	if nextToken.Op == nil {
-		return tree, fmt.Errorf("eq middle token %v was not an op", nextToken)
-	}
-	newTree := BinaryOpNode{
-		LHS: lhs,
-		Op:  *nextToken.Op,
-		RHS: nil,
-	}
-	i++
-	right, err := Parse(tokens[i:])
+// ParseString tokenizes and parses s with the zero Parser.
+func ParseString(s string) (Node, error) {
+	return Parser{}.ParseString(s)
+}
+
+// ParseString tokenizes and parses s. Malformed input is reported as a
+// *ParseError whose Offset is the rune offset of the problem in s.
+func (ps Parser) ParseString(s string) (Node, error) {
+	lexemes, err := Lex(s)
 	if err != nil {
-		return newTree, err
+		return nil, err
 	}
-	newTree.RHS = right
-	return newTree, nil
-}
-
-// parens are the worst
-// we're doing a bad job here
-// read until we get a close paren
-func parseParenExpr(j int, tokens []Token) (node Node, newI int, err error) {
-	startJ := j
-	closeNeeded := 1
-	for j < len(tokens) {
-		if tokens[j].Op != nil && *tokens[j].Op == OpOpenParen {
-			closeNeeded++
+	tks, spans := Tokens(lexemes)
+	tree, err := ps.Parse(tks)
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		if perr.Index < len(spans) {
+			perr.Offset = spans[perr.Index].Start
+		} else {
+			perr.Offset = len([]rune(s))
 		}
-		if tokens[j].Op != nil && *tokens[j].Op == OpCloseParen {
-			closeNeeded--
-			if closeNeeded == 0 {
-				break
-			}
-		}
-		j++
-	}
-	inner, err := Parse(tokens[startJ:j])
-	if err != nil {
-		return nil, 0, err
 	}
-	return ParenWrappedNode{
-		Inner: inner,
-	}, j, nil
+	return tree, err
 }
 
-func ParseString(s string) (Node, error) {
-	tks := []Token{}
-	for _, c := range s {
-		if c == ' ' {
-			continue
-		}
-		switch c {
-		case '0':
-			tks = append(tks, iTk(0))
-		case '1':
-			tks = append(tks, iTk(1))
-		case '2':
-			tks = append(tks, iTk(2))
-		case '3':
-			tks = append(tks, iTk(3))
-		case '4':
-			tks = append(tks, iTk(4))
-		case '5':
-			tks = append(tks, iTk(5))
-		case '6':
-			tks = append(tks, iTk(6))
-		case '7':
-			tks = append(tks, iTk(7))
-		case '8':
-			tks = append(tks, iTk(8))
-		case '9':
-			tks = append(tks, iTk(9))
-		case '(':
-			tks = append(tks, oTk(OpOpenParen))
-		case ')':
-			tks = append(tks, oTk(OpCloseParen))
-		case '-':
-			tks = append(tks, oTk(OpMinus))
-		case '+':
-			tks = append(tks, oTk(OpPlus))
-		case '*':
-			tks = append(tks, oTk(OpMultiply))
-		case '/':
-			tks = append(tks, oTk(OpDivide))
-		case '√':
-			tks = append(tks, oTk(OpSquareRoot))
+// maxExponent bounds the exponent of a numeric literal, so "1e999999999"
+// fails with ErrOverflow instead of exhausting memory.
+const maxExponent = 10000
+
+// ParseNumber parses a numeric literal such as "12", "2.5", ".5", "3.",
+// "1.2e-3" or "0xff" into an exact rational. Exponents beyond maxExponent
+// are reported as ErrOverflow.
+func ParseNumber(s string) (*big.Rat, error) {
+	rs := []rune(s)
+	if n := scanNumber(rs); n == 0 || n != len(rs) {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	if scanPrefixedInt(rs) != 0 {
+		i, ok := new(big.Int).SetString(s, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid number %q", s)
 		}
-		if len(tks) > 1 {
-			if tks[len(tks)-1].Number != nil &&
-				tks[len(tks)-2].Number != nil {
-				dec := *tks[len(tks)-2].Number
-				dig := *tks[len(tks)-1].Number
-				tks[len(tks)-2].Number = i64p(dec*10 + dig)
-				tks = tks[:len(tks)-1]
-			}
+		return new(big.Rat).SetInt(i), nil
+	}
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		exp, err := strconv.Atoi(s[i+1:])
+		if err != nil || exp > maxExponent || exp < -maxExponent {
+			return nil, fmt.Errorf("number %q: %w", s, ErrOverflow)
 		}
 	}
-	return Parse(tks)
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return r, nil
 }
 
-// productions
-// eq =
-//   eq binop eq
-//   ( eq )
-//   unop eq
-//   numeral
-// binop = - | + | * | /
-// unop = - | √
-//
-// start = eq
-
 func iTk(i int64) Token {
 	return Token{
-		Number: i64p(i),
+		Number: new(big.Rat).SetInt64(i),
 	}
 }
-func oTk(o Op) Token {
+func idTk(name string) Token {
 	return Token{
-		Op: opP(o),
+		Ident: &name,
 	}
 }
 
-func i64p(i int64) *int64 {
-	return &i
+func oTk(o Op) Token {
+	return Token{
+		Op: opP(o),
+	}
 }
 
 func opP(o Op) *Op {
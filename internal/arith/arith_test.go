@@ -43,7 +43,7 @@ func TestParse(t *testing.T) {
 				t.Fatalf("parse failed: %v", err)
 			}
 			res := Eval(tree)
-			if res != tc.out {
+			if res.String() != strconv.FormatInt(tc.out, 10) {
 				t.Fatalf("out mismatch: expected %v vs %v", tc.out, res)
 			}
 		})
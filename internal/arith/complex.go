@@ -0,0 +1,229 @@
+package arith
+
+import (
+	"math/big"
+	"math/cmplx"
+)
+
+// Complex is a complex number with arbitrary precision parts. Evaluation
+// never produces a Complex with a zero imaginary part; those are returned
+// as Floats.
+type Complex struct {
+	Re, Im *big.Float
+}
+
+// String writes c in rectangular form, as in "1 + 2i", "-0.5i" or "i".
+func (c Complex) String() string {
+	return Formatter{}.Format(c)
+}
+
+// isComplex reports whether any of vals is a Complex.
+func isComplex(vals ...Value) bool {
+	for _, v := range vals {
+		if _, ok := v.(Complex); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// toComplex returns v as a Complex, with a zero imaginary part of
+// precision prec if v is real.
+func toComplex(v Value, prec uint) Complex {
+	if c, ok := v.(Complex); ok {
+		return c
+	}
+	return Complex{Re: toFloat(v, prec), Im: new(big.Float).SetPrec(prec)}
+}
+
+// complexValue returns re + im*i, as a Float if im is zero.
+func complexValue(c Complex) Value {
+	if c.Im.Sign() == 0 {
+		return Float{c.Re}
+	}
+	return c
+}
+
+func toComplex128(v Value) complex128 {
+	c := toComplex(v, 53)
+	re, _ := c.Re.Float64()
+	im, _ := c.Im.Float64()
+	return complex(re, im)
+}
+
+// complexResult returns the result of a complex128 function as a Value
+// carrying float64's precision.
+func complexResult(z complex128) (Value, error) {
+	switch {
+	case cmplx.IsNaN(z):
+		return nil, ErrDomain
+	case cmplx.IsInf(z):
+		return nil, ErrOverflow
+	}
+	return complexValue(Complex{
+		Re: new(big.Float).SetPrec(53).SetFloat64(real(z)),
+		Im: new(big.Float).SetPrec(53).SetFloat64(imag(z)),
+	}), nil
+}
+
+// complexBinary applies an arithmetic operator to complex operands.
+// Other operators are not defined for complex numbers.
+func (ev Evaluator) complexBinary(op Op, lhs, rhs Value) (Value, error) {
+	prec := ev.floatPrecision(lhs, rhs)
+	l, r := toComplex(lhs, prec), toComplex(rhs, prec)
+	var res Complex
+	switch op {
+	case OpPlus:
+		res = Complex{
+			Re: new(big.Float).SetPrec(prec).Add(l.Re, r.Re),
+			Im: new(big.Float).SetPrec(prec).Add(l.Im, r.Im),
+		}
+	case OpMinus:
+		res = Complex{
+			Re: new(big.Float).SetPrec(prec).Sub(l.Re, r.Re),
+			Im: new(big.Float).SetPrec(prec).Sub(l.Im, r.Im),
+		}
+	case OpMultiply:
+		res = mulComplex(l, r, prec)
+	case OpDivide:
+		res = quoComplex(l, r, prec)
+	default:
+		return nil, ErrDomain
+	}
+	if res.Re.IsInf() || res.Im.IsInf() {
+		return nil, ErrOverflow
+	}
+	return complexValue(res), nil
+}
+
+// mulComplex returns (a+bi)(c+di) = (ac-bd) + (ad+bc)i.
+func mulComplex(l, r Complex, prec uint) Complex {
+	newFloat := func() *big.Float { return new(big.Float).SetPrec(prec) }
+	re := newFloat().Sub(newFloat().Mul(l.Re, r.Re), newFloat().Mul(l.Im, r.Im))
+	im := newFloat().Add(newFloat().Mul(l.Re, r.Im), newFloat().Mul(l.Im, r.Re))
+	return Complex{Re: re, Im: im}
+}
+
+// quoComplex returns (a+bi)/(c+di) = ((ac+bd) + (bc-ad)i) / (c²+d²). The
+// divisor must not be zero.
+func quoComplex(l, r Complex, prec uint) Complex {
+	newFloat := func() *big.Float { return new(big.Float).SetPrec(prec) }
+	den := newFloat().Add(newFloat().Mul(r.Re, r.Re), newFloat().Mul(r.Im, r.Im))
+	re := newFloat().Add(newFloat().Mul(l.Re, r.Re), newFloat().Mul(l.Im, r.Im))
+	im := newFloat().Sub(newFloat().Mul(l.Im, r.Re), newFloat().Mul(l.Re, r.Im))
+	return Complex{Re: re.Quo(re, den), Im: im.Quo(im, den)}
+}
+
+// absComplex returns the magnitude of c, √(a²+b²).
+func absComplex(c Complex, prec uint) *big.Float {
+	sum := new(big.Float).SetPrec(prec).Mul(c.Re, c.Re)
+	sum.Add(sum, new(big.Float).SetPrec(prec).Mul(c.Im, c.Im))
+	return sum.Sqrt(sum)
+}
+
+// sqrtComplex returns the principal square root of c, whose real part is
+// √((|c|+a)/2) and imaginary part √((|c|-a)/2) with the sign of b.
+func sqrtComplex(c Complex, prec uint) Complex {
+	r := absComplex(c, prec)
+	half := func(x *big.Float) *big.Float {
+		if x.Sign() < 0 {
+			// |c| rounded below |a|
+			x.SetInt64(0)
+		}
+		x.SetMantExp(x, -1)
+		return x.Sqrt(x)
+	}
+	re := half(new(big.Float).SetPrec(prec).Add(r, c.Re))
+	im := half(new(big.Float).SetPrec(prec).Sub(r, c.Re))
+	if c.Im.Sign() < 0 {
+		im.Neg(im)
+	}
+	return Complex{Re: re, Im: im}
+}
+
+// complexPow raises base to exp where either is complex, or where base is
+// negative and exp is not an integer. Integer exponents are computed by
+// repeated squaring at full precision; others are computed in complex128.
+// Zero raised to a power with a negative real part is a division by zero,
+// and zero raised to a nonzero imaginary power, as in "0^i", has no value.
+func (ev Evaluator) complexPow(base, exp Value) (Value, error) {
+	if isZero(base) {
+		switch z := toComplex128(exp); {
+		case real(z) < 0:
+			return nil, ErrDivideByZero
+		case real(z) == 0 && z != 0:
+			return nil, ErrDomain
+		}
+	}
+	e, ok := exp.(Int)
+	if !ok {
+		return complexResult(cmplx.Pow(toComplex128(base), toComplex128(exp)))
+	}
+	prec := ev.floatPrecision(base)
+	one := Complex{Re: new(big.Float).SetPrec(prec).SetInt64(1), Im: new(big.Float).SetPrec(prec)}
+	res, sq := one, toComplex(base, prec)
+	n := new(big.Int).Abs(e.Int)
+	for i := 0; i < n.BitLen(); i++ {
+		if n.Bit(i) == 1 {
+			res = mulComplex(res, sq, prec)
+		}
+		sq = mulComplex(sq, sq, prec)
+		if res.Re.IsInf() || res.Im.IsInf() || sq.Re.IsInf() || sq.Im.IsInf() {
+			return nil, ErrOverflow
+		}
+	}
+	if e.Sign() < 0 {
+		res = quoComplex(one, res, prec)
+	}
+	return complexValue(res), nil
+}
+
+// complexFunc adapts a float64 function like float64Func, computing with
+// cfn instead for Complex arguments and, in complex mode, for real
+// arguments outside the domain of fn. Quantities and Dates are outside
+// the domain of both; see keepUnit for functions that accept quantities.
+func complexFunc(fn func(float64) float64, cfn func(complex128) complex128, inDomain func(float64) bool) func(Evaluator, Value) (Value, error) {
+	return func(ev Evaluator, v Value) (Value, error) {
+		if isQuantity(v) || isDate(v) {
+			return nil, ErrDomain
+		}
+		if isComplex(v) || ev.Complex && !inDomain(toFloat64(v)) {
+			return complexResult(cfn(toComplex128(v)))
+		}
+		return float64Func(fn, inDomain)(ev, v)
+	}
+}
+
+func reFunc(ev Evaluator, v Value) (Value, error) {
+	if c, ok := v.(Complex); ok {
+		return Float{c.Re}, nil
+	}
+	return v, nil
+}
+
+func imFunc(ev Evaluator, v Value) (Value, error) {
+	if c, ok := v.(Complex); ok {
+		return Float{c.Im}, nil
+	}
+	return Int{new(big.Int)}, nil
+}
+
+func conjFunc(ev Evaluator, v Value) (Value, error) {
+	if c, ok := v.(Complex); ok {
+		return Complex{Re: c.Re, Im: new(big.Float).Neg(c.Im)}, nil
+	}
+	return v, nil
+}
+
+// argFunc is the angle of v from the positive real axis, in the
+// Evaluator's AngleMode.
+func argFunc(ev Evaluator, v Value) (Value, error) {
+	if isZero(v) || isQuantity(v) || isDate(v) {
+		return nil, ErrDomain
+	}
+	res := cmplx.Phase(toComplex128(v))
+	if ev.Angle == Degrees {
+		res = radiansToDegrees(res)
+	}
+	return fromFloat64(res), nil
+}
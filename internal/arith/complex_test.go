@@ -0,0 +1,169 @@
+package arith
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestComplex(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+		err error
+	}
+	tcs := []testCase{
+		{in: "√(-4)", out: "2i"},
+		{in: "√(-1/4)", out: "0.5i"},
+		{in: "i", out: "i"},
+		{in: "i*i", out: "-1"},
+		{in: "-i", out: "-i"},
+		{in: "2 + 3i", out: "2 + 3i"},
+		{in: "(1+2i)(3-i)", out: "5 + 5i"},
+		{in: "(1+2i) - (1+2i)", out: "0"},
+		{in: "1/i", out: "-i"},
+		{in: "(1+i)^2", out: "2i"},
+		{in: "(1+i)^-2", out: "-0.5i"},
+		{in: "(1+i)^0", out: "1"},
+		{in: "0^(1+i)", out: "0"},
+		{in: "√(2i)", out: "1 + i"},
+		{in: "√(-3-4i)", out: "1 - 2i"},
+		{in: "abs(3+4i)", out: "5"},
+		{in: "re(1+2i)", out: "1"},
+		{in: "im(1+2i)", out: "2"},
+		{in: "im(7)", out: "0"},
+		{in: "conj(1+2i)", out: "1 - 2i"},
+		{in: "ln(-1)", out: "3.14159265358979i"},
+		{in: "log(-100)", out: "2 + 1.36437635384184i"},
+		{in: "arg(i)", out: "1.5707963267949"},
+		{in: "arg(-2)", out: "3.14159265358979"},
+		{in: "Σ(i^k, k, 1, 4)", out: "0"},
+		{in: "10% * i", out: "0.1i"},
+		{in: "(1+i)!", err: ErrDomain},
+		{in: "floor(i)", err: ErrDomain},
+		{in: "max(i, 1)", err: ErrDomain},
+		{in: "i % 2", err: ErrDomain},
+		{in: "i // 2", err: ErrDomain},
+		{in: "i & 1", err: ErrDomain},
+		{in: "~i", err: ErrDomain},
+		{in: "i / 0", err: ErrDivideByZero},
+		{in: "0^(i-1)", err: ErrDivideByZero},
+		{in: "pow(0, i-1)", err: ErrDivideByZero},
+		{in: "0^i", err: ErrDomain},
+		{in: "0^(-i)", err: ErrDomain},
+		{in: "arg(0)", err: ErrDomain},
+		{in: "∫(i, x, 0, 1)", err: ErrDomain},
+	}
+	ev := Evaluator{Complex: true, Constants: ComplexConstants}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := Parser{Constants: ComplexConstants}.ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			v, err := ev.Eval(tree)
+			if tc.err != nil {
+				var everr *EvalError
+				if !errors.Is(err, tc.err) || !errors.As(err, &everr) || everr.Node == nil {
+					t.Fatalf("expected an *EvalError wrapping %v, got %#v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := v.String(); got != tc.out {
+				t.Fatalf("expected %v, got %v", tc.out, got)
+			}
+		})
+	}
+}
+
+// TestComplexFunctions checks functions of complex arguments against
+// identities, as their results are rounded.
+func TestComplexFunctions(t *testing.T) {
+	type testCase struct {
+		in     string
+		re, im float64
+	}
+	tcs := []testCase{
+		{in: "exp(i*π)", re: -1},
+		{in: "exp(ln(2+3i))", re: 2, im: 3},
+		{in: "sin(i)^2 + cos(i)^2", re: 1},
+		{in: "(-8)^(1/3)", re: 1, im: math.Sqrt(3)},
+		{in: "sin(asin(2))", re: 2},
+		{in: "acosh(0)", im: math.Pi / 2},
+		{in: "log(-8, -2) * ln(-2)", re: math.Log(8), im: math.Pi},
+	}
+	ev := Evaluator{Complex: true, Constants: ComplexConstants}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := Parser{Constants: ComplexConstants}.ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			v, err := ev.Eval(tree)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			z := toComplex128(v)
+			if math.Abs(real(z)-tc.re) > 1e-12 || math.Abs(imag(z)-tc.im) > 1e-12 {
+				t.Fatalf("expected %v + %vi, got %v", tc.re, tc.im, v)
+			}
+		})
+	}
+}
+
+func TestComplexMode(t *testing.T) {
+	// without complex mode only complex operands give complex results
+	ev := Evaluator{Constants: ComplexConstants}
+	for in, want := range map[string]error{"√(-4)": ErrDomain, "ln(-1)": ErrDomain, "(-8)^(1/3)": ErrDomain, "i*i": nil} {
+		tree, err := Parser{Constants: ComplexConstants}.ParseString(in)
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		if _, err := ev.Eval(tree); !errors.Is(err, want) {
+			t.Fatalf("%s: expected %v, got %v", in, want, err)
+		}
+	}
+	// i is only a constant in ComplexConstants
+	env := NewEnvironment()
+	env.Set("i", Int{big.NewInt(3)})
+	tree, err := ParseString("2i")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if v, err := (Evaluator{Env: env}).Eval(tree); err != nil || v.String() != "6" {
+		t.Fatalf("expected 6, got %v, %v", v, err)
+	}
+}
+
+func TestFormatComplex(t *testing.T) {
+	ev := Evaluator{Constants: ComplexConstants}
+	tree, err := Parser{Constants: ComplexConstants}.ParseString("1 + i")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	v, err := ev.Eval(tree)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	type testCase struct {
+		f   Formatter
+		out string
+	}
+	tcs := []testCase{
+		{f: Formatter{}, out: "1 + i"},
+		{f: Formatter{Notation: NotationFixed, DecimalPlaces: 2}, out: "1.00 + 1.00i"},
+		{f: Formatter{Polar: true, PolarAngle: Degrees, SignificantDigits: 6}, out: "1.41421∠45°"},
+		{f: Formatter{Polar: true, SignificantDigits: 6}, out: "1.41421∠0.785398"},
+	}
+	for _, tc := range tcs {
+		if got := tc.f.Format(v); got != tc.out {
+			t.Errorf("%+v: expected %q, got %q", tc.f, tc.out, got)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package arith
+
+import (
+	"math/big"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// A Constant is a named number expressions can refer to, such as pi.
+type Constant struct {
+	// Symbol is how Pretty writes the constant, e.g. "π". Empty means the
+	// constant's name.
+	Symbol string
+	// Value computes the constant with at least prec bits of precision.
+	// Exact constants may return an Int or Rat.
+	Value func(prec uint) Value
+}
+
+// A ConstantRegistry holds the constants expressions can refer to by name.
+// The zero ConstantRegistry is empty and ready to use, and a
+// ConstantRegistry is safe for concurrent use.
+type ConstantRegistry struct {
+	mu     sync.RWMutex
+	consts map[string]Constant
+}
+
+// NewConstantRegistry returns an empty ConstantRegistry.
+func NewConstantRegistry() *ConstantRegistry {
+	return &ConstantRegistry{}
+}
+
+// Register makes c available as name, replacing any constant already
+// registered as name. It panics if name is not an identifier.
+func (r *ConstantRegistry) Register(name string, c Constant) {
+	if rs := []rune(name); len(rs) == 0 || scanIdent(rs) != len(rs) {
+		panic("arith: invalid constant name " + strconv.Quote(name))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.consts == nil {
+		r.consts = make(map[string]Constant)
+	}
+	r.consts[name] = c
+}
+
+// Lookup returns the constant registered as name.
+func (r *ConstantRegistry) Lookup(name string) (Constant, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.consts[name]
+	return c, ok
+}
+
+// Names returns the registered names in sorted order.
+func (r *ConstantRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.consts))
+	for name := range r.consts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clone returns a copy of r. Registering constants with the copy does not
+// affect r.
+func (r *ConstantRegistry) Clone() *ConstantRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := &ConstantRegistry{consts: make(map[string]Constant, len(r.consts))}
+	for name, constant := range r.consts {
+		c.consts[name] = constant
+	}
+	return c
+}
+
+// DefaultConstants are the constants expressions can refer to when a
+// Parser or Evaluator does not specify a ConstantRegistry: pi (π), e, phi
+// (φ), the golden ratio, and tau (τ), 2π.
+var DefaultConstants = defaultConstants()
+
+func defaultConstants() *ConstantRegistry {
+	r := NewConstantRegistry()
+	r.Register("pi", Constant{Symbol: "π", Value: floatConstant(pi)})
+	r.Register("e", Constant{Value: floatConstant(euler)})
+	r.Register("phi", Constant{Symbol: "φ", Value: floatConstant(phi)})
+	r.Register("tau", Constant{Symbol: "τ", Value: floatConstant(func(prec uint) *big.Float {
+		p := pi(prec)
+		return p.SetMantExp(p, 1)
+	})})
+	return r
+}
+
+// ComplexConstants are DefaultConstants and the imaginary unit, i, for
+// Parsers and Evaluators working with complex numbers. DefaultConstants
+// leaves i out so it stays free to name a variable.
+var ComplexConstants = complexConstants()
+
+func complexConstants() *ConstantRegistry {
+	r := DefaultConstants.Clone()
+	r.Register("i", Constant{Value: func(prec uint) Value {
+		return Complex{
+			Re: new(big.Float).SetPrec(prec),
+			Im: new(big.Float).SetPrec(prec).SetInt64(1),
+		}
+	}})
+	return r
+}
+
+func floatConstant(fn func(prec uint) *big.Float) func(uint) Value {
+	return func(prec uint) Value {
+		return Float{fn(prec)}
+	}
+}
+
+// guardBits are extra bits of precision constants are computed with, so
+// rounding errors do not reach the bits of the result.
+const guardBits = 64
+
+// pi computes π with the Gauss–Legendre algorithm, which doubles the
+// number of correct digits with each iteration.
+func pi(prec uint) *big.Float {
+	work := prec + guardBits
+	newFloat := func(x int64) *big.Float {
+		return new(big.Float).SetPrec(work).SetInt64(x)
+	}
+	a := newFloat(1)
+	b := new(big.Float).Quo(a, new(big.Float).SetPrec(work).Sqrt(newFloat(2)))
+	t := new(big.Float).Quo(a, newFloat(4))
+	p := newFloat(1)
+	for i := 0; i < 64; i++ {
+		next := new(big.Float).Add(a, b)
+		next.Quo(next, newFloat(2))
+		b.Sqrt(b.Mul(b, a))
+		d := new(big.Float).Sub(a, next)
+		t.Sub(t, d.Mul(d, d).Mul(d, p))
+		a = next
+		p.Mul(p, newFloat(2))
+		if d := new(big.Float).Sub(a, b); d.Sign() == 0 || d.MantExp(nil) < -int(work) {
+			break
+		}
+	}
+	res := new(big.Float).Add(a, b)
+	res.Mul(res, res)
+	res.Quo(res, t.Mul(t, newFloat(4)))
+	return new(big.Float).SetPrec(prec).Set(res)
+}
+
+// euler computes e as the sum of 1/k!, stopping once terms no longer
+// affect the result.
+func euler(prec uint) *big.Float {
+	work := prec + guardBits
+	sum := new(big.Float).SetPrec(work).SetInt64(1)
+	term := new(big.Float).SetPrec(work).SetInt64(1)
+	for k := int64(1); ; k++ {
+		term.Quo(term, new(big.Float).SetPrec(work).SetInt64(k))
+		if term.MantExp(nil) < -int(work) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	return new(big.Float).SetPrec(prec).Set(sum)
+}
+
+// phi computes the golden ratio, (1+√5)/2.
+func phi(prec uint) *big.Float {
+	work := prec + guardBits
+	res := new(big.Float).SetPrec(work).Sqrt(new(big.Float).SetPrec(work).SetInt64(5))
+	res.Add(res, new(big.Float).SetPrec(work).SetInt64(1))
+	res.Quo(res, new(big.Float).SetPrec(work).SetInt64(2))
+	return new(big.Float).SetPrec(prec).Set(res)
+}
@@ -0,0 +1,109 @@
+package arith
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestConstants(t *testing.T) {
+	type testCase struct {
+		in        string
+		backend   Backend
+		precision uint
+		out       string
+		err       error
+	}
+	const piDigits = "3.14159265358979323846264338327950288419716939937510582097494459"
+	tcs := []testCase{
+		{in: "π", out: "3.141592653589793239"},
+		{in: "pi", precision: 200, out: piDigits[:61]},
+		{in: "e", out: "2.718281828459045235"},
+		{in: "e", precision: 200, out: "2.71828182845904523536028747135266249775724709369995957496697"},
+		{in: "φ", out: "1.618033988749894848"},
+		{in: "phi^2 - phi", out: "1"},
+		{in: "τ", out: "6.283185307179586477"},
+		{in: "τ/2 - π", out: "0"},
+		{in: "2π", out: "6.283185307179586477"},
+		{in: "π", backend: BackendFloat, precision: 24, out: "3.141593"},
+		{in: "π", backend: BackendInteger, err: ErrDomain},
+		{in: "sin(π)", out: "1.22464679914735e-16"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			res, err := Evaluator{Backend: tc.backend, Precision: tc.precision}.Eval(tree)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.String() != tc.out {
+				t.Fatalf("out mismatch: expected %v vs %v", tc.out, res)
+			}
+		})
+	}
+}
+
+func TestConstantNodes(t *testing.T) {
+	tree, err := ParseString("2π + e")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got := Pretty(tree); got != "2 * π + e" {
+		t.Fatalf("unexpected pretty form %q", got)
+	}
+	sum := tree.(BinaryOpNode)
+	if c, ok := sum.RHS.(ConstantNode); !ok || c.Name != "e" {
+		t.Fatalf("expected the constant e, got %#v", sum.RHS)
+	}
+	var perr *ParseError
+	if _, err := ParseString("pi = 3"); !errors.As(err, &perr) || perr.Kind != AssignToConstant {
+		t.Fatalf("expected an assignment to constant error, got %v", err)
+	}
+	// parameters hide constants
+	tree, err = ParseString("f(e) = e + pi")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	body := tree.(FunctionDefNode).Body.(BinaryOpNode)
+	if _, ok := body.LHS.(VariableNode); !ok {
+		t.Fatalf("expected the parameter e, got %#v", body.LHS)
+	}
+	if _, ok := body.RHS.(ConstantNode); !ok {
+		t.Fatalf("expected the constant pi, got %#v", body.RHS)
+	}
+}
+
+func TestConstantRegistry(t *testing.T) {
+	consts := DefaultConstants.Clone()
+	consts.Register("c", Constant{Value: func(uint) Value {
+		return Int{big.NewInt(299792458)}
+	}})
+	if _, ok := DefaultConstants.Lookup("c"); ok {
+		t.Fatalf("registering with a clone changed DefaultConstants")
+	}
+	tree, err := Parser{Constants: consts}.ParseString("c*2")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	res, err := Evaluator{Backend: BackendInteger, Constants: consts}.Eval(tree)
+	if err != nil || res.String() != "599584916" {
+		t.Fatalf("unexpected result %v, %v", res, err)
+	}
+	if _, err := EvalChecked(tree); !errors.Is(err, ErrUnknownConst) {
+		t.Fatalf("expected %v, got %v", ErrUnknownConst, err)
+	}
+	if names := consts.Names(); strings.Join(names, " ") != "c e phi pi tau" {
+		t.Fatalf("unexpected names %v", names)
+	}
+}
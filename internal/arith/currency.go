@@ -0,0 +1,122 @@
+package arith
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// An ExchangeRateProvider supplies the rates currencies convert at.
+type ExchangeRateProvider interface {
+	// Rates returns the amount of each currency, keyed by its code, that
+	// one unit of a common reference currency buys. Only the ratios of
+	// rates matter, so the reference need not be one of the currencies.
+	Rates() (map[string]*big.Rat, error)
+}
+
+// RatesFile is an ExchangeRateProvider reading a table of rates from a
+// file, so conversions work offline. A file ending in .csv holds a
+// currency code and its rate on each line, optionally after a header
+// line; any other file holds a JSON object mapping codes to rates, as in
+// {"USD": 1, "EUR": 0.92}. The file is read on each call to Rates.
+type RatesFile struct {
+	Path string
+}
+
+// Rates reads the table in the file.
+func (f RatesFile) Rates() (map[string]*big.Rat, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var rates map[string]*big.Rat
+	if strings.EqualFold(filepath.Ext(f.Path), ".csv") {
+		rates, err = readRatesCSV(file)
+	} else {
+		rates, err = readRatesJSON(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Path, err)
+	}
+	return rates, nil
+}
+
+func readRatesJSON(r io.Reader) (map[string]*big.Rat, error) {
+	var table map[string]json.Number
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&table); err != nil {
+		return nil, err
+	}
+	rates := make(map[string]*big.Rat, len(table))
+	for code, n := range table {
+		rate, ok := new(big.Rat).SetString(n.String())
+		if !ok {
+			return nil, fmt.Errorf("invalid rate %q for %s", n, code)
+		}
+		rates[code] = rate
+	}
+	return rates, nil
+}
+
+func readRatesCSV(r io.Reader) (map[string]*big.Rat, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	rates := make(map[string]*big.Rat, len(records))
+	for i, rec := range records {
+		rate, ok := new(big.Rat).SetString(rec[1])
+		switch {
+		case !ok && i == 0:
+			// a header, as in "currency,rate"
+		case !ok:
+			return nil, fmt.Errorf("line %d: invalid rate %q for %s", i+1, rec[1], rec[0])
+		default:
+			rates[rec[0]] = rate
+		}
+	}
+	return rates, nil
+}
+
+// currencyDim is the Dimension of money.
+var currencyDim = Dimension{DimCurrency: 1}
+
+// RegisterCurrencies registers each currency p has a rate for as a unit
+// named by its code, replacing any unit already registered with that
+// name. Amounts convert at the ratio of their currencies' rates, so both
+// "100 USD to EUR" and "100 USD + 50 EUR" use the rates p gives. Nothing
+// is registered if p fails or gives a code that is not an identifier or
+// a rate that is not positive.
+func (r *UnitRegistry) RegisterCurrencies(p ExchangeRateProvider) error {
+	rates, err := p.Rates()
+	if err != nil {
+		return err
+	}
+	for code, rate := range rates {
+		if rs := []rune(code); len(rs) == 0 || scanIdent(rs) != len(rs) {
+			return fmt.Errorf("invalid currency code %q", code)
+		}
+		if rate == nil || rate.Sign() <= 0 {
+			return fmt.Errorf("invalid rate %v for %s", rate, code)
+		}
+	}
+	for code, rate := range rates {
+		r.Register(code, UnitDef{Dim: currencyDim, Scale: new(big.Rat).Inv(rate)})
+	}
+	return nil
+}
+
+// isCurrency reports whether u is a single currency, as in "USD".
+func (u Unit) isCurrency() bool {
+	return len(u) == 1 && u[0].Exp == 1 && u[0].Def.Dim == currencyDim
+}
@@ -0,0 +1,151 @@
+package arith
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixedRates is an ExchangeRateProvider for tests.
+type fixedRates map[string]*big.Rat
+
+func (r fixedRates) Rates() (map[string]*big.Rat, error) {
+	return r, nil
+}
+
+func TestCurrencies(t *testing.T) {
+	units := DefaultUnits.Clone()
+	err := units.RegisterCurrencies(fixedRates{
+		"USD": big.NewRat(1, 1),
+		"EUR": big.NewRat(92, 100),
+		"JPY": big.NewRat(150, 1),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	type testCase struct {
+		in  string
+		out string
+		err error
+	}
+	tcs := []testCase{
+		{in: "12.5 USD", out: "12.50 USD"},
+		{in: "100 USD to EUR", out: "92.00 EUR"},
+		{in: "100 USD in JPY", out: "15000.00 JPY"},
+		{in: "92 EUR + 100 USD", out: "184.00 EUR"},
+		{in: "100 USD / 3", out: "33.33 USD"},
+		{in: "100 USD / 4 h", out: "25 USD/h"},
+		{in: "100 EUR / 50 USD", out: "50/23"},
+		{in: "pmt(1%, 12, 1200 USD)", out: "-106.62 USD"},
+		{in: "compound(100 EUR, 10%, 2)", out: "121.00 EUR"},
+		{in: "npv(10%, -1000 USD, 920 EUR, 605 USD)", out: "371.90 USD"},
+		{in: "1 USD + 1 m", err: &DimensionError{}},
+		{in: "1 GBP", err: ErrUndefined},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := Parser{Units: units}.ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			v, err := Evaluator{Units: units}.Eval(tree)
+			if tc.err != nil {
+				var derr *DimensionError
+				if errors.As(tc.err, &derr) {
+					if !errors.As(err, &derr) {
+						t.Fatalf("expected a DimensionError, got %v", err)
+					}
+				} else if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := v.String(); got != tc.out {
+				t.Fatalf("expected %v, got %v", tc.out, got)
+			}
+		})
+	}
+}
+
+func TestRegisterCurrenciesErrors(t *testing.T) {
+	for _, rates := range []fixedRates{
+		{"US D": big.NewRat(1, 1)},
+		{"USD": big.NewRat(0, 1)},
+		{"USD": nil},
+	} {
+		units := NewUnitRegistry()
+		if err := units.RegisterCurrencies(rates); err == nil {
+			t.Fatalf("expected %v to fail", rates)
+		}
+		if names := units.Names(); len(names) != 0 {
+			t.Fatalf("expected nothing registered, got %v", names)
+		}
+	}
+}
+
+func TestRatesFile(t *testing.T) {
+	type testCase struct {
+		name    string
+		content string
+		rates   map[string]*big.Rat
+		err     string
+	}
+	tcs := []testCase{
+		{
+			name:    "rates.json",
+			content: `{"USD": 1, "EUR": 0.92, "JPY": "150"}`,
+			rates:   map[string]*big.Rat{"USD": big.NewRat(1, 1), "EUR": big.NewRat(92, 100), "JPY": big.NewRat(150, 1)},
+		}, {
+			name:    "rates.csv",
+			content: "currency,rate\nUSD,1\nEUR, 0.92\n",
+			rates:   map[string]*big.Rat{"USD": big.NewRat(1, 1), "EUR": big.NewRat(92, 100)},
+		}, {
+			name:    "RATES.CSV",
+			content: "USD,1\nEUR,1/2\n",
+			rates:   map[string]*big.Rat{"USD": big.NewRat(1, 1), "EUR": big.NewRat(1, 2)},
+		}, {
+			name:    "bad.csv",
+			content: "USD,1\nEUR,lots\n",
+			err:     "line 2: invalid rate",
+		}, {
+			name:    "bad.json",
+			content: `["USD"]`,
+			err:     "bad.json",
+		},
+	}
+	dir := t.TempDir()
+	for _, tc := range tcs {
+		path := filepath.Join(dir, tc.name)
+		if err := os.WriteFile(path, []byte(tc.content), 0o644); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		rates, err := RatesFile{Path: path}.Rates()
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("%s: expected an error containing %q, got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if len(rates) != len(tc.rates) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.rates, rates)
+		}
+		for code, want := range tc.rates {
+			if got := rates[code]; got == nil || got.Cmp(want) != 0 {
+				t.Fatalf("%s: expected %s at %v, got %v", tc.name, code, want, got)
+			}
+		}
+	}
+	if _, err := (RatesFile{Path: filepath.Join(dir, "missing.json")}).Rates(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a missing file to fail with %v, got %v", os.ErrNotExist, err)
+	}
+}
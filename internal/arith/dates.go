@@ -0,0 +1,356 @@
+package arith
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// A DateLiteral is a date or an instant written in ISO 8601, as in
+// "2024-03-15", "2024-03-15T09:30" or "2024-03-15T09:30:00+01:00".
+type DateLiteral struct {
+	// Time holds the fields of the literal. Without a time zone they are
+	// held in UTC and read in the Evaluator's Location.
+	time.Time
+	// Zoned is whether the literal gave a time zone, Z or an offset.
+	Zoned bool
+}
+
+// dateLayouts are the forms of ISO 8601 dates the lexer reads, and
+// whether each gives a time zone. Fractional seconds are accepted after
+// the seconds of any layout.
+var dateLayouts = []struct {
+	layout string
+	zoned  bool
+}{
+	{"2006-01-02T15:04:05Z07:00", true},
+	{"2006-01-02T15:04Z07:00", true},
+	{"2006-01-02T15:04:05", false},
+	{"2006-01-02T15:04", false},
+	{"2006-01-02", false},
+}
+
+// ParseDate parses an ISO 8601 date literal such as "2024-03-15" or
+// "2024-03-15T09:30:00Z".
+func ParseDate(s string) (DateLiteral, error) {
+	if n := scanDate([]rune(s)); n == 0 || n != len([]rune(s)) {
+		return DateLiteral{}, fmt.Errorf("invalid date %q", s)
+	}
+	for _, l := range dateLayouts {
+		if t, err := time.Parse(l.layout, s); err == nil {
+			return DateLiteral{Time: t, Zoned: l.zoned}, nil
+		}
+	}
+	return DateLiteral{}, fmt.Errorf("invalid date %q", s)
+}
+
+// String writes d as it was written, leaving out a zero time of day.
+func (d DateLiteral) String() string {
+	switch {
+	case d.Zoned:
+		return d.Format(time.RFC3339Nano)
+	case d.Hour() == 0 && d.Minute() == 0 && d.Second() == 0 && d.Nanosecond() == 0:
+		return d.Format("2006-01-02")
+	}
+	return d.Format("2006-01-02T15:04:05.999999999")
+}
+
+// in returns the instant d refers to when read in loc.
+func (d DateLiteral) in(loc *time.Location) time.Time {
+	if d.Zoned {
+		return d.Time
+	}
+	return time.Date(d.Year(), d.Month(), d.Day(), d.Hour(), d.Minute(), d.Second(), d.Nanosecond(), loc)
+}
+
+// scanDate returns the length of the ISO 8601 date at the start of rs, or
+// zero if rs does not start with one. The date must be a four digit year,
+// two digit month and two digit day, optionally followed by T, a time of
+// at least hours and minutes, and after the time a zone, Z or an offset
+// such as +01:00.
+func scanDate(rs []rune) int {
+	i := 0
+	match := func(pattern string) bool {
+		j := i
+		for _, p := range pattern {
+			if j >= len(rs) {
+				return false
+			}
+			switch {
+			case p == '9' && rs[j] >= '0' && rs[j] <= '9':
+			case p == '±' && (rs[j] == '+' || rs[j] == '-'):
+			case p == rs[j]:
+			default:
+				return false
+			}
+			j++
+		}
+		i = j
+		return true
+	}
+	isDigit := func(i int) bool {
+		return i < len(rs) && rs[i] >= '0' && rs[i] <= '9'
+	}
+	if !match("9999-99-99") || isDigit(i) {
+		return 0
+	}
+	if !match("T99:99") {
+		return i
+	}
+	if match(":99") && match(".9") {
+		for isDigit(i) {
+			i++
+		}
+	}
+	if !match("Z") {
+		match("±99:99")
+	}
+	return i
+}
+
+// A Date is an instant in time, as read from a date literal, in the time
+// zone it was read in.
+type Date struct {
+	time.Time
+}
+
+// String writes d in ISO 8601, as in "2024-03-15" or
+// "2024-03-15T09:30:00Z".
+func (d Date) String() string {
+	return Formatter{}.Format(d)
+}
+
+// isDate reports whether any of vals is a Date.
+func isDate(vals ...Value) bool {
+	for _, v := range vals {
+		if _, ok := v.(Date); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (ev Evaluator) location() *time.Location {
+	if ev.Location == nil {
+		return time.UTC
+	}
+	return ev.Location
+}
+
+// timeDim is the Dimension of durations.
+var timeDim = Dimension{DimTime: 1}
+
+// durationUnits are the units durations are written in, largest first.
+var durationUnits = []struct {
+	name    string
+	seconds int64
+}{
+	{"wk", 604800},
+	{"d", 86400},
+	{"h", 3600},
+	{"min", 60},
+	{"s", 1},
+}
+
+// dateBinary applies an operator where either operand is a Date. Only
+// adding a duration to a date, subtracting one from it and subtracting
+// two dates are defined.
+func (ev Evaluator) dateBinary(op Op, lhs, rhs Value) (Value, error) {
+	l, lok := lhs.(Date)
+	r, rok := rhs.(Date)
+	switch {
+	case op == OpMinus && lok && rok:
+		return dateDifference(l.Time, r.Time), nil
+	case op == OpPlus && lok && !rok:
+		return addDuration(l.Time, rhs, 1)
+	case op == OpPlus && rok && !lok:
+		return addDuration(r.Time, lhs, 1)
+	case op == OpMinus && lok:
+		return addDuration(l.Time, rhs, -1)
+	}
+	return nil, ErrDomain
+}
+
+// addDuration returns t plus sign times the duration d.
+func addDuration(t time.Time, d Value, sign int64) (Value, error) {
+	q := toQuantity(d)
+	seconds := Unit{{Name: "s", Exp: 1, Def: UnitDef{Dim: timeDim, Scale: big.NewRat(1, 1)}}}
+	if q.Unit.Dim() != timeDim {
+		return nil, &DimensionError{LHS: seconds, RHS: q.Unit}
+	}
+	if isComplex(q.Value) {
+		return nil, ErrDomain
+	}
+	secs := new(big.Rat).Mul(toRat(q.Value), q.Unit.Scale())
+	secs.Mul(secs, big.NewRat(sign, 1))
+	whole := floorRat(secs)
+	frac := new(big.Rat).Sub(secs, new(big.Rat).SetInt(whole))
+	nanos := roundRat(frac.Mul(frac, big.NewRat(int64(time.Second), 1)))
+	whole.Add(whole, big.NewInt(t.Unix()))
+	if !whole.IsInt64() {
+		return nil, ErrOverflow
+	}
+	return Date{time.Unix(whole.Int64(), int64(t.Nanosecond())+nanos.Int64()).In(t.Location())}, nil
+}
+
+// dateDifference returns a - b as a duration, in the largest of
+// durationUnits no longer than it, but never in weeks, so a difference of
+// 36 hours is 1.5 d and is written "1d 12h".
+func dateDifference(a, b time.Time) Value {
+	secs := new(big.Rat).SetInt64(a.Unix() - b.Unix())
+	secs.Add(secs, big.NewRat(int64(a.Nanosecond()-b.Nanosecond()), int64(time.Second)))
+	abs := new(big.Rat).Abs(secs)
+	for _, u := range durationUnits[1:] {
+		size := big.NewRat(u.seconds, 1)
+		if abs.Cmp(size) >= 0 || u.seconds == 1 {
+			return Quantity{
+				Value: ratValue(new(big.Rat).Quo(secs, size)),
+				Unit:  Unit{{Name: u.name, Exp: 1, Def: UnitDef{Dim: timeDim, Scale: size}}},
+				Mixed: true,
+			}
+		}
+	}
+	return nil
+}
+
+// durationUnit returns the index in durationUnits of u, if u is one of
+// them.
+func durationUnit(u Unit) (int, bool) {
+	if len(u) != 1 || u[0].Exp != 1 {
+		return 0, false
+	}
+	for i, d := range durationUnits {
+		if u[0].Name == d.name && u[0].Def.Scale.Cmp(big.NewRat(d.seconds, 1)) == 0 {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// duration writes a Mixed q in mixed units, as in "3d 4h" or "-1wk 1d", if
+// it is an exact amount of one of durationUnits: a whole number of that
+// unit and of each smaller one, with any fraction left to the seconds.
+// Zero amounts are left out.
+func (f Formatter) duration(q Quantity) (string, bool) {
+	if !q.Mixed {
+		return "", false
+	}
+	switch q.Value.(type) {
+	case Int, Rat:
+	default:
+		return "", false
+	}
+	start, ok := durationUnit(q.Unit)
+	if !ok {
+		return "", false
+	}
+	secs := new(big.Rat).Mul(toRat(q.Value), big.NewRat(durationUnits[start].seconds, 1))
+	sign := ""
+	if secs.Sign() < 0 {
+		sign = string(OpMinus)
+		secs.Neg(secs)
+	}
+	var parts []string
+	for _, u := range durationUnits[start:] {
+		size := big.NewRat(u.seconds, 1)
+		n := new(big.Rat).Set(secs)
+		if u.seconds != 1 {
+			n.SetInt(floorRat(n.Quo(n, size)))
+		}
+		if n.Sign() != 0 {
+			parts = append(parts, f.Format(ratValue(n))+u.name)
+			secs.Sub(secs, n.Mul(n, size))
+		}
+	}
+	if len(parts) == 0 {
+		return "0" + durationUnits[start].name, true
+	}
+	return sign + strings.Join(parts, " "), true
+}
+
+// dateFunc is date(y, m, d) or date(y, m, d, h, min, s), the date or
+// instant in the Evaluator's Location. Out of range fields carry over as
+// they do for time.Date, so date(2024, 13, 1) is 2025-01-01.
+func dateFunc(ev Evaluator, args []Value) (Value, error) {
+	var fields [6]int
+	for i, arg := range args {
+		if !isReal(arg) {
+			return nil, ErrDomain
+		}
+		r := toRat(arg)
+		if !r.IsInt() || !r.Num().IsInt64() {
+			return nil, ErrDomain
+		}
+		fields[i] = int(r.Num().Int64())
+	}
+	return Date{time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], fields[5], 0, ev.location())}, nil
+}
+
+// nowFunc is now(), the current instant to the second.
+func nowFunc(ev Evaluator, args []Value) (Value, error) {
+	return Date{time.Now().In(ev.location()).Truncate(time.Second)}, nil
+}
+
+// workdaysFunc is workdays(a, b), the number of weekdays from the day of a
+// up to but not including the day of b, counted in the time zone of a. It
+// is negative if b is before a.
+func workdaysFunc(ev Evaluator, args []Value) (Value, error) {
+	a, aok := args[0].(Date)
+	b, bok := args[1].(Date)
+	if !aok || !bok {
+		return nil, ErrDomain
+	}
+	from, to := civilDay(a.Time, a.Location()), civilDay(b.Time, a.Location())
+	sign := int64(1)
+	if to.Before(from) {
+		from, to, sign = to, from, -1
+	}
+	// from and to are midnights in UTC, and time.Duration overflows after
+	// 292 years
+	days := (to.Unix() - from.Unix()) / 86400
+	count := days / 7 * 5
+	for d := from.AddDate(0, 0, int(days/7*7)); d.Before(to); d = d.AddDate(0, 0, 1) {
+		if isWeekday(d) {
+			count++
+		}
+	}
+	return Int{big.NewInt(sign * count)}, nil
+}
+
+// workdayFunc is workday(d, n), the date n weekdays after d, or before it
+// if n is negative, keeping the time of day of d.
+func workdayFunc(ev Evaluator, args []Value) (Value, error) {
+	d, ok := args[0].(Date)
+	if !ok || !isReal(args[1]) {
+		return nil, ErrDomain
+	}
+	r := toRat(args[1])
+	if !r.IsInt() || r.Num().CmpAbs(big.NewInt(maxRangeTerms)) > 0 {
+		return nil, ErrDomain
+	}
+	n := int(r.Num().Int64())
+	step := 1
+	if n < 0 {
+		n, step = -n, -1
+	}
+	t := d.Time
+	for n > 0 {
+		t = t.AddDate(0, 0, step)
+		if isWeekday(t) {
+			n--
+		}
+	}
+	return Date{t}, nil
+}
+
+// civilDay returns midnight UTC of the calendar day t falls on in loc, so
+// days can be counted without daylight saving shifts.
+func civilDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func isWeekday(t time.Time) bool {
+	return t.Weekday() != time.Saturday && t.Weekday() != time.Sunday
+}
@@ -0,0 +1,170 @@
+package arith
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDates(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+		err error
+	}
+	tcs := []testCase{
+		{in: "2024-03-15", out: "2024-03-15"},
+		{in: "2024-03-15 + 3d 4h", out: "2024-03-18T04:00:00Z"},
+		{in: "3 d + 2024-03-15", out: "2024-03-18"},
+		{in: "2024-03-15 - 1 wk", out: "2024-03-08"},
+		{in: "2024-03-15T09:30 + 90 min", out: "2024-03-15T11:00:00Z"},
+		{in: "2024-03-15T09:30:00+01:00 + 0 s", out: "2024-03-15T09:30:00+01:00"},
+		{in: "2024-03-01 - 2024-02-01", out: "29d"},
+		{in: "2024-03-01T12:00 - 2024-03-01", out: "12h"},
+		{in: "2024-03-01T00:01:30 - 2024-03-01", out: "1min 30s"},
+		{in: "2024-02-01 - 2024-03-01", out: "-29d"},
+		{in: "2024-03-01T12:00Z - 2024-03-01T12:00+02:00", out: "2h"},
+		{in: "(2024-12-25 - 2024-12-01) to h", out: "576 h"},
+		{in: "2024-03-15 + 0.5 s", out: "2024-03-15T00:00:00.5Z"},
+		{in: "2024-03-15T00:00:00.25 - 2024-03-15", out: "0.25s"},
+		{in: "2024-03-02T12:00 - 2024-03-01", out: "1d 12h"},
+		{in: "date(2024, 3, 15)", out: "2024-03-15"},
+		{in: "date(2024, 13, 1)", out: "2025-01-01"},
+		{in: "date(2024, 3, 15, 9, 30, 0)", out: "2024-03-15T09:30:00Z"},
+		{in: "workdays(2024-03-11, 2024-03-18)", out: "5"},
+		{in: "workdays(2024-03-15, 2024-03-18)", out: "1"},
+		{in: "workdays(2024-03-16, 2024-03-18)", out: "0"},
+		{in: "workdays(2024-01-01, 2025-01-01)", out: "262"},
+		{in: "workdays(2024-03-18, 2024-03-11)", out: "-5"},
+		{in: "workdays(1700-01-01, 2024-01-01)", out: "84526"},
+		{in: "workdays(2024-01-01, 1700-01-01)", out: "-84526"},
+		{in: "workday(2024-03-15, 1)", out: "2024-03-18"},
+		{in: "workday(2024-03-15, 10)", out: "2024-03-29"},
+		{in: "workday(2024-03-18, -1)", out: "2024-03-15"},
+		{in: "workday(2024-03-16, 0)", out: "2024-03-16"},
+		{in: "2024-03-15 + 2024-03-15", err: ErrDomain},
+		{in: "1 d - 2024-03-15", err: ErrDomain},
+		{in: "2 * 2024-03-15", err: ErrDomain},
+		{in: "-2024-03-15", err: ErrDomain},
+		{in: "floor(2024-03-15)", err: ErrDomain},
+		{in: "date(2024, 3, 1.5)", err: ErrDomain},
+		{in: "workday(2024-03-15, 1.5)", err: ErrDomain},
+		{in: "2024-03-15 + 1", err: &DimensionError{}},
+		{in: "2024-03-15 + 3 m", err: &DimensionError{}},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := Parser{Units: DefaultUnits}.ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			v, err := EvalChecked(tree)
+			if tc.err != nil {
+				var derr *DimensionError
+				if errors.As(tc.err, &derr) {
+					if !errors.As(err, &derr) {
+						t.Fatalf("expected a DimensionError, got %v", err)
+					}
+				} else if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := v.String(); got != tc.out {
+				t.Fatalf("expected %v, got %v", tc.out, got)
+			}
+		})
+	}
+}
+
+func TestDateLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	ev := Evaluator{Location: loc}
+	eval := func(in string) Value {
+		tree, err := Parser{Units: DefaultUnits}.ParseString(in)
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", in, err)
+		}
+		v, err := ev.Eval(tree)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", in, err)
+		}
+		return v
+	}
+	// literals without a zone are read in the Evaluator's Location
+	v := eval("2024-03-15")
+	if got := v.String(); got != "2024-03-15" {
+		t.Fatalf("expected 2024-03-15, got %v", got)
+	}
+	if got := (Formatter{Location: time.UTC}).Format(v); got != "2024-03-14T22:00:00Z" {
+		t.Fatalf("expected 2024-03-14T22:00:00Z, got %v", got)
+	}
+	v = eval("2024-03-15T12:00Z")
+	if got := (Formatter{Location: loc}).Format(v); got != "2024-03-15T14:00:00+02:00" {
+		t.Fatalf("expected 2024-03-15T14:00:00+02:00, got %v", got)
+	}
+	if got := eval("2024-03-15T12:00Z - 2024-03-15T12:00").String(); got != "2h" {
+		t.Fatalf("expected 2h, got %v", got)
+	}
+	if _, ok := eval("now()").(Date); !ok {
+		t.Fatalf("expected now() to be a Date")
+	}
+}
+
+func TestLexDates(t *testing.T) {
+	type testCase struct {
+		in     string
+		tokens int
+		pretty string
+	}
+	tcs := []testCase{
+		{in: "2024-03-15", tokens: 1, pretty: "2024-03-15"},
+		{in: "2024-03-15T09:30", tokens: 1, pretty: "2024-03-15T09:30:00"},
+		{in: "2024-03-15T09:30:05.5Z", tokens: 1, pretty: "2024-03-15T09:30:05.5Z"},
+		{in: "2024-03-15T09:30-05:00", tokens: 1, pretty: "2024-03-15T09:30:00-05:00"},
+		{in: "2024-03-15-1", tokens: 3, pretty: "2024-03-15 - 1"},
+		{in: "2024-3-15", tokens: 5, pretty: "2024 - 3 - 15"},
+		{in: "20240-03-15", tokens: 5, pretty: "20240 - 3 - 15"},
+	}
+	for _, tc := range tcs {
+		lexemes, err := Lex(tc.in)
+		if err != nil {
+			t.Fatalf("%s: lex failed: %v", tc.in, err)
+		}
+		tks, _ := Tokens(lexemes)
+		if len(tks) != tc.tokens {
+			t.Fatalf("%s: expected %d tokens, got %d", tc.in, tc.tokens, len(tks))
+		}
+		tree, err := Parse(tks)
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", tc.in, err)
+		}
+		if got := Pretty(tree); got != tc.pretty {
+			t.Fatalf("%s: expected %q, got %q", tc.in, tc.pretty, got)
+		}
+	}
+	if _, err := Lex("2024-13-45"); err == nil {
+		t.Fatalf("expected an invalid date to fail")
+	}
+}
+
+func TestParseCompoundQuantity(t *testing.T) {
+	tree, err := Parser{Units: DefaultUnits}.ParseString("2 * 3d 4h to h")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got := Pretty(tree); got != "2 * (3 d + 4 h) to h" {
+		t.Fatalf("expected 2 * (3 d + 4 h) to h, got %q", got)
+	}
+	v, err := EvalChecked(tree)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := v.String(); got != "152 h" {
+		t.Fatalf("expected 152 h, got %v", got)
+	}
+}
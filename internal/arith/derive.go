@@ -0,0 +1,266 @@
+package arith
+
+import (
+	"math/big"
+)
+
+// Derive differentiates a tree with respect to a variable, panicking if
+// the tree cannot be differentiated. Use DeriveChecked to handle bad
+// input gracefully.
+func Derive(n Node, variable string) Node {
+	d, err := DeriveChecked(n, variable)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// DeriveChecked differentiates a tree with respect to a variable and
+// simplifies the result, so "x^2 + 3x" becomes "2 * x + 3". Subtrees
+// that do not depend on the variable, including other variables, are
+// constant. A subtree that depends on the variable but has no derivative
+// everywhere, such as a call to floor or a user defined function, is
+// reported as an *EvalError wrapping ErrNotDifferentiable. Assignments
+// and definitions are differentiated on their right side, so "y = x^2"
+// becomes "y = 2 * x" and "f(x) = x^2" becomes "f(x) = 2 * x".
+//
+// Trigonometric functions are differentiated as if the Evaluator's Angle
+// were Radians.
+func DeriveChecked(n Node, variable string) (Node, error) {
+	d, err := derive(n, variable)
+	if err != nil {
+		return nil, err
+	}
+	return Simplify(d), nil
+}
+
+func derive(n Node, x string) (Node, error) {
+	switch v := n.(type) {
+	case AssignNode:
+		dv, err := derive(v.Value, x)
+		if err != nil {
+			return nil, err
+		}
+		return AssignNode{Name: v.Name, Value: dv}, nil
+	case FunctionDefNode:
+		db, err := derive(v.Body, x)
+		if err != nil {
+			return nil, err
+		}
+		return FunctionDefNode{Name: v.Name, Params: v.Params, Body: db}, nil
+	}
+	if !dependsOn(n, x) {
+		return number(0), nil
+	}
+	switch v := n.(type) {
+	case VariableNode:
+		return number(1), nil
+	case ParenWrappedNode:
+		return derive(v.Inner, x)
+	case BinaryOpNode:
+		if pct, ok := isPercent(v.RHS); ok && (v.Op == OpPlus || v.Op == OpMinus) {
+			// "x + 10%" is x + x*10%
+			return derive(BinaryOpNode{
+				LHS: v.LHS,
+				RHS: BinaryOpNode{LHS: v.LHS, RHS: ParenWrappedNode{Inner: pct}, Op: OpMultiply},
+				Op:  v.Op,
+			}, x)
+		}
+		return deriveBinary(v, x)
+	case UnaryOpNode:
+		du, err := derive(v.Inner, x)
+		if err != nil {
+			return nil, err
+		}
+		switch v.Op {
+		case OpMinus:
+			return UnaryOpNode{Inner: du, Op: OpMinus}, nil
+		case OpSquareRoot:
+			return quo(du, mul(number(2), n)), nil
+		}
+	case PostfixOpNode:
+		if v.Op == OpModulo {
+			du, err := derive(v.Inner, x)
+			if err != nil {
+				return nil, err
+			}
+			return quo(du, number(100)), nil
+		}
+	case CallNode:
+		return deriveCall(v, x)
+	case ListNode:
+		// lists are differentiated element by element
+		elems := make([]Node, len(v.Elems))
+		for i, e := range v.Elems {
+			de, err := derive(e, x)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = de
+		}
+		return ListNode{Elems: elems}, nil
+	case RangeOpNode:
+		if v.Op != OpProduct && !dependsOn(v.From, x) && !dependsOn(v.To, x) {
+			// sums and integrals over fixed bounds are linear in their body
+			db, err := derive(v.Body, x)
+			if err != nil {
+				return nil, err
+			}
+			return RangeOpNode{Op: v.Op, Body: db, Var: v.Var, From: v.From, To: v.To}, nil
+		}
+	}
+	return nil, &EvalError{Err: ErrNotDifferentiable, Node: n}
+}
+
+func deriveBinary(n BinaryOpNode, x string) (Node, error) {
+	u, w := n.LHS, n.RHS
+	du, err := derive(u, x)
+	if err != nil {
+		return nil, err
+	}
+	dw, err := derive(w, x)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case OpPlus, OpMinus:
+		return BinaryOpNode{LHS: du, RHS: dw, Op: n.Op}, nil
+	case OpMultiply:
+		return add(mul(du, w), mul(u, dw)), nil
+	case OpMatMul:
+		// the product rule, keeping the order of the factors
+		return add(matMul(du, w), matMul(u, dw)), nil
+	case OpDivide:
+		return quo(sub(mul(du, w), mul(u, dw)), pow(w, number(2))), nil
+	case OpPower:
+		switch {
+		case !dependsOn(w, x):
+			// the power rule
+			return mul(mul(w, pow(u, sub(w, number(1)))), du), nil
+		case !dependsOn(u, x):
+			return mul(mul(n, ln(u)), dw), nil
+		default:
+			// u^w is exp(w*ln(u))
+			return mul(n, add(mul(dw, ln(u)), quo(mul(w, du), u))), nil
+		}
+	}
+	return nil, &EvalError{Err: ErrNotDifferentiable, Node: n}
+}
+
+// derivatives are the derivatives of functions of one argument, in terms
+// of that argument.
+var derivatives = map[string]func(u Node) Node{
+	"sin":   func(u Node) Node { return call("cos", u) },
+	"cos":   func(u Node) Node { return UnaryOpNode{Inner: call("sin", u), Op: OpMinus} },
+	"tan":   func(u Node) Node { return quo(number(1), pow(call("cos", u), number(2))) },
+	"asin":  func(u Node) Node { return quo(number(1), sqrt(sub(number(1), pow(u, number(2))))) },
+	"acos":  func(u Node) Node { return quo(number(-1), sqrt(sub(number(1), pow(u, number(2))))) },
+	"atan":  func(u Node) Node { return quo(number(1), add(number(1), pow(u, number(2)))) },
+	"sinh":  func(u Node) Node { return call("cosh", u) },
+	"cosh":  func(u Node) Node { return call("sinh", u) },
+	"tanh":  func(u Node) Node { return quo(number(1), pow(call("cosh", u), number(2))) },
+	"asinh": func(u Node) Node { return quo(number(1), sqrt(add(pow(u, number(2)), number(1)))) },
+	"acosh": func(u Node) Node { return quo(number(1), sqrt(sub(pow(u, number(2)), number(1)))) },
+	"atanh": func(u Node) Node { return quo(number(1), sub(number(1), pow(u, number(2)))) },
+	"exp":   func(u Node) Node { return call("exp", u) },
+	"ln":    func(u Node) Node { return quo(number(1), u) },
+	"log":   func(u Node) Node { return quo(number(1), mul(u, ln(number(10)))) },
+	"log2":  func(u Node) Node { return quo(number(1), mul(u, ln(number(2)))) },
+	"sqrt":  func(u Node) Node { return quo(number(1), mul(number(2), sqrt(u))) },
+	"abs":   func(u Node) Node { return quo(u, call("abs", u)) },
+}
+
+// deriveCall applies the chain rule to a call of a built in function.
+func deriveCall(n CallNode, x string) (Node, error) {
+	switch {
+	case n.Name == "log" && len(n.Args) == 2:
+		return derive(quo(ln(n.Args[0]), ln(n.Args[1])), x)
+	case n.Name == "pow" && len(n.Args) == 2:
+		return derive(pow(n.Args[0], n.Args[1]), x)
+	}
+	rule, ok := derivatives[n.Name]
+	if !ok || len(n.Args) != 1 {
+		return nil, &EvalError{Err: ErrNotDifferentiable, Node: n}
+	}
+	du, err := derive(n.Args[0], x)
+	if err != nil {
+		return nil, err
+	}
+	return mul(rule(n.Args[0]), du), nil
+}
+
+// dependsOn reports whether n refers to the variable x.
+func dependsOn(n Node, x string) bool {
+	switch v := n.(type) {
+	case VariableNode:
+		return v.Name == x
+	case ParenWrappedNode:
+		return dependsOn(v.Inner, x)
+	case BinaryOpNode:
+		return dependsOn(v.LHS, x) || dependsOn(v.RHS, x)
+	case UnaryOpNode:
+		return dependsOn(v.Inner, x)
+	case PostfixOpNode:
+		return dependsOn(v.Inner, x)
+	case CallNode:
+		for _, arg := range v.Args {
+			if dependsOn(arg, x) {
+				return true
+			}
+		}
+	case ListNode:
+		for _, e := range v.Elems {
+			if dependsOn(e, x) {
+				return true
+			}
+		}
+	case AssignNode:
+		return dependsOn(v.Value, x)
+	case FunctionDefNode:
+		return dependsOn(v.Body, x)
+	case EquationNode:
+		return dependsOn(v.LHS, x) || dependsOn(v.RHS, x)
+	case RangeOpNode:
+		return dependsOn(v.From, x) || dependsOn(v.To, x) || (v.Var != x && dependsOn(v.Body, x))
+	case ConvertNode:
+		return dependsOn(v.Value, x) || dependsOn(v.Unit, x)
+	}
+	return false
+}
+
+// The builders below parenthesize every operand, leaving Simplify to drop
+// the parentheses that are not needed.
+
+func number(i int64) Node {
+	return NumberNode{big.NewRat(i, 1)}
+}
+
+func call(name string, args ...Node) Node {
+	return CallNode{Name: name, Args: args}
+}
+
+func ln(u Node) Node {
+	if c, ok := u.(ConstantNode); ok && c.Name == "e" {
+		return number(1)
+	}
+	return call("ln", u)
+}
+
+func sqrt(u Node) Node {
+	return UnaryOpNode{Inner: ParenWrappedNode{Inner: u}, Op: OpSquareRoot}
+}
+
+func binaryOf(op Op) func(u, w Node) Node {
+	return func(u, w Node) Node {
+		return BinaryOpNode{LHS: ParenWrappedNode{Inner: u}, RHS: ParenWrappedNode{Inner: w}, Op: op}
+	}
+}
+
+var (
+	add    = binaryOf(OpPlus)
+	sub    = binaryOf(OpMinus)
+	mul    = binaryOf(OpMultiply)
+	quo    = binaryOf(OpDivide)
+	pow    = binaryOf(OpPower)
+	matMul = binaryOf(OpMatMul)
+)
@@ -0,0 +1,113 @@
+package arith
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestDerive(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+	}
+	tcs := []testCase{
+		{in: "5", out: "0"},
+		{in: "y", out: "0"},
+		{in: "x", out: "1"},
+		{in: "x^2 + 3x", out: "2 * x + 3"},
+		{in: "y*x", out: "y"},
+		{in: "x*x*x", out: "3 * x ^ 2"},
+		{in: "1/x", out: "-1 / x ^ 2"},
+		{in: "x/(x+1)", out: "1 / (x + 1) ^ 2"},
+		{in: "(x+1)^3", out: "3 * (x + 1) ^ 2"},
+		{in: "2^x", out: "2 ^ x * ln(2)"},
+		{in: "e^x", out: "e ^ x"},
+		{in: "x^x", out: "(ln(x) + 1) * x ^ x"},
+		{in: "√x", out: "1 / (2 * √x)"},
+		{in: "π*x", out: "π"},
+		{in: "x%", out: "0.01"},
+		{in: "x + 10%", out: "1.1"},
+		{in: "sin(x)", out: "cos(x)"},
+		{in: "cos(2x)", out: "-2 * sin(2 * x)"},
+		{in: "tan(x)", out: "1 / cos(x) ^ 2"},
+		{in: "asin(x)", out: "1 / √(-x ^ 2 + 1)"},
+		{in: "atan(x)", out: "1 / (x ^ 2 + 1)"},
+		{in: "exp(x^2)", out: "2 * exp(x ^ 2) * x"},
+		{in: "ln(x)", out: "1 / x"},
+		{in: "log(x)", out: "1 / (ln(10) * x)"},
+		{in: "log(x, 2)", out: "1 / (ln(2) * x)"},
+		{in: "sqrt(x^2 + 1)", out: "x / √(x ^ 2 + 1)"},
+		{in: "abs(x)", out: "x / abs(x)"},
+		{in: "pow(x, 3)", out: "3 * x ^ 2"},
+		{in: "floor(y) + 3!", out: "0"},
+		{in: "Σ(x^k, k, 1, 3)", out: "Σ(k * x ^ (k - 1), k, 1, 3)"},
+		{in: "∫(x*t, t, 0, 1)", out: "∫(t, t, 0, 1)"},
+		{in: "∫(x, x, 0, 1)", out: "0"},
+		{in: "[x, x^2]", out: "[1, 2 * x]"},
+		{in: "y = x^2", out: "y = 2 * x"},
+		{in: "y = 3", out: "y = 0"},
+		{in: "f(x) = x^2", out: "f(x) = 2 * x"},
+		{in: "f(t) = t*x", out: "f(t) = t"},
+		{in: "[[x, 1], [0, x]] @ [x, 2]", out: "[[1, 0], [0, 1]] @ [x, 2] + [[x, 1], [0, x]] @ [1, 0]"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			d, err := DeriveChecked(tree, "x")
+			if err != nil {
+				t.Fatalf("derive failed: %v", err)
+			}
+			if got := Pretty(d); got != tc.out {
+				t.Fatalf("expected %q, got %q", tc.out, got)
+			}
+		})
+	}
+}
+
+// TestDeriveSlope checks derivatives against the slope of a secant
+// through points either side of x.
+func TestDeriveSlope(t *testing.T) {
+	ins := []string{
+		"x^3 - 2x", "x/(x^2+1)", "sin(x)*cos(x)", "tan(x^2)", "exp(-x)/x",
+		"ln(x^2 + 1)", "log(x, 3)", "x^x", "√(x + 1)", "acos(x/2)",
+		"sinh(x) - cosh(x)", "tanh(x)", "asinh(x)", "acosh(x + 1)", "atanh(x/2)",
+	}
+	at := func(tree Node, x float64) float64 {
+		env := NewEnvironment()
+		env.Set("x", Float{big.NewFloat(x)})
+		v, err := Evaluator{Env: env}.Eval(tree)
+		if err != nil {
+			t.Fatalf("evaluating %s failed: %v", Pretty(tree), err)
+		}
+		return toFloat64(v)
+	}
+	const x, h = 0.7, 1e-6
+	for _, in := range ins {
+		tree, err := ParseString(in)
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		d := Derive(tree, "x")
+		slope := (at(tree, x+h) - at(tree, x-h)) / (2 * h)
+		if got := at(d, x); got-slope > 1e-6 || slope-got > 1e-6 {
+			t.Fatalf("%s: derivative %s is %v at %v, but the slope is %v", in, Pretty(d), got, x, slope)
+		}
+	}
+}
+
+func TestDeriveErrors(t *testing.T) {
+	for _, in := range []string{"floor(x)", "x!", "x % 2", "max(x, 1)", "f(x) = floor(x)", "y = x!", "Π(x, k, 1, 3)", "∫(t, t, 0, x)"} {
+		tree, err := Parser{Functions: DefaultFunctions.Clone()}.ParseString(in)
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		if _, err := DeriveChecked(tree, "x"); !errors.Is(err, ErrNotDifferentiable) {
+			t.Fatalf("%s: expected %v, got %v", in, ErrNotDifferentiable, err)
+		}
+	}
+}
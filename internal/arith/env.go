@@ -0,0 +1,62 @@
+package arith
+
+import (
+	"sort"
+	"sync"
+)
+
+// An Environment holds the variables an Evaluator reads and assigns. The
+// zero Environment is empty and ready to use, and an Environment is safe
+// for concurrent use.
+type Environment struct {
+	mu   sync.RWMutex
+	vars map[string]Value
+	// parent is the enclosing scope of a user defined function's
+	// parameters. Names not bound here are looked up in it.
+	parent *Environment
+}
+
+// NewEnvironment returns an empty Environment.
+func NewEnvironment() *Environment {
+	return &Environment{}
+}
+
+// Get returns the value bound to name.
+func (e *Environment) Get(name string) (Value, bool) {
+	e.mu.RLock()
+	v, ok := e.vars[name]
+	e.mu.RUnlock()
+	if !ok && e.parent != nil {
+		return e.parent.Get(name)
+	}
+	return v, ok
+}
+
+// Set binds name to v, replacing any existing binding.
+func (e *Environment) Set(name string, v Value) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.vars == nil {
+		e.vars = make(map[string]Value)
+	}
+	e.vars[name] = v
+}
+
+// Delete removes the binding for name, if there is one.
+func (e *Environment) Delete(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.vars, name)
+}
+
+// Names returns the bound names in sorted order.
+func (e *Environment) Names() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, 0, len(e.vars))
+	for name := range e.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,214 @@
+package arith
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseErrorKind classifies a ParseError.
+type ParseErrorKind uint8
+
+const (
+	// UnexpectedToken is reported when a token appears somewhere the
+	// grammar does not allow it, e.g. the second * in "1 * * 2".
+	UnexpectedToken ParseErrorKind = iota
+	// UnbalancedParen is reported for a ( without a matching ) or a )
+	// without a matching (.
+	UnbalancedParen
+	// TrailingOperator is reported when input ends right after an
+	// operator, e.g. "1 +".
+	TrailingOperator
+	// UnknownCharacter is reported by ParseString for a character that
+	// does not begin any token.
+	UnknownCharacter
+	// UnexpectedEnd is reported when there is no input to parse.
+	UnexpectedEnd
+	// UnknownFunction is reported for a call to a name the parser's
+	// FunctionRegistry does not hold, e.g. "nope(1)".
+	UnknownFunction
+	// AssignToConstant is reported for an assignment to the name of a
+	// constant, e.g. "pi = 3", or a range over one, e.g. "Σ(e, e, 1, 3)".
+	AssignToConstant
+	// UnbalancedBracket is reported for a [ without a matching ] or a ]
+	// without a matching [.
+	UnbalancedBracket
+	// AssignToUnit is reported for an assignment to the name of a unit
+	// the parser reads, e.g. "m = 5", or a range over one, as every later
+	// reading of the name would be the unit.
+	AssignToUnit
+)
+
+func (k ParseErrorKind) String() string {
+	switch k {
+	case UnexpectedToken:
+		return "unexpected token"
+	case UnbalancedParen:
+		return "unbalanced parenthesis"
+	case TrailingOperator:
+		return "trailing operator"
+	case UnknownCharacter:
+		return "unknown character"
+	case UnexpectedEnd:
+		return "unexpected end of input"
+	case UnknownFunction:
+		return "unknown function"
+	case AssignToConstant:
+		return "assignment to constant"
+	case UnbalancedBracket:
+		return "unbalanced bracket"
+	case AssignToUnit:
+		return "assignment to unit"
+	default:
+		return "ParseErrorKind(" + strconv.Itoa(int(k)) + ")"
+	}
+}
+
+// Expected is the set of tokens the parser would have accepted where a
+// ParseError occurred.
+type Expected struct {
+	Number     bool
+	Identifier bool
+	Ops        []Op
+	End        bool
+}
+
+func (e Expected) withOps(ops ...Op) Expected {
+	e.Ops = append(e.Ops[:len(e.Ops):len(e.Ops)], ops...)
+	return e
+}
+
+func (e Expected) String() string {
+	var alts []string
+	if e.Number {
+		alts = append(alts, "number")
+	}
+	if e.Identifier {
+		alts = append(alts, "identifier")
+	}
+	for _, op := range e.Ops {
+		alts = append(alts, strconv.Quote(string(op)))
+	}
+	if e.End {
+		alts = append(alts, "end of input")
+	}
+	return strings.Join(alts, ", ")
+}
+
+// A ParseError describes where and why Parse or ParseString rejected its
+// input.
+type ParseError struct {
+	Kind ParseErrorKind
+	// Index is the index of the offending token. At the end of input it
+	// is the number of tokens.
+	Index int
+	// Offset is the rune offset of the offending character in the source
+	// string. It is -1 for errors from Parse, which has no source string.
+	Offset int
+	// Token is the offending token. It is nil at the end of input and for
+	// UnknownCharacter errors.
+	Token *Token
+	// Char is the offending character of an UnknownCharacter error.
+	Char     rune
+	Expected Expected
+}
+
+func (e *ParseError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.Kind.String())
+	switch {
+	case e.Kind == UnknownCharacter:
+		sb.WriteString(" " + strconv.QuoteRune(e.Char))
+	case e.Token != nil:
+		sb.WriteString(" " + strconv.Quote(e.Token.String()))
+	}
+	if e.Offset >= 0 {
+		sb.WriteString(" at offset " + strconv.Itoa(e.Offset))
+	} else {
+		sb.WriteString(" at token " + strconv.Itoa(e.Index))
+	}
+	if expected := e.Expected.String(); expected != "" {
+		sb.WriteString(" (expected " + expected + ")")
+	}
+	return sb.String()
+}
+
+// Unwrap returns io.EOF for UnexpectedEnd errors, so callers checking for
+// empty input with errors.Is keep working.
+func (e *ParseError) Unwrap() error {
+	if e.Kind == UnexpectedEnd {
+		return io.EOF
+	}
+	return nil
+}
+
+// Errors reported by EvalChecked, wrapped in an *EvalError.
+var (
+	ErrDivideByZero = errors.New("division by zero")
+	ErrOverflow     = errors.New("overflow")
+	ErrDomain       = errors.New("domain error")
+	ErrUndefined    = errors.New("undefined variable")
+	ErrUnknownConst = errors.New("unknown constant")
+	ErrUnknownFunc  = errors.New("unknown function")
+	ErrUnknownUnit  = errors.New("unknown unit")
+	ErrArity        = errors.New("wrong number of arguments")
+	ErrRecursion    = errors.New("recursion too deep")
+	ErrEquation     = errors.New("equation must be solved")
+	ErrLength       = errors.New("lists of different lengths")
+	ErrBuiltin      = errors.New("cannot redefine a built-in function")
+	ErrSingular     = errors.New("singular matrix")
+	ErrNoConverge   = errors.New("did not converge")
+)
+
+// Errors reported by DeriveChecked and Solver.Solve, wrapped in an
+// *EvalError.
+var (
+	ErrNotDifferentiable = errors.New("not differentiable")
+	ErrNoUnknown         = errors.New("nothing to solve for")
+	ErrIdentity          = errors.New("equation holds everywhere")
+)
+
+// An EvalError describes why a subtree could not be evaluated,
+// differentiated or solved.
+type EvalError struct {
+	// Err is one of the Err variables of this package, a *DimensionError,
+	// a *ShapeError, or an error returned by a registered Func.
+	Err error
+	// Node is the subtree whose evaluation failed.
+	Node Node
+}
+
+func (e *EvalError) Error() string {
+	return e.Err.Error() + " in " + Pretty(e.Node)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// A DimensionError reports arithmetic on or a conversion between
+// quantities of different dimensions, as in "3 kg + 2 s", or a power
+// whose exponent has a unit. It is reported as the Err of an *EvalError.
+type DimensionError struct {
+	LHS, RHS Unit
+}
+
+func (e *DimensionError) Error() string {
+	return "incompatible units " + e.LHS.String() + " and " + e.RHS.String()
+}
+
+// A ShapeError reports a matrix operation on values whose shapes do not
+// fit it, as in "[[1, 2]] @ [[1, 2]]" or the determinant of a matrix that
+// is not square. RHS is nil for operations on one value. It is reported
+// as the Err of an *EvalError.
+type ShapeError struct {
+	LHS, RHS Shape
+}
+
+func (e *ShapeError) Error() string {
+	if e.RHS == nil {
+		return "wrong shape " + e.LHS.String()
+	}
+	return "incompatible shapes " + e.LHS.String() + " and " + e.RHS.String()
+}
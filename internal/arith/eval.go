@@ -0,0 +1,572 @@
+package arith
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"time"
+)
+
+// Backend selects the numeric representation an Evaluator computes with.
+type Backend uint8
+
+const (
+	// BackendRational computes exactly: integers stay integers, division
+	// produces fractions, and only irrational results such as √2 fall back
+	// to Floats.
+	BackendRational Backend = iota
+	// BackendInteger computes with integers only. Division truncates
+	// toward zero, square roots round down, and fractional literals are
+	// rejected with ErrDomain.
+	BackendInteger
+	// BackendFloat computes everything as Floats.
+	BackendFloat
+)
+
+// DefaultPrecision is the Float precision, in bits, used when an Evaluator
+// does not specify one.
+const DefaultPrecision = 64
+
+// An Evaluator computes the Value of syntax trees. The zero Evaluator is
+// ready to use and computes exactly with BackendRational.
+type Evaluator struct {
+	Backend Backend
+	// Precision is the mantissa precision, in bits, of Float values such as
+	// irrational square roots. Zero means DefaultPrecision.
+	Precision uint
+	// Env holds the variables expressions read and assign. With a nil Env
+	// every variable is undefined and assignments are not remembered.
+	Env *Environment
+	// Angle is the unit of angles passed to and returned from
+	// trigonometric functions.
+	Angle AngleMode
+	// Word, if set, wraps every integer result to a fixed width, as
+	// programmer calculators do. Fractions and Floats are not affected.
+	Word WordSize
+	// Constants holds the values of constants. Nil means
+	// DefaultConstants.
+	Constants *ConstantRegistry
+	// Functions holds the functions calls dispatch to and function
+	// definitions are registered with. Nil means DefaultFunctions, which
+	// definitions are never added to.
+	Functions *FunctionRegistry
+	// Location is the time zone date literals without one, and the date
+	// and now functions, are read in. Nil means UTC.
+	Location *time.Location
+	// Units holds the units UnitNodes refer to. Nil means DefaultUnits.
+	Units *UnitRegistry
+	// Complex gives real arguments outside a real domain complex results,
+	// so "√(-4)" is 2i and "ln(-1)" is πi rather than ErrDomain. Complex
+	// operands, such as the i of ComplexConstants, are accepted either
+	// way.
+	Complex bool
+
+	// depth is the number of user defined function calls being evaluated.
+	depth int
+}
+
+// Eval evaluates a well formed tree, panicking if the tree cannot be
+// evaluated. Use EvalChecked to handle bad input gracefully.
+func Eval(n Node) Value {
+	v, err := EvalChecked(n)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// EvalChecked evaluates a tree with the zero Evaluator. Division by zero
+// and square roots of negative numbers are reported as an *EvalError.
+func EvalChecked(n Node) (Value, error) {
+	return Evaluator{}.Eval(n)
+}
+
+func (ev Evaluator) precision() uint {
+	if ev.Precision == 0 {
+		return DefaultPrecision
+	}
+	return ev.Precision
+}
+
+// floatPrecision is the precision of a Float computed from vals. A result
+// is no more precise than its least precise Float operand; exact operands
+// do not limit it.
+func (ev Evaluator) floatPrecision(vals ...Value) uint {
+	prec := ev.precision()
+	for _, v := range vals {
+		switch v := v.(type) {
+		case Float:
+			if v.Prec() < prec {
+				prec = v.Prec()
+			}
+		case Complex:
+			if v.Re.Prec() < prec {
+				prec = v.Re.Prec()
+			}
+		}
+	}
+	return prec
+}
+
+// Eval evaluates a tree. Division by zero and square roots of negative
+// numbers are reported as an *EvalError.
+func (ev Evaluator) Eval(n Node) (Value, error) {
+	v, err := ev.eval(n)
+	if err != nil {
+		return nil, err
+	}
+	return ev.Word.wrap(v), nil
+}
+
+func (ev Evaluator) eval(n Node) (Value, error) {
+	switch v := n.(type) {
+	case NumberNode:
+		switch ev.Backend {
+		case BackendFloat:
+			return Float{new(big.Float).SetPrec(ev.precision()).SetRat(v.Rat)}, nil
+		case BackendInteger:
+			if !v.IsInt() {
+				return nil, &EvalError{Err: ErrDomain, Node: n}
+			}
+		}
+		return ratValue(new(big.Rat).Set(v.Rat)), nil
+	case BinaryOpNode:
+		lhs, err := ev.Eval(v.LHS)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := ev.Eval(v.RHS)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := isPercent(v.RHS); ok && (v.Op == OpPlus || v.Op == OpMinus) {
+			// "200 + 10%" adds 10% of 200, as on a desk calculator
+			rhs, err = ev.binary(OpMultiply, lhs, rhs)
+			if err != nil {
+				return nil, &EvalError{Err: err, Node: n}
+			}
+		}
+		res, err := ev.binary(v.Op, lhs, rhs)
+		if err != nil {
+			return nil, &EvalError{Err: err, Node: n}
+		}
+		return res, nil
+	case UnaryOpNode:
+		inner, err := ev.Eval(v.Inner)
+		if err != nil {
+			return nil, err
+		}
+		res, err := ev.unary(v.Op, inner)
+		if err != nil {
+			return nil, &EvalError{Err: err, Node: n}
+		}
+		return res, nil
+	case PostfixOpNode:
+		inner, err := ev.Eval(v.Inner)
+		if err != nil {
+			return nil, err
+		}
+		res, err := ev.postfix(v.Op, inner)
+		if err != nil {
+			return nil, &EvalError{Err: err, Node: n}
+		}
+		return res, nil
+	case ParenWrappedNode:
+		return ev.Eval(v.Inner)
+	case VariableNode:
+		if ev.Env != nil {
+			if val, ok := ev.Env.Get(v.Name); ok {
+				return val, nil
+			}
+		}
+		return nil, &EvalError{Err: ErrUndefined, Node: n}
+	case ConstantNode:
+		res, err := ev.constant(v.Name)
+		if err != nil {
+			return nil, &EvalError{Err: err, Node: n}
+		}
+		return res, nil
+	case AssignNode:
+		val, err := ev.Eval(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		if ev.Env != nil {
+			ev.Env.Set(v.Name, val)
+		}
+		return val, nil
+	case CallNode:
+		args := make([]Value, len(v.Args))
+		for i, arg := range v.Args {
+			val, err := ev.Eval(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = plain(val)
+		}
+		res, err := ev.call(v.Name, args)
+		var everr *EvalError
+		if errors.As(err, &everr) {
+			// a user defined function failed within its body
+			return nil, err
+		}
+		if err != nil {
+			return nil, &EvalError{Err: err, Node: n}
+		}
+		return res, nil
+	case FunctionDefNode:
+		f := UserFunc{
+			Name:   v.Name,
+			Params: v.Params,
+			Body:   v.Body,
+		}
+		if ev.Functions != nil {
+			if err := ev.Functions.Define(f); err != nil {
+				return nil, &EvalError{Err: err, Node: n}
+			}
+		}
+		return f, nil
+	case EquationNode:
+		return nil, &EvalError{Err: ErrEquation, Node: n}
+	case RangeOpNode:
+		return ev.rangeOp(v)
+	case ListNode:
+		l := make(List, len(v.Elems))
+		for i, elem := range v.Elems {
+			val, err := ev.Eval(elem)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = plain(val)
+		}
+		return l, nil
+	case DateNode:
+		return Date{v.in(ev.location())}, nil
+	case UnitNode:
+		res, err := ev.unit(v.Name)
+		if err != nil {
+			return nil, &EvalError{Err: err, Node: n}
+		}
+		return res, nil
+	case ConvertNode:
+		val, err := ev.Eval(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		unit, err := ev.Eval(v.Unit)
+		if err != nil {
+			return nil, err
+		}
+		res, err := ev.convert(plain(val), plain(unit))
+		if err != nil {
+			return nil, &EvalError{Err: err, Node: n}
+		}
+		return res, nil
+	default:
+		panic("invalid node")
+	}
+}
+
+// constant computes a constant at the Evaluator's precision. The integer
+// backend rejects constants that are not whole with ErrDomain.
+func (ev Evaluator) constant(name string) (Value, error) {
+	consts := ev.Constants
+	if consts == nil {
+		consts = DefaultConstants
+	}
+	c, ok := consts.Lookup(name)
+	if !ok {
+		return nil, ErrUnknownConst
+	}
+	v := c.Value(ev.precision())
+	switch ev.Backend {
+	case BackendInteger:
+		if _, ok := v.(Int); !ok {
+			return nil, ErrDomain
+		}
+	case BackendFloat:
+		if !isComplex(v) {
+			return Float{toFloat(v, ev.floatPrecision(v))}, nil
+		}
+	}
+	return v, nil
+}
+
+func (ev Evaluator) binary(op Op, lhs, rhs Value) (Value, error) {
+	lhs, rhs = plain(lhs), plain(rhs)
+	if op == OpMatMul {
+		return ev.matMul(lhs, rhs)
+	}
+	if isList(lhs, rhs) {
+		return ev.listBinary(op, lhs, rhs)
+	}
+	if isDate(lhs, rhs) {
+		return ev.dateBinary(op, lhs, rhs)
+	}
+	if isQuantity(lhs, rhs) {
+		return ev.quantityBinary(op, lhs, rhs)
+	}
+	switch op {
+	case OpPower:
+		return ev.pow(lhs, rhs)
+	case OpDivide, OpFloorDivide, OpModulo:
+		if isZero(rhs) {
+			return nil, ErrDivideByZero
+		}
+	case OpAnd, OpOr, OpXor, OpShiftLeft, OpShiftRight:
+		return bitwise(op, lhs, rhs)
+	}
+	if isComplex(lhs, rhs) {
+		return ev.complexBinary(op, lhs, rhs)
+	}
+	if op == OpFloorDivide || op == OpModulo {
+		return ev.floorDivide(op, lhs, rhs), nil
+	}
+	rank := numericRank(lhs)
+	if r := numericRank(rhs); r > rank {
+		rank = r
+	}
+	switch rank {
+	case rankInt:
+		l, r := lhs.(Int).Int, rhs.(Int).Int
+		res := new(big.Int)
+		switch op {
+		case OpDivide:
+			if ev.Backend == BackendInteger {
+				return Int{res.Quo(l, r)}, nil
+			}
+			return ratValue(new(big.Rat).SetFrac(l, r)), nil
+		case OpMultiply:
+			return Int{res.Mul(l, r)}, nil
+		case OpMinus:
+			return Int{res.Sub(l, r)}, nil
+		case OpPlus:
+			return Int{res.Add(l, r)}, nil
+		}
+	case rankRat:
+		l, r := toRat(lhs), toRat(rhs)
+		res := new(big.Rat)
+		switch op {
+		case OpDivide:
+			return ratValue(res.Quo(l, r)), nil
+		case OpMultiply:
+			return ratValue(res.Mul(l, r)), nil
+		case OpMinus:
+			return ratValue(res.Sub(l, r)), nil
+		case OpPlus:
+			return ratValue(res.Add(l, r)), nil
+		}
+	default:
+		prec := ev.floatPrecision(lhs, rhs)
+		l, r := toFloat(lhs, prec), toFloat(rhs, prec)
+		res := new(big.Float).SetPrec(prec)
+		switch op {
+		case OpDivide:
+			res.Quo(l, r)
+		case OpMultiply:
+			res.Mul(l, r)
+		case OpMinus:
+			res.Sub(l, r)
+		case OpPlus:
+			res.Add(l, r)
+		}
+		if res.IsInf() {
+			return nil, ErrOverflow
+		}
+		return Float{res}, nil
+	}
+	return nil, nil
+}
+
+// floorDivide computes the floored quotient or the remainder of lhs and
+// rhs exactly, returning a Float if either operand is one.
+func (ev Evaluator) floorDivide(op Op, lhs, rhs Value) Value {
+	l, r := toRat(lhs), toRat(rhs)
+	q := floorRat(new(big.Rat).Quo(l, r))
+	res := new(big.Rat).SetInt(q)
+	if op == OpModulo {
+		res.Sub(l, res.Mul(res, r))
+	}
+	if numericRank(lhs) == rankFloat || numericRank(rhs) == rankFloat {
+		return Float{new(big.Float).SetPrec(ev.floatPrecision(lhs, rhs)).SetRat(res)}
+	}
+	return ratValue(res)
+}
+
+func (ev Evaluator) unary(op Op, inner Value) (Value, error) {
+	inner = plain(inner)
+	if l, ok := inner.(List); ok {
+		return mapList(l, func(v Value) (Value, error) {
+			return ev.unary(op, v)
+		})
+	}
+	if isDate(inner) {
+		return nil, ErrDomain
+	}
+	if q, ok := inner.(Quantity); ok {
+		return ev.quantityUnary(op, q)
+	}
+	switch op {
+	case OpSquareRoot:
+		if c, ok := inner.(Complex); ok {
+			return complexValue(sqrtComplex(c, ev.floatPrecision(c))), nil
+		}
+		if sign(inner) < 0 {
+			if ev.Complex {
+				return complexValue(sqrtComplex(toComplex(inner, ev.floatPrecision(inner)), ev.floatPrecision(inner))), nil
+			}
+			return nil, ErrDomain
+		}
+		switch v := inner.(type) {
+		case Int:
+			if ev.Backend == BackendInteger {
+				return Int{new(big.Int).Sqrt(v.Int)}, nil
+			}
+		case Float:
+			return Float{new(big.Float).SetPrec(ev.floatPrecision(v)).Sqrt(v.Float)}, nil
+		}
+		if root, ok := sqrtRat(toRat(inner)); ok {
+			return ratValue(root), nil
+		}
+		return Float{new(big.Float).SetPrec(ev.precision()).Sqrt(toFloat(inner, ev.precision()))}, nil
+	case OpNot:
+		i, err := toInt(inner)
+		if err != nil {
+			return nil, err
+		}
+		return Int{i.Not(i)}, nil
+	case OpMinus:
+		switch v := inner.(type) {
+		case Int:
+			return Int{new(big.Int).Neg(v.Int)}, nil
+		case Rat:
+			return Rat{new(big.Rat).Neg(v.Rat)}, nil
+		case Float:
+			return Float{new(big.Float).Neg(v.Float)}, nil
+		case Complex:
+			return Complex{Re: new(big.Float).Neg(v.Re), Im: new(big.Float).Neg(v.Im)}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (ev Evaluator) postfix(op Op, inner Value) (Value, error) {
+	inner = plain(inner)
+	if l, ok := inner.(List); ok {
+		return mapList(l, func(v Value) (Value, error) {
+			return ev.postfix(op, v)
+		})
+	}
+	switch op {
+	case OpFactorial:
+		return ev.factorial(inner)
+	case OpModulo:
+		// a percentage
+		return ev.binary(OpDivide, inner, Int{big.NewInt(100)})
+	}
+	return nil, nil
+}
+
+// maxFactorial bounds factorials, whose results grow faster than powers,
+// so "1000000!" fails with ErrOverflow instead of computing for minutes.
+const maxFactorial = 100000
+
+// factorial computes n! exactly for non-negative integers n.
+func (ev Evaluator) factorial(v Value) (Value, error) {
+	if !isReal(v) {
+		return nil, ErrDomain
+	}
+	r := toRat(v)
+	if !r.IsInt() || r.Sign() < 0 {
+		return nil, ErrDomain
+	}
+	if r.Num().Cmp(big.NewInt(maxFactorial)) > 0 {
+		return nil, ErrOverflow
+	}
+	res := new(big.Int).MulRange(1, r.Num().Int64())
+	if f, ok := v.(Float); ok {
+		return Float{new(big.Float).SetPrec(ev.floatPrecision(f)).SetInt(res)}, nil
+	}
+	return Int{res}, nil
+}
+
+// maxPowBits bounds the size of exact powers, so "pow(10, 10000000000)"
+// fails with ErrOverflow instead of exhausting memory.
+const maxPowBits = 1 << 22
+
+// pow raises base to exp. Integer exponents are computed exactly, or at
+// full precision for Floats; other exponents are computed in float64.
+func (ev Evaluator) pow(base, exp Value) (Value, error) {
+	if f, ok := exp.(Float); ok && f.IsInt() {
+		i, _ := f.Int(nil)
+		exp = Int{i}
+	}
+	if isComplex(base, exp) {
+		return ev.complexPow(base, exp)
+	}
+	e, ok := exp.(Int)
+	if !ok {
+		b, x := toFloat64(base), toFloat64(exp)
+		if b < 0 {
+			if ev.Complex {
+				return ev.complexPow(base, exp)
+			}
+			return nil, ErrDomain
+		}
+		if b == 0 && x < 0 {
+			return nil, ErrDivideByZero
+		}
+		return float64Func(func(b float64) float64 {
+			return math.Pow(b, x)
+		}, anyReal)(ev, base)
+	}
+	if isZero(base) && e.Sign() < 0 {
+		return nil, ErrDivideByZero
+	}
+	if _, ok := base.(Float); ok || ev.Backend == BackendFloat {
+		return ev.powFloat(toFloat(base, ev.floatPrecision(base)), e.Int)
+	}
+	r := toRat(base)
+	n := new(big.Int).Abs(e.Int)
+	bits := big.NewInt(int64(r.Num().BitLen() + r.Denom().BitLen()))
+	if !isUnit(r) && bits.Mul(bits, n).Cmp(big.NewInt(maxPowBits)) > 0 {
+		return nil, ErrOverflow
+	}
+	res := new(big.Rat).SetFrac(
+		new(big.Int).Exp(r.Num(), n, nil),
+		new(big.Int).Exp(r.Denom(), n, nil),
+	)
+	if e.Sign() < 0 {
+		res.Inv(res)
+	}
+	if ev.Backend == BackendInteger {
+		return Int{truncRat(res)}, nil
+	}
+	return ratValue(res), nil
+}
+
+// powFloat raises base to an integer power by repeated squaring.
+func (ev Evaluator) powFloat(base *big.Float, e *big.Int) (Value, error) {
+	prec := base.Prec()
+	res := new(big.Float).SetPrec(prec).SetInt64(1)
+	sq := new(big.Float).SetPrec(prec).Set(base)
+	n := new(big.Int).Abs(e)
+	for i := 0; i < n.BitLen(); i++ {
+		if n.Bit(i) == 1 {
+			res.Mul(res, sq)
+		}
+		sq.Mul(sq, sq)
+		if res.IsInf() || sq.IsInf() {
+			return nil, ErrOverflow
+		}
+	}
+	if e.Sign() < 0 {
+		res.Quo(new(big.Float).SetPrec(prec).SetInt64(1), res)
+	}
+	return Float{res}, nil
+}
+
+// isUnit reports whether r is 0, 1 or -1, whose powers never grow.
+func isUnit(r *big.Rat) bool {
+	return r.IsInt() && r.Num().BitLen() <= 1
+}
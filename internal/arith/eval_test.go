@@ -0,0 +1,237 @@
+package arith
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvalChecked(t *testing.T) {
+	type testCase struct {
+		in      string
+		out     string
+		err     error
+		errNode string
+	}
+	tcs := []testCase{
+		{in: "6/3", out: "2"},
+		{in: "1/0", err: ErrDivideByZero, errNode: "1 / 0"},
+		{in: "1+(2/(3-3))", err: ErrDivideByZero, errNode: "2 / (3 - 3)"},
+		{in: "√(0-4)", err: ErrDomain, errNode: "√(0 - 4)"},
+		{in: "1/0.0", err: ErrDivideByZero, errNode: "1 / 0"},
+		{in: "9223372036854775807+1", out: "9223372036854775808"},
+		{in: "4294967296*4294967296", out: "18446744073709551616"},
+		{in: "-(-9223372036854775807-1)", out: "9223372036854775808"},
+		{in: "2^100", out: "1267650600228229401496703205376"},
+		{in: "2^-2", out: "0.25"},
+		{in: "7.5%2", out: "1.5"},
+		{in: "-7.5//2", out: "-4"},
+		{in: "1%0", err: ErrDivideByZero, errNode: "1 % 0"},
+		{in: "1+2//0", err: ErrDivideByZero, errNode: "2 // 0"},
+		{in: "0^-1", err: ErrDivideByZero, errNode: "0 ^ -1"},
+		{in: "10^10000000000", err: ErrOverflow},
+		{in: "50!", out: "30414093201713378043612608166064768844377641568960512000000000000"},
+		{in: "0!", out: "1"},
+		{in: "(0-1)!", err: ErrDomain, errNode: "(0 - 1)!"},
+		{in: "2.5!", err: ErrDomain, errNode: "2.5!"},
+		{in: "1000000!", err: ErrOverflow},
+		{in: "12.5%", out: "0.125"},
+		{in: "1/4%", out: "25"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			res, err := EvalChecked(tree)
+			if tc.err == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if res.String() != tc.out {
+					t.Fatalf("out mismatch: expected %v vs %v", tc.out, res)
+				}
+				return
+			}
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			var everr *EvalError
+			if !errors.As(err, &everr) {
+				t.Fatalf("expected an *EvalError, got %T", err)
+			}
+			if tc.errNode != "" && Pretty(everr.Node) != tc.errNode {
+				t.Fatalf("expected error in %q, got %q", tc.errNode, Pretty(everr.Node))
+			}
+		})
+	}
+}
+
+func TestEvalBackends(t *testing.T) {
+	type testCase struct {
+		in        string
+		backend   Backend
+		precision uint
+		out       string
+	}
+	tcs := []testCase{
+		{in: "7/2", backend: BackendRational, out: "3.5"},
+		{in: "7/2", backend: BackendInteger, out: "3"},
+		{in: "7/2", backend: BackendFloat, out: "3.5"},
+		{in: "-7/2", backend: BackendInteger, out: "-3"},
+		{in: "1/3", backend: BackendRational, out: "1/3"},
+		{in: "1/3*3", backend: BackendRational, out: "1"},
+		{in: "1/3+1/6", backend: BackendRational, out: "0.5"},
+		{in: "2/8", backend: BackendRational, out: "0.25"},
+		{in: "1/3", backend: BackendFloat, precision: 24, out: "0.3333333"},
+		{in: "√(9/4)", backend: BackendRational, out: "1.5"},
+		{in: "√2", backend: BackendRational, out: "1.414213562373095049"},
+		{in: "√2", backend: BackendInteger, out: "1"},
+		{in: "√2", backend: BackendRational, precision: 200, out: "1.41421356237309504880168872420969807856967187537694807317668"},
+		{in: "√16", backend: BackendFloat, out: "4"},
+		{in: "0.1+0.2", backend: BackendRational, out: "0.3"},
+		{in: "2.5*2", backend: BackendRational, out: "5"},
+		{in: ".5+.25", backend: BackendRational, out: "0.75"},
+		{in: "3./4", backend: BackendRational, out: "0.75"},
+		{in: "1.2e-3", backend: BackendRational, out: "0.0012"},
+		{in: "1.5E2+1", backend: BackendRational, out: "151"},
+		{in: "1/0.3", backend: BackendRational, out: "10/3"},
+		{in: "2.5*2", backend: BackendFloat, out: "5"},
+		{in: "6.0/3", backend: BackendInteger, out: "2"},
+		{in: "√2*√2", backend: BackendRational, out: "2"},
+		{in: "99999999999999999999*99999999999999999999", backend: BackendRational, out: "9999999999999999999800000000000000000001"},
+		{in: "100000000000000000000/3", backend: BackendInteger, out: "33333333333333333333"},
+		{in: "-7//2", backend: BackendInteger, out: "-4"},
+		{in: "7.5%2", backend: BackendFloat, out: "1.5"},
+		{in: "2^-1", backend: BackendFloat, out: "0.5"},
+		{in: "2^-1", backend: BackendInteger, out: "0"},
+		{in: "2^0.5", backend: BackendRational, out: "1.4142135623731"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			ev := Evaluator{Backend: tc.backend, Precision: tc.precision}
+			res, err := ev.Eval(tree)
+			if err != nil {
+				t.Fatalf("eval failed: %v", err)
+			}
+			if res.String() != tc.out {
+				t.Fatalf("out mismatch: expected %v vs %v", tc.out, res)
+			}
+		})
+	}
+}
+
+func TestEvalIntegerBackendRejectsFractions(t *testing.T) {
+	tree, err := ParseString("1 + 2.5")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	_, err = Evaluator{Backend: BackendInteger}.Eval(tree)
+	var everr *EvalError
+	if !errors.As(err, &everr) || !errors.Is(err, ErrDomain) {
+		t.Fatalf("expected a domain error, got %v", err)
+	}
+	if Pretty(everr.Node) != "2.5" {
+		t.Fatalf("expected error in 2.5, got %q", Pretty(everr.Node))
+	}
+}
+
+func TestEvalVariables(t *testing.T) {
+	env := NewEnvironment()
+	ev := Evaluator{Env: env}
+	type step struct {
+		in  string
+		out string
+		err error
+	}
+	steps := []step{
+		{in: "x = 3", out: "3"},
+		{in: "x * 2", out: "6"},
+		{in: "x = x + 1", out: "4"},
+		{in: "rate_2 = 1/4", out: "0.25"},
+		{in: "x * rate_2", out: "1"},
+		{in: "y + 1", err: ErrUndefined},
+		{in: "z = 1/0", err: ErrDivideByZero},
+	}
+	for _, s := range steps {
+		tree, err := ParseString(s.in)
+		if err != nil {
+			t.Fatalf("%q: parse failed: %v", s.in, err)
+		}
+		res, err := ev.Eval(tree)
+		if s.err != nil {
+			if !errors.Is(err, s.err) {
+				t.Fatalf("%q: expected %v, got %v", s.in, s.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", s.in, err)
+		}
+		if res.String() != s.out {
+			t.Fatalf("%q: expected %v got %v", s.in, s.out, res)
+		}
+	}
+	names := env.Names()
+	if len(names) != 2 || names[0] != "rate_2" || names[1] != "x" {
+		t.Fatalf("unexpected bindings %v", names)
+	}
+}
+
+func TestEvalWordSize(t *testing.T) {
+	type testCase struct {
+		in   string
+		word WordSize
+		out  string
+		err  error
+	}
+	tcs := []testCase{
+		{in: "255+1", word: WordSize{Bits: 8}, out: "0"},
+		{in: "0-1", word: WordSize{Bits: 8}, out: "255"},
+		{in: "~0", word: WordSize{Bits: 16}, out: "65535"},
+		{in: "~0", word: WordSize{Bits: 16, Signed: true}, out: "-1"},
+		{in: "127+1", word: WordSize{Bits: 8, Signed: true}, out: "-128"},
+		{in: "0xff", word: WordSize{Bits: 8, Signed: true}, out: "-1"},
+		{in: "1<<31", word: WordSize{Bits: 32, Signed: true}, out: "-2147483648"},
+		{in: "1<<32", word: WordSize{Bits: 32}, out: "0"},
+		{in: "0x8000000000000000>>63", word: WordSize{Bits: 64, Signed: true}, out: "-1"},
+		{in: "0x8000000000000000>>63", word: WordSize{Bits: 64}, out: "1"},
+		{in: "2^64", word: WordSize{Bits: 64}, out: "0"},
+		{in: "2^64", out: "18446744073709551616"},
+		{in: "1/2", word: WordSize{Bits: 8}, out: "0.5"},
+		{in: "1.5&1", err: ErrDomain},
+		{in: "1<<(0-1)", err: ErrDomain},
+		{in: "1<<10000000000", err: ErrOverflow},
+		{in: "0<<10000000000", out: "0"},
+		{in: "5>>10000000000", out: "0"},
+		{in: "-5>>10000000000", out: "-1"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			res, err := Evaluator{Word: tc.word}.Eval(tree)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.String() != tc.out {
+				t.Fatalf("out mismatch: expected %v vs %v", tc.out, res)
+			}
+		})
+	}
+}
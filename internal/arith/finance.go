@@ -0,0 +1,337 @@
+package arith
+
+import (
+	"math"
+	"math/big"
+)
+
+// The financial functions follow the sign convention of spreadsheets:
+// money paid out is negative and money received positive, so the payment
+// on a loan received as a positive present value is negative. Rates are
+// per period, as in "pmt(5%/12, 360, 200000 USD)". Like the
+// transcendental functions they are computed in float64, and they keep
+// the unit of the amounts they are given, which must share a dimension.
+
+// realArgs returns rates and numbers of periods as float64s. They must be
+// real numbers.
+func realArgs(vals ...Value) ([]float64, error) {
+	res := make([]float64, len(vals))
+	for i, v := range vals {
+		if !isReal(v) {
+			return nil, ErrDomain
+		}
+		res[i] = toFloat64(v)
+	}
+	return res, nil
+}
+
+// amounts returns sums of money, or of anything else, as float64s in the
+// unit of the first of them.
+func (ev Evaluator) amounts(vals ...Value) ([]float64, Unit, error) {
+	unit := toQuantity(vals[0]).Unit
+	res := make([]float64, len(vals))
+	for i, v := range vals {
+		q := toQuantity(v)
+		if !isReal(q.Value) {
+			return nil, nil, ErrDomain
+		}
+		if q.Unit.Dim() != unit.Dim() {
+			return nil, nil, &DimensionError{LHS: unit, RHS: q.Unit}
+		}
+		m, err := ev.rescale(q.Value, q.Unit, unit)
+		if err != nil {
+			return nil, nil, err
+		}
+		res[i] = toFloat64(m)
+	}
+	return res, unit, nil
+}
+
+// float64Result returns x as a Float, failing for the NaNs and infinities
+// of results outside a function's domain or range.
+func float64Result(x float64) (Value, error) {
+	switch {
+	case math.IsNaN(x):
+		return nil, ErrDomain
+	case math.IsInf(x, 0):
+		return nil, ErrOverflow
+	}
+	return fromFloat64(x), nil
+}
+
+// moneyFunc adapts fn, which takes reals rates and numbers of periods
+// followed by amounts, and returns an amount in the unit of the first
+// amount it was given. Missing trailing amounts are zero.
+func moneyFunc(reals int, fn func(rs, amounts []float64) float64) Func {
+	return func(ev Evaluator, args []Value) (Value, error) {
+		rs, err := realArgs(args[:reals]...)
+		if err != nil {
+			return nil, err
+		}
+		amounts, unit, err := ev.amounts(args[reals:]...)
+		if err != nil {
+			return nil, err
+		}
+		for len(amounts) < 2 {
+			amounts = append(amounts, 0)
+		}
+		res, err := float64Result(fn(rs, amounts))
+		if err != nil {
+			return nil, err
+		}
+		return ev.quantity(res, unit)
+	}
+}
+
+// futureValue is what remains of pv after n periods at rate with a
+// payment of pmt each period.
+func futureValue(rate, n, pmt, pv float64) float64 {
+	if rate == 0 {
+		return -(pv + pmt*n)
+	}
+	g := math.Pow(1+rate, n)
+	return -(pv*g + pmt*(g-1)/rate)
+}
+
+// presentValue is the amount n payments of pmt at rate, and fv after
+// them, are worth now.
+func presentValue(rate, n, pmt, fv float64) float64 {
+	if rate == 0 {
+		return -(fv + pmt*n)
+	}
+	g := math.Pow(1+rate, n)
+	return -(fv + pmt*(g-1)/rate) / g
+}
+
+// payment is the payment each period that takes pv to fv over n periods
+// at rate.
+func payment(rate, n, pv, fv float64) float64 {
+	if n <= 0 || rate <= -1 {
+		return math.NaN()
+	}
+	if rate == 0 {
+		return -(pv + fv) / n
+	}
+	g := math.Pow(1+rate, n)
+	return -(pv*g + fv) * rate / (g - 1)
+}
+
+// pmtFunc is pmt(rate, n, pv) or pmt(rate, n, pv, fv), the payment each
+// period that repays pv, less fv, over n periods.
+var pmtFunc = moneyFunc(2, func(rs, amounts []float64) float64 {
+	return payment(rs[0], rs[1], amounts[0], amounts[1])
+})
+
+// pvFunc is pv(rate, n, pmt) or pv(rate, n, pmt, fv), what n payments of
+// pmt and a final fv are worth now.
+var pvFunc = moneyFunc(2, func(rs, amounts []float64) float64 {
+	return presentValue(rs[0], rs[1], amounts[0], amounts[1])
+})
+
+// fvFunc is fv(rate, n, pmt) or fv(rate, n, pmt, pv), what n payments of
+// pmt and an initial pv are worth after them.
+var fvFunc = moneyFunc(2, func(rs, amounts []float64) float64 {
+	return futureValue(rs[0], rs[1], amounts[0], amounts[1])
+})
+
+// ipmtFunc is ipmt(rate, k, n, pv), the interest paid with payment k of
+// the n that repay pv.
+var ipmtFunc = moneyFunc(3, func(rs, amounts []float64) float64 {
+	rate, k, n, pv := rs[0], rs[1], rs[2], amounts[0]
+	if k < 1 || k > n {
+		return math.NaN()
+	}
+	return futureValue(rate, k-1, payment(rate, n, pv, 0), pv) * rate
+})
+
+// ppmtFunc is ppmt(rate, k, n, pv), the principal repaid with payment k
+// of the n that repay pv.
+var ppmtFunc = moneyFunc(3, func(rs, amounts []float64) float64 {
+	rate, k, n, pv := rs[0], rs[1], rs[2], amounts[0]
+	if k < 1 || k > n {
+		return math.NaN()
+	}
+	pmt := payment(rate, n, pv, 0)
+	return pmt - futureValue(rate, k-1, pmt, pv)*rate
+})
+
+// npvFunc is npv(rate, v1, v2, ...), what cash flows at the ends of the
+// coming periods are worth now. The flows may be given as a list.
+func npvFunc(ev Evaluator, args []Value) (Value, error) {
+	if len(args) < 2 {
+		return nil, ErrArity
+	}
+	args = append(args[:1:1], flatten(args[1:])...)
+	if len(args) < 2 {
+		return nil, ErrDomain
+	}
+	return moneyFunc(1, func(rs, flows []float64) float64 {
+		return discount(rs[0], flows, 1)
+	})(ev, args)
+}
+
+// discount returns the sum of flows discounted at rate, the first flow
+// by first periods and each of the others by one more.
+func discount(rate float64, flows []float64, first int) float64 {
+	if rate <= -1 {
+		return math.NaN()
+	}
+	sum := 0.0
+	for i, v := range flows {
+		sum += v / math.Pow(1+rate, float64(first+i))
+	}
+	return sum
+}
+
+// irrFunc is irr(v0, v1, ...), the rate at which cash flows now and at
+// the ends of the coming periods are worth nothing now. Where there are
+// several, it finds the one Newton's method reaches from 10%, as
+// spreadsheets do, and otherwise the smallest greater than -100%. Flows
+// that are worth nothing at no rate fail with ErrDomain. The flows may be
+// given as a list.
+func irrFunc(ev Evaluator, args []Value) (Value, error) {
+	if len(args) < 2 && !isList(args...) {
+		return nil, ErrArity
+	}
+	if args = flatten(args); len(args) < 2 {
+		return nil, ErrDomain
+	}
+	flows, _, err := ev.amounts(args...)
+	if err != nil {
+		return nil, err
+	}
+	const (
+		tolerance  = 1e-12
+		iterations = 100
+	)
+	npv := func(r float64) float64 {
+		return discount(r, flows, 0)
+	}
+	r := 0.1
+	for i := 0; i < iterations && r > -1; i++ {
+		f, df := 0.0, 0.0
+		for j, v := range flows {
+			f += v / math.Pow(1+r, float64(j))
+			df -= float64(j) * v / math.Pow(1+r, float64(j+1))
+		}
+		if df == 0 {
+			break
+		}
+		step := f / df
+		r -= step
+		if math.Abs(step) <= tolerance*(1+math.Abs(r)) {
+			return float64Result(r)
+		}
+	}
+	// bisect the first change of sign across rates from -99% up
+	lo, flo := -0.99, npv(-0.99)
+	for hi := -0.9; hi <= 1e6; hi = (hi+1)*2 - 1 {
+		fhi := npv(hi)
+		if math.IsNaN(flo) || math.IsNaN(fhi) {
+			return nil, ErrDomain
+		}
+		if flo == 0 {
+			return float64Result(lo)
+		}
+		if flo*fhi < 0 {
+			for i := 0; i < 200 && hi-lo > tolerance*(1+math.Abs(lo)); i++ {
+				mid := (lo + hi) / 2
+				if fmid := npv(mid); fmid*flo > 0 {
+					lo, flo = mid, fmid
+				} else {
+					hi = mid
+				}
+			}
+			return float64Result((lo + hi) / 2)
+		}
+		lo, flo = hi, fhi
+	}
+	return nil, ErrDomain
+}
+
+// compoundFunc is compound(p, rate, n) or compound(p, rate, n, m), what p
+// grows to over n periods at rate, compounded m times a period.
+func compoundFunc(ev Evaluator, args []Value) (Value, error) {
+	if !isReal(toQuantity(args[0]).Value) {
+		return nil, ErrDomain
+	}
+	rs, err := realArgs(args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	rate, n, m := rs[0], rs[1], 1.0
+	if len(rs) == 3 {
+		m = rs[2]
+	}
+	if m <= 0 || rate/m <= -1 {
+		return nil, ErrDomain
+	}
+	g, err := float64Result(math.Pow(1+rate/m, n*m))
+	if err != nil {
+		return nil, err
+	}
+	return ev.binary(OpMultiply, args[0], g)
+}
+
+// An Installment is one payment of an amortized loan.
+type Installment struct {
+	// Interest is the part of the payment paying the interest accrued
+	// over the period, and Principal the part paying down the loan.
+	Interest, Principal Value
+	// Balance is what remains owed after the payment.
+	Balance Value
+}
+
+// Amortize returns the schedule of equal payments each period that repay
+// principal over periods periods at rate per period. Unlike pmt, it
+// counts the amounts paid as positive. The Balance after the last
+// payment is zero.
+func (ev Evaluator) Amortize(rate, periods, principal Value) ([]Installment, error) {
+	if !isReal(periods) {
+		return nil, ErrDomain
+	}
+	n := toRat(periods)
+	if !n.IsInt() || n.Sign() <= 0 || n.Num().Cmp(big.NewInt(maxRangeTerms)) > 0 {
+		return nil, ErrDomain
+	}
+	rs, err := realArgs(rate)
+	if err != nil {
+		return nil, err
+	}
+	amounts, unit, err := ev.amounts(principal)
+	if err != nil {
+		return nil, err
+	}
+	r, count, balance := rs[0], int(n.Num().Int64()), amounts[0]
+	pmt := -payment(r, float64(count), balance, 0)
+	if math.IsNaN(pmt) || math.IsInf(pmt, 0) {
+		return nil, ErrDomain
+	}
+	value := func(x float64) (Value, error) {
+		v, err := float64Result(x)
+		if err != nil {
+			return nil, err
+		}
+		return ev.quantity(v, unit)
+	}
+	schedule := make([]Installment, count)
+	for k := range schedule {
+		interest := balance * r
+		balance -= pmt - interest
+		if k == count-1 {
+			balance = 0
+		}
+		var inst Installment
+		if inst.Interest, err = value(interest); err != nil {
+			return nil, err
+		}
+		if inst.Principal, err = value(pmt - interest); err != nil {
+			return nil, err
+		}
+		if inst.Balance, err = value(balance); err != nil {
+			return nil, err
+		}
+		schedule[k] = inst
+	}
+	return schedule, nil
+}
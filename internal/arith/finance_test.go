@@ -0,0 +1,103 @@
+package arith
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestFinance(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+		err error
+	}
+	tcs := []testCase{
+		{in: "pmt(5%/12, 360, 200000)", out: "-1073.64"},
+		{in: "pmt(5%/12, 360, 200000, -50000)", out: "-1013.57"},
+		{in: "pmt(0, 10, 1000)", out: "-100.00"},
+		{in: "pv(5%, 10, -100)", out: "772.17"},
+		{in: "pv(0, 10, -100, -50)", out: "1050.00"},
+		{in: "fv(5%, 10, -100)", out: "1257.79"},
+		{in: "fv(5%, 10, 0, -1000)", out: "1628.89"},
+		{in: "ipmt(5%/12, 1, 360, 200000)", out: "-833.33"},
+		{in: "ppmt(5%/12, 1, 360, 200000)", out: "-240.31"},
+		{in: "ipmt(5%/12, 360, 360, 200000) + ppmt(5%/12, 360, 360, 200000)", out: "-1073.64"},
+		{in: "npv(10%, -1000, 300, 400, 500)", out: "-19.12"},
+		{in: "irr(-1000, 300, 400, 500)", out: "0.09"},
+		{in: "irr(-100, 110) * 100", out: "10.00"},
+		{in: "compound(1000, 5%, 10)", out: "1628.89"},
+		{in: "compound(1000, 5%, 10, 12)", out: "1647.01"},
+		{in: "pmt(5%/12, 360, 200000 m)", out: "-1073.64 m"},
+		{in: "pmt(1%, 12, 1 km, 500 m)", out: "-0.13 km"},
+		{in: "compound(2 kg, 100%, 1)", out: "4.00 kg"},
+		{in: "pmt(1%, 0, 100)", err: ErrDomain},
+		{in: "pmt(-1, 3, 100)", err: ErrDomain},
+		{in: "pmt(1 m, 3, 100)", err: ErrDomain},
+		{in: "ipmt(1%, 13, 12, 100)", err: ErrDomain},
+		{in: "irr(1, 2)", err: ErrDomain},
+		{in: "irr(-1)", err: ErrArity},
+		{in: "npv(10%)", err: ErrArity},
+		{in: "fv(1%, 10, 1 m, 1 s)", err: &DimensionError{}},
+		{in: "compound(1000, 5%, 10, 0)", err: ErrDomain},
+	}
+	f := Formatter{Notation: NotationFixed, DecimalPlaces: 2}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := Parser{Units: DefaultUnits}.ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			v, err := EvalChecked(tree)
+			if tc.err != nil {
+				var derr *DimensionError
+				if errors.As(tc.err, &derr) {
+					if !errors.As(err, &derr) {
+						t.Fatalf("expected a DimensionError, got %v", err)
+					}
+				} else if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := f.Format(v); got != tc.out {
+				t.Fatalf("expected %v, got %v", tc.out, got)
+			}
+		})
+	}
+}
+
+func TestAmortize(t *testing.T) {
+	var ev Evaluator
+	schedule, err := ev.Amortize(Rat{big.NewRat(1, 100)}, Int{big.NewInt(12)}, Int{big.NewInt(1200)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(schedule) != 12 {
+		t.Fatalf("expected 12 installments, got %d", len(schedule))
+	}
+	f := Formatter{Notation: NotationFixed, DecimalPlaces: 2}
+	first, last := schedule[0], schedule[11]
+	for _, c := range []struct {
+		v    Value
+		want string
+	}{
+		{first.Interest, "12.00"},
+		{first.Principal, "94.62"},
+		{first.Balance, "1105.38"},
+		{last.Interest, "1.06"},
+		{last.Principal, "105.56"},
+		{last.Balance, "0.00"},
+	} {
+		if got := f.Format(c.v); got != c.want {
+			t.Fatalf("expected %v, got %v", c.want, got)
+		}
+	}
+	if _, err := ev.Amortize(Rat{big.NewRat(1, 100)}, Rat{big.NewRat(1, 2)}, Int{big.NewInt(1200)}); !errors.Is(err, ErrDomain) {
+		t.Fatalf("expected %v, got %v", ErrDomain, err)
+	}
+}
@@ -0,0 +1,394 @@
+package arith
+
+import (
+	"fmt"
+	"math/big"
+	"math/cmplx"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notation selects how a Formatter writes numbers.
+type Notation uint8
+
+const (
+	// NotationAuto writes numbers as Value.String does: integers and
+	// terminating decimals exactly, other fractions as fractions, and
+	// Floats with as many significant digits as their precision supports.
+	NotationAuto Notation = iota
+	// NotationFixed writes numbers with a fixed number of digits after the
+	// decimal point, as in "3.50".
+	NotationFixed
+	// NotationScientific writes numbers as a mantissa of one digit before
+	// the decimal point and a power of ten, as in "1.234567e6".
+	NotationScientific
+	// NotationEngineering is like NotationScientific but keeps exponents
+	// to multiples of three, as in "12.345e3".
+	NotationEngineering
+)
+
+// A Formatter writes Values and syntax trees as text. The zero Formatter
+// writes them as Value.String and Pretty do.
+type Formatter struct {
+	// Radix is 2, 8, 10 or 16. Exact numbers in NotationAuto are written
+	// in it with a 0b, 0o or 0x prefix so they parse back, and fractions
+	// as quotients, as in "0x1/0x3". Floats and other notations are
+	// always written in decimal. Zero means 10.
+	Radix    int
+	Notation Notation
+	// SignificantDigits limits the digits written for NotationScientific
+	// and NotationEngineering mantissas and for Floats in NotationAuto.
+	// Zero means as many as an exact number needs, or as a Float's
+	// precision supports.
+	SignificantDigits int
+	// DecimalPlaces is the number of digits after the decimal point in
+	// NotationFixed.
+	DecimalPlaces int
+	// ThousandsSeparator, if set, separates groups of three digits before
+	// the decimal point, as in "1,234,567".
+	ThousandsSeparator string
+	// DecimalSeparator, if set, replaces the decimal point, as in "3,5".
+	DecimalSeparator string
+	// Polar writes Complex values as a magnitude and an angle in
+	// PolarAngle units, as in "2∠90°", rather than as real and imaginary
+	// parts, as in "1 + 2i".
+	Polar      bool
+	PolarAngle AngleMode
+	// Location, if set, is the time zone Dates are written in. Nil writes
+	// each Date in the zone it was read in.
+	Location *time.Location
+}
+
+// Format writes v as text. Values other than numbers are written with
+// their String method. Amounts of a currency are written to two decimal
+// places in NotationAuto, and exact Mixed durations in mixed units, as
+// in "3d 4h".
+func (f Formatter) Format(v Value) string {
+	switch v := v.(type) {
+	case Estimate:
+		s := f.Format(v.Float)
+		if f.hidesError(v) {
+			return s
+		}
+		return s + " ± " + f.localize(v.Error.Text('g', 2))
+	case Complex:
+		return f.complex(v)
+	case List:
+		elems := make([]string, len(v))
+		for i, e := range v {
+			elems[i] = f.Format(e)
+		}
+		return string(OpOpenBracket) + strings.Join(elems, string(OpComma)+" ") + string(OpCloseBracket)
+	case Date:
+		t := v.Time
+		if f.Location != nil {
+			t = t.In(f.Location)
+		}
+		if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+			return t.Format("2006-01-02")
+		}
+		return t.Format(time.RFC3339Nano)
+	case Quantity:
+		if isComplex(v.Value) {
+			return "(" + f.Format(v.Value) + ") " + v.Unit.String()
+		}
+		if s, ok := f.duration(v); ok {
+			return s
+		}
+		if v.Unit.isCurrency() && f.Notation == NotationAuto {
+			// money is written in cents, as in "12.50 USD"
+			f.Notation, f.DecimalPlaces = NotationFixed, 2
+		}
+		return f.Format(v.Value) + " " + v.Unit.String()
+	case Int, Rat, Float:
+	default:
+		return v.String()
+	}
+	var s string
+	switch f.Notation {
+	case NotationFixed:
+		s = f.fixed(v)
+	case NotationScientific, NotationEngineering:
+		s = f.scientific(v)
+	default:
+		if s, ok := f.radix(v); ok {
+			return s
+		}
+		s = v.String()
+		if fl, ok := v.(Float); ok && f.SignificantDigits > 0 && f.SignificantDigits < decimalDigits(fl.Prec()) {
+			s = fl.Text('g', f.SignificantDigits)
+		}
+	}
+	return f.localize(s)
+}
+
+// hidesError reports whether e is written the same at either end of its
+// error, so that writing the error would add nothing.
+func (f Formatter) hidesError(e Estimate) bool {
+	s := f.Format(e.Float)
+	for _, sign := range []int{-1, 1} {
+		end := new(big.Float).SetPrec(e.Prec()).Mul(e.Error.Float, big.NewFloat(float64(sign)))
+		if f.Format(Float{end.Add(end, e.Float.Float)}) != s {
+			return false
+		}
+	}
+	return true
+}
+
+// Pretty writes a tree as text, formatting its numbers with f.
+func (f Formatter) Pretty(n Node) string {
+	switch v := n.(type) {
+	case NumberNode:
+		return f.Format(ratValue(v.Rat))
+	case BinaryOpNode:
+		lhs := f.Pretty(v.LHS)
+		rhs := f.Pretty(v.RHS)
+		if _, ok := v.RHS.(UnitNode); ok && v.Op == OpMultiply {
+			if num, ok := v.LHS.(NumberNode); ok {
+				if _, ok := decimalPlaces(num.Rat); ok {
+					// a number and its unit, as in "5 km"
+					return lhs + " " + rhs
+				}
+			}
+		}
+		return lhs + " " + string(v.Op) + " " + rhs
+	case UnaryOpNode:
+		return string(v.Op) + f.Pretty(v.Inner)
+	case PostfixOpNode:
+		return f.Pretty(v.Inner) + string(v.Op)
+	case ParenWrappedNode:
+		return "(" + f.Pretty(v.Inner) + ")"
+	case VariableNode:
+		return v.Name
+	case ConstantNode:
+		if v.Symbol != "" {
+			return v.Symbol
+		}
+		return v.Name
+	case AssignNode:
+		return v.Name + " " + string(OpEquals) + " " + f.Pretty(v.Value)
+	case CallNode:
+		args := make([]string, len(v.Args))
+		for i, arg := range v.Args {
+			args[i] = f.Pretty(arg)
+		}
+		return v.Name + "(" + strings.Join(args, string(OpComma)+" ") + ")"
+	case FunctionDefNode:
+		return v.Name + "(" + strings.Join(v.Params, string(OpComma)+" ") + ") " + string(OpEquals) + " " + f.Pretty(v.Body)
+	case EquationNode:
+		return f.Pretty(v.LHS) + " " + string(OpEquals) + " " + f.Pretty(v.RHS)
+	case RangeOpNode:
+		args := []string{f.Pretty(v.Body), v.Var, f.Pretty(v.From), f.Pretty(v.To)}
+		return string(v.Op) + "(" + strings.Join(args, string(OpComma)+" ") + ")"
+	case ListNode:
+		elems := make([]string, len(v.Elems))
+		for i, e := range v.Elems {
+			elems[i] = f.Pretty(e)
+		}
+		return string(OpOpenBracket) + strings.Join(elems, string(OpComma)+" ") + string(OpCloseBracket)
+	case DateNode:
+		return v.DateLiteral.String()
+	case UnitNode:
+		return v.Name
+	case ConvertNode:
+		return f.Pretty(v.Value) + " to " + f.Pretty(v.Unit)
+	default:
+		panic(fmt.Sprintf("invalid node: %T", n))
+	}
+}
+
+// complex writes c in rectangular or polar form. The parts are written
+// like Floats, so they follow the Notation.
+func (f Formatter) complex(c Complex) string {
+	if f.Polar {
+		angle := cmplx.Phase(toComplex128(c))
+		unit := ""
+		if f.PolarAngle == Degrees {
+			angle, unit = radiansToDegrees(angle), "°"
+		}
+		return f.Format(Float{absComplex(c, c.Re.Prec())}) + "∠" + f.Format(fromFloat64(angle)) + unit
+	}
+	im := f.Format(Float{new(big.Float).Abs(c.Im)})
+	if im == "1" {
+		im = ""
+	}
+	im += "i"
+	switch {
+	case c.Re.Sign() == 0 && c.Im.Sign() < 0:
+		return "-" + im
+	case c.Re.Sign() == 0:
+		return im
+	case c.Im.Sign() < 0:
+		return f.Format(Float{c.Re}) + " - " + im
+	default:
+		return f.Format(Float{c.Re}) + " + " + im
+	}
+}
+
+// radix writes exact numbers in a radix other than ten.
+func (f Formatter) radix(v Value) (string, bool) {
+	var prefix string
+	switch f.Radix {
+	case 2:
+		prefix = "0b"
+	case 8:
+		prefix = "0o"
+	case 16:
+		prefix = "0x"
+	default:
+		return "", false
+	}
+	write := func(i *big.Int) string {
+		if i.Sign() < 0 {
+			return "-" + prefix + new(big.Int).Neg(i).Text(f.Radix)
+		}
+		return prefix + i.Text(f.Radix)
+	}
+	switch v := v.(type) {
+	case Int:
+		return write(v.Int), true
+	case Rat:
+		return write(v.Num()) + "/" + write(v.Denom()), true
+	}
+	return "", false
+}
+
+// fixed writes v rounded to DecimalPlaces digits after the decimal point.
+func (f Formatter) fixed(v Value) string {
+	places := f.DecimalPlaces
+	if places < 0 {
+		places = 0
+	}
+	n := roundRat(new(big.Rat).Mul(toRat(v), pow10(places)))
+	digits := new(big.Int).Abs(n).String()
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+	s := digits
+	if places > 0 {
+		s = digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+	}
+	if n.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// scientific writes v in scientific or engineering notation.
+func (f Formatter) scientific(v Value) string {
+	r := toRat(v)
+	if r.Sign() == 0 {
+		return "0"
+	}
+	sig := f.SignificantDigits
+	if sig <= 0 {
+		sig = exactDigits(v)
+	}
+	digits, exp := significand(r, sig)
+	digits = strings.TrimRight(digits, "0")
+	// intDigits are the digits before the decimal point
+	intDigits := 1
+	if f.Notation == NotationEngineering {
+		intDigits += (exp%3 + 3) % 3
+		exp -= intDigits - 1
+	}
+	if len(digits) < intDigits {
+		digits += strings.Repeat("0", intDigits-len(digits))
+	}
+	s := digits[:intDigits]
+	if len(digits) > intDigits {
+		s += "." + digits[intDigits:]
+	}
+	if r.Sign() < 0 {
+		s = "-" + s
+	}
+	return s + "e" + strconv.Itoa(exp)
+}
+
+// localize inserts thousands separators into, and replaces the decimal
+// point of, a number written in decimal.
+func (f Formatter) localize(s string) string {
+	if f.ThousandsSeparator == "" && f.DecimalSeparator == "" {
+		return s
+	}
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		return f.localize(s[:i]) + "/" + f.localize(s[i+1:])
+	}
+	mantissa, exp := s, ""
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mantissa, exp = s[:i], s[i:]
+	}
+	sign := ""
+	if strings.HasPrefix(mantissa, "-") {
+		sign, mantissa = "-", mantissa[1:]
+	}
+	intPart, frac := mantissa, ""
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		intPart, frac = mantissa[:i], mantissa[i+1:]
+	}
+	if f.ThousandsSeparator != "" {
+		var sb strings.Builder
+		for i, c := range intPart {
+			if i > 0 && (len(intPart)-i)%3 == 0 {
+				sb.WriteString(f.ThousandsSeparator)
+			}
+			sb.WriteRune(c)
+		}
+		intPart = sb.String()
+	}
+	if frac != "" {
+		point := "."
+		if f.DecimalSeparator != "" {
+			point = f.DecimalSeparator
+		}
+		intPart += point + frac
+	}
+	return sign + intPart + exp
+}
+
+// exactDigits is the number of significant digits needed to write v
+// exactly, or as many as its precision supports for Floats and fractions
+// without a terminating decimal expansion.
+func exactDigits(v Value) int {
+	if f, ok := v.(Float); ok {
+		return decimalDigits(f.Prec())
+	}
+	r := toRat(v)
+	places, ok := decimalPlaces(r)
+	if !ok {
+		return decimalDigits(DefaultPrecision)
+	}
+	n := new(big.Rat).Mul(r, pow10(places))
+	return len(new(big.Int).Abs(n.Num()).String())
+}
+
+// significand returns the first sig significant digits of r, rounded half
+// away from zero, and the power of ten of the first of them.
+func significand(r *big.Rat, sig int) (string, int) {
+	a := new(big.Rat).Abs(r)
+	exp := len(a.Num().String()) - len(a.Denom().String())
+	if a.Cmp(pow10(exp)) < 0 {
+		exp--
+	}
+	digits := roundRat(a.Mul(a, pow10(sig-1-exp))).String()
+	if len(digits) > sig {
+		// rounding carried into another digit, as 9.99 does to 10.0
+		digits = digits[:sig]
+		exp++
+	}
+	return digits, exp
+}
+
+// pow10 returns 10^e.
+func pow10(e int) *big.Rat {
+	abs := e
+	if abs < 0 {
+		abs = -abs
+	}
+	p := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs)), nil)
+	if e < 0 {
+		return new(big.Rat).SetFrac(big.NewInt(1), p)
+	}
+	return new(big.Rat).SetInt(p)
+}
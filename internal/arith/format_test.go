@@ -0,0 +1,144 @@
+package arith
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFormatter(t *testing.T) {
+	type testCase struct {
+		in  string
+		fmt Formatter
+		out string
+	}
+	sci := Formatter{Notation: NotationScientific}
+	eng := Formatter{Notation: NotationEngineering}
+	tcs := []testCase{
+		{in: "1234567", out: "1234567"},
+		{in: "7/2", out: "3.5"},
+		{in: "1/3", out: "1/3"},
+		{in: "1234567", fmt: Formatter{ThousandsSeparator: ","}, out: "1,234,567"},
+		{in: "0-1234567/2", fmt: Formatter{ThousandsSeparator: ","}, out: "-617,283.5"},
+		{in: "123", fmt: Formatter{ThousandsSeparator: ","}, out: "123"},
+		{in: "1234567/4", fmt: Formatter{ThousandsSeparator: ".", DecimalSeparator: ","}, out: "308.641,75"},
+		{in: "4000/3", fmt: Formatter{ThousandsSeparator: ","}, out: "4,000/3"},
+		{in: "1234567", fmt: sci, out: "1.234567e6"},
+		{in: "0.00125", fmt: sci, out: "1.25e-3"},
+		{in: "0-1000", fmt: sci, out: "-1e3"},
+		{in: "0", fmt: sci, out: "0"},
+		{in: "1/3", fmt: sci, out: "3.333333333333333333e-1"},
+		{in: "1234567", fmt: Formatter{Notation: NotationScientific, SignificantDigits: 3}, out: "1.23e6"},
+		{in: "9999", fmt: Formatter{Notation: NotationScientific, SignificantDigits: 2}, out: "1e4"},
+		{in: "1234567", fmt: eng, out: "1.234567e6"},
+		{in: "12345", fmt: eng, out: "12.345e3"},
+		{in: "100000", fmt: eng, out: "100e3"},
+		{in: "0.000123", fmt: eng, out: "123e-6"},
+		{in: "0.00123", fmt: Formatter{Notation: NotationEngineering, DecimalSeparator: ","}, out: "1,23e-3"},
+		{in: "7/2", fmt: Formatter{Notation: NotationFixed, DecimalPlaces: 2}, out: "3.50"},
+		{in: "2/3", fmt: Formatter{Notation: NotationFixed, DecimalPlaces: 3}, out: "0.667"},
+		{in: "0-1/200", fmt: Formatter{Notation: NotationFixed, DecimalPlaces: 2}, out: "-0.01"},
+		{in: "0-1/300", fmt: Formatter{Notation: NotationFixed, DecimalPlaces: 2}, out: "0.00"},
+		{in: "5/2", fmt: Formatter{Notation: NotationFixed}, out: "3"},
+		{in: "1234567.891", fmt: Formatter{Notation: NotationFixed, DecimalPlaces: 1, ThousandsSeparator: ","}, out: "1,234,567.9"},
+		{in: "255", fmt: Formatter{Radix: 16}, out: "0xff"},
+		{in: "0-5", fmt: Formatter{Radix: 2}, out: "-0b101"},
+		{in: "1/8", fmt: Formatter{Radix: 8}, out: "0o1/0o10"},
+		{in: "255", fmt: Formatter{Radix: 16, Notation: NotationScientific}, out: "2.55e2"},
+		{in: "√2", fmt: Formatter{Radix: 16}, out: "1.414213562373095049"},
+		{in: "√2", fmt: Formatter{SignificantDigits: 4}, out: "1.414"},
+		{in: "√2*1000", fmt: Formatter{SignificantDigits: 6, ThousandsSeparator: ","}, out: "1,414.21"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			res := Eval(tree)
+			if got := tc.fmt.Format(res); got != tc.out {
+				t.Fatalf("out mismatch: expected %v vs %v", tc.out, got)
+			}
+		})
+	}
+}
+
+func TestFormatterPretty(t *testing.T) {
+	tree, err := ParseString("255 + x * 1/4")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got := (Formatter{Radix: 16}).Pretty(tree); got != "0xff + x * 0x1 / 0x4" {
+		t.Fatalf("unexpected pretty form %q", got)
+	}
+	// hexadecimal output parses back to the same tree
+	back, err := ParseString(Formatter{Radix: 16}.Pretty(tree))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if Pretty(back) != Pretty(tree) {
+		t.Fatalf("round trip mismatch: %q vs %q", Pretty(back), Pretty(tree))
+	}
+	if got := (Formatter{ThousandsSeparator: ","}).Pretty(tree); got != "255 + x * 1 / 4" {
+		t.Fatalf("unexpected pretty form %q", got)
+	}
+}
+
+func TestFormatterDurations(t *testing.T) {
+	type testCase struct {
+		in  string
+		fmt Formatter
+		out string
+	}
+	tcs := []testCase{
+		{in: "3d 4h", out: "3d 4h"},
+		{in: "1wk 1d", out: "1wk 1d"},
+		{in: "2024-03-12 - 2024-03-15", out: "-3d"},
+		{in: "2024-03-02T12:00 - 2024-03-01", out: "1d 12h"},
+		{in: "-(1d 12h)", out: "-1d 12h"},
+		{in: "1 h - 60 min", out: "0h"},
+		{in: "1 min + 30 s", out: "1min 30s"},
+		{in: "1 h + 0.25 s", out: "1h 0.25s"},
+		{in: "1000 d + 0 h", fmt: Formatter{ThousandsSeparator: ","}, out: "1,000d"},
+		{in: "90 s", out: "90 s"},
+		{in: "-3 d", out: "-3 d"},
+		{in: "1 d + 1 d", out: "2 d"},
+		{in: "abs(-2 s)", out: "2 s"},
+		{in: "(3d 4h) to h", out: "76 h"},
+		{in: "(3d 4h) * 3", out: "9.5 d"},
+		{in: "2.5 yr", out: "2.5 yr"},
+		{in: "5 ms", out: "5 ms"},
+		{in: "3 d * 2 m", out: "6 d*m"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := Parser{Units: DefaultUnits}.ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			res, err := EvalChecked(tree)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := tc.fmt.Format(res); got != tc.out {
+				t.Fatalf("out mismatch: expected %v vs %v", tc.out, got)
+			}
+			if tc.fmt != (Formatter{}) {
+				return
+			}
+			// the written form reads back as the same quantity
+			again, err := Parser{Units: DefaultUnits}.ParseString(tc.out)
+			if err != nil {
+				t.Fatalf("%s does not parse: %v", tc.out, err)
+			}
+			inBase := func(v Value) string {
+				q := toQuantity(v)
+				return new(big.Rat).Mul(toRat(q.Value), q.Unit.Scale()).RatString()
+			}
+			if v, err := EvalChecked(again); err != nil || inBase(v) != inBase(res) {
+				t.Fatalf("%s reads back as %v, %v", tc.out, v, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,499 @@
+package arith
+
+import (
+	"math"
+	"math/big"
+	"math/cmplx"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// AngleMode is the unit trigonometric functions take, and inverse
+// trigonometric functions return, angles in.
+type AngleMode uint8
+
+const (
+	Radians AngleMode = iota
+	Degrees
+)
+
+// Variadic is the arity of a function that accepts any number of
+// arguments.
+const Variadic = -1
+
+// A Func computes the result of a function call from its evaluated
+// arguments. It is only called with as many arguments as the arity it was
+// registered with, unless that arity is Variadic.
+type Func func(ev Evaluator, args []Value) (Value, error)
+
+// A FunctionRegistry holds the functions expressions can call by name. A
+// name may be registered with several arities, as log is with one and two
+// arguments; a call uses the function registered with its exact number of
+// arguments, falling back to a Variadic one. The zero FunctionRegistry is
+// empty and ready to use, and a FunctionRegistry is safe for concurrent
+// use.
+type FunctionRegistry struct {
+	mu    sync.RWMutex
+	funcs map[string]map[int]Func
+	// defined holds the names of functions defined with Define rather
+	// than registered as built-ins.
+	defined map[string]bool
+}
+
+// NewFunctionRegistry returns an empty FunctionRegistry.
+func NewFunctionRegistry() *FunctionRegistry {
+	return &FunctionRegistry{}
+}
+
+// Register makes fn callable as name with arity arguments, replacing any
+// function already registered with that name and arity, and makes name a
+// built-in that Define will not replace. It panics if name is not an
+// identifier or arity is neither Variadic nor at least zero.
+func (r *FunctionRegistry) Register(name string, arity int, fn Func) {
+	if rs := []rune(name); len(rs) == 0 || scanIdent(rs) != len(rs) {
+		panic("arith: invalid function name " + strconv.Quote(name))
+	}
+	if arity < Variadic {
+		panic("arith: invalid arity " + strconv.Itoa(arity) + " for " + name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.register(name, arity, fn)
+	delete(r.defined, name)
+}
+
+func (r *FunctionRegistry) register(name string, arity int, fn Func) {
+	if r.funcs == nil {
+		r.funcs = make(map[string]map[int]Func)
+	}
+	if r.funcs[name] == nil {
+		r.funcs[name] = make(map[int]Func)
+	}
+	r.funcs[name][arity] = fn
+}
+
+// Define makes a function defined in expression syntax callable, replacing
+// any earlier definition with the same name and number of parameters. It
+// fails with ErrBuiltin if the name is registered as a built-in, so a
+// definition cannot shadow one.
+func (r *FunctionRegistry) Define(f UserFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.funcs[f.Name]; ok && !r.defined[f.Name] {
+		return ErrBuiltin
+	}
+	r.register(f.Name, len(f.Params), f.Call)
+	if r.defined == nil {
+		r.defined = make(map[string]bool)
+	}
+	r.defined[f.Name] = true
+	return nil
+}
+
+// IsBuiltin reports whether name is registered with Register rather than
+// defined with Define.
+func (r *FunctionRegistry) IsBuiltin(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.funcs[name]
+	return ok && !r.defined[name]
+}
+
+// Has reports whether any function is registered as name.
+func (r *FunctionRegistry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.funcs[name]
+	return ok
+}
+
+// Lookup returns the function a call to name with arity arguments uses. It
+// fails with ErrUnknownFunc if nothing is registered as name and with
+// ErrArity if nothing registered as name accepts arity arguments.
+func (r *FunctionRegistry) Lookup(name string, arity int) (Func, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	overloads, ok := r.funcs[name]
+	if !ok {
+		return nil, ErrUnknownFunc
+	}
+	if fn, ok := overloads[arity]; ok {
+		return fn, nil
+	}
+	if fn, ok := overloads[Variadic]; ok {
+		return fn, nil
+	}
+	return nil, ErrArity
+}
+
+// Names returns the registered names in sorted order.
+func (r *FunctionRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.funcs))
+	for name := range r.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clone returns a copy of r. Registering functions with the copy does not
+// affect r, so a session can extend DefaultFunctions with its own.
+func (r *FunctionRegistry) Clone() *FunctionRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := &FunctionRegistry{
+		funcs:   make(map[string]map[int]Func, len(r.funcs)),
+		defined: make(map[string]bool, len(r.defined)),
+	}
+	for name := range r.defined {
+		c.defined[name] = true
+	}
+	for name, overloads := range r.funcs {
+		c.funcs[name] = make(map[int]Func, len(overloads))
+		for arity, fn := range overloads {
+			c.funcs[name][arity] = fn
+		}
+	}
+	return c
+}
+
+// DefaultFunctions are the functions expressions can call when a Parser or
+// Evaluator does not specify a FunctionRegistry.
+var DefaultFunctions = defaultFunctions()
+
+func defaultFunctions() *FunctionRegistry {
+	r := NewFunctionRegistry()
+	unaries := map[string]func(Evaluator, Value) (Value, error){
+		"sin":   trig(math.Sin, cmplx.Sin),
+		"cos":   trig(math.Cos, cmplx.Cos),
+		"tan":   trig(math.Tan, cmplx.Tan),
+		"asin":  inverseTrig(math.Asin, cmplx.Asin, inClosedUnit),
+		"acos":  inverseTrig(math.Acos, cmplx.Acos, inClosedUnit),
+		"atan":  inverseTrig(math.Atan, cmplx.Atan, anyReal),
+		"sinh":  complexFunc(math.Sinh, cmplx.Sinh, anyReal),
+		"cosh":  complexFunc(math.Cosh, cmplx.Cosh, anyReal),
+		"tanh":  complexFunc(math.Tanh, cmplx.Tanh, anyReal),
+		"asinh": complexFunc(math.Asinh, cmplx.Asinh, anyReal),
+		"acosh": complexFunc(math.Acosh, cmplx.Acosh, func(x float64) bool { return x >= 1 }),
+		"atanh": complexFunc(math.Atanh, cmplx.Atanh, func(x float64) bool { return x > -1 && x < 1 }),
+		"exp":   complexFunc(math.Exp, cmplx.Exp, anyReal),
+		"ln":    complexFunc(math.Log, cmplx.Log, positive),
+		"log2": complexFunc(math.Log2, func(z complex128) complex128 {
+			return cmplx.Log(z) / math.Ln2
+		}, positive),
+		"sqrt": func(ev Evaluator, x Value) (Value, error) {
+			return ev.unary(OpSquareRoot, x)
+		},
+		"abs":   keepUnit(absFunc),
+		"floor": keepUnit(roundFunc(floorRat)),
+		"ceil":  keepUnit(roundFunc(ceilRat)),
+		"trunc": keepUnit(roundFunc(truncRat)),
+		"round": keepUnit(roundFunc(roundRat)),
+		"re":    keepUnit(reFunc),
+		"im":    keepUnit(imFunc),
+		"conj":  keepUnit(conjFunc),
+		"arg":   argFunc,
+	}
+	for name, fn := range unaries {
+		r.Register(name, 1, unary(fn))
+	}
+	r.Register("log", 1, unary(func(ev Evaluator, x Value) (Value, error) {
+		return logFunc(ev, []Value{x})
+	}))
+	r.Register("log", 2, logFunc)
+	r.Register("min", Variadic, extremum(-1))
+	r.Register("max", Variadic, extremum(1))
+	r.Register("sum", Variadic, sumFunc)
+	r.Register("count", Variadic, countFunc)
+	r.Register("mean", Variadic, meanFunc)
+	r.Register("median", Variadic, medianFunc)
+	r.Register("mode", Variadic, modeFunc)
+	r.Register("variance", Variadic, varianceFunc(true))
+	r.Register("pvariance", Variadic, varianceFunc(false))
+	r.Register("stddev", Variadic, stddevFunc(true))
+	r.Register("pstddev", Variadic, stddevFunc(false))
+	r.Register("percentile", 2, percentileFunc)
+	r.Register("linreg", 2, linregFunc)
+	r.Register("corr", 2, corrFunc)
+	r.Register("transpose", 1, transposeFunc)
+	r.Register("det", 1, detFunc)
+	r.Register("inv", 1, invFunc)
+	r.Register("trace", 1, traceFunc)
+	r.Register("identity", 1, identityFunc)
+	r.Register("linsolve", 2, linsolveFunc)
+	r.Register("dot", 2, dotFunc)
+	r.Register("cross", 2, crossFunc)
+	r.Register("date", 3, dateFunc)
+	r.Register("date", 6, dateFunc)
+	r.Register("now", 0, nowFunc)
+	r.Register("workdays", 2, workdaysFunc)
+	r.Register("workday", 2, workdayFunc)
+	r.Register("pmt", 3, pmtFunc)
+	r.Register("pmt", 4, pmtFunc)
+	r.Register("pv", 3, pvFunc)
+	r.Register("pv", 4, pvFunc)
+	r.Register("fv", 3, fvFunc)
+	r.Register("fv", 4, fvFunc)
+	r.Register("ipmt", 4, ipmtFunc)
+	r.Register("ppmt", 4, ppmtFunc)
+	r.Register("npv", Variadic, npvFunc)
+	r.Register("irr", Variadic, irrFunc)
+	r.Register("compound", 3, compoundFunc)
+	r.Register("compound", 4, compoundFunc)
+	r.Register("pow", 2, func(ev Evaluator, args []Value) (Value, error) {
+		return ev.binary(OpPower, args[0], args[1])
+	})
+	return r
+}
+
+func (ev Evaluator) functions() *FunctionRegistry {
+	if ev.Functions == nil {
+		return DefaultFunctions
+	}
+	return ev.Functions
+}
+
+func (ev Evaluator) call(name string, args []Value) (Value, error) {
+	fn, err := ev.functions().Lookup(name, len(args))
+	if err != nil {
+		return nil, err
+	}
+	return fn(ev, args)
+}
+
+// maxCallDepth bounds how deeply user defined functions may call each
+// other, so "f(x) = f(x)" fails with ErrRecursion instead of exhausting
+// the stack.
+const maxCallDepth = 256
+
+// A UserFunc is a function defined in expression syntax, as in
+// "f(x) = x*x + 1". Evaluating a FunctionDefNode returns the UserFunc it
+// defines.
+type UserFunc struct {
+	Name   string
+	Params []string
+	Body   Node
+}
+
+func (f UserFunc) String() string {
+	return Pretty(FunctionDefNode{
+		Name:   f.Name,
+		Params: f.Params,
+		Body:   f.Body,
+	})
+}
+
+// Call evaluates the body of f with its parameters bound to args. Other
+// variables are looked up in the Evaluator's Env.
+func (f UserFunc) Call(ev Evaluator, args []Value) (Value, error) {
+	if len(args) != len(f.Params) {
+		return nil, ErrArity
+	}
+	if ev.depth >= maxCallDepth {
+		return nil, ErrRecursion
+	}
+	scope := &Environment{parent: ev.Env}
+	for i, param := range f.Params {
+		scope.Set(param, args[i])
+	}
+	ev.Env = scope
+	ev.depth++
+	return ev.Eval(f.Body)
+}
+
+// unary adapts a function of one argument, applying it to each element
+// of a List. The matrix functions are not adapted, as they take whole
+// vectors and matrices.
+func unary(fn func(ev Evaluator, x Value) (Value, error)) Func {
+	return func(ev Evaluator, args []Value) (Value, error) {
+		return elementwise(ev, args[0], fn)
+	}
+}
+
+func anyReal(float64) bool {
+	return true
+}
+
+func positive(x float64) bool {
+	return x > 0
+}
+
+func inClosedUnit(x float64) bool {
+	return x >= -1 && x <= 1
+}
+
+func toFloat64(v Value) float64 {
+	f, _ := toFloat(v, 53).Float64()
+	return f
+}
+
+// fromFloat64 returns f as a Float carrying float64's precision.
+func fromFloat64(f float64) Value {
+	return Float{new(big.Float).SetPrec(53).SetFloat64(f)}
+}
+
+func degreesToRadians(x float64) float64 {
+	return x * math.Pi / 180
+}
+
+func radiansToDegrees(x float64) float64 {
+	return x * 180 / math.Pi
+}
+
+// float64Func adapts a float64 function whose domain is restricted to
+// inputs for which inDomain is true. Its results carry float64's 53 bits
+// of precision whatever the Evaluator's Precision.
+func float64Func(fn func(float64) float64, inDomain func(float64) bool) func(Evaluator, Value) (Value, error) {
+	return func(ev Evaluator, v Value) (Value, error) {
+		x := toFloat64(v)
+		if !inDomain(x) {
+			return nil, ErrDomain
+		}
+		return float64Result(fn(x))
+	}
+}
+
+// trig adapts a trigonometric function and its complex counterpart to
+// take their argument in the Evaluator's AngleMode.
+func trig(fn func(float64) float64, cfn func(complex128) complex128) func(Evaluator, Value) (Value, error) {
+	return func(ev Evaluator, v Value) (Value, error) {
+		return complexFunc(func(x float64) float64 {
+			if ev.Angle == Degrees {
+				x = degreesToRadians(x)
+			}
+			return fn(x)
+		}, func(z complex128) complex128 {
+			if ev.Angle == Degrees {
+				z *= math.Pi / 180
+			}
+			return cfn(z)
+		}, anyReal)(ev, v)
+	}
+}
+
+// inverseTrig adapts an inverse trigonometric function and its complex
+// counterpart to return their result in the Evaluator's AngleMode.
+func inverseTrig(fn func(float64) float64, cfn func(complex128) complex128, inDomain func(float64) bool) func(Evaluator, Value) (Value, error) {
+	return func(ev Evaluator, v Value) (Value, error) {
+		return complexFunc(func(x float64) float64 {
+			res := fn(x)
+			if ev.Angle == Degrees {
+				res = radiansToDegrees(res)
+			}
+			return res
+		}, func(z complex128) complex128 {
+			res := cfn(z)
+			if ev.Angle == Degrees {
+				res *= 180 / math.Pi
+			}
+			return res
+		}, inDomain)(ev, v)
+	}
+}
+
+// logFunc is log(x), the base ten logarithm, or log(x, b), the base b
+// logarithm.
+func logFunc(ev Evaluator, args []Value) (Value, error) {
+	if isQuantity(args...) || isDate(args...) || isList(args...) {
+		return nil, ErrDomain
+	}
+	x := toFloat64(args[0])
+	base := 10.0
+	if len(args) == 2 {
+		base = toFloat64(args[1])
+	}
+	if isComplex(args...) || ev.Complex && (x <= 0 || base <= 0) {
+		if len(args) == 1 {
+			return complexResult(cmplx.Log10(toComplex128(args[0])))
+		}
+		return complexResult(cmplx.Log(toComplex128(args[0])) / cmplx.Log(toComplex128(args[1])))
+	}
+	if x <= 0 || base <= 0 || base == 1 {
+		return nil, ErrDomain
+	}
+	if base == 10 {
+		return fromFloat64(math.Log10(x)), nil
+	}
+	return fromFloat64(math.Log(x) / math.Log(base)), nil
+}
+
+func absFunc(ev Evaluator, v Value) (Value, error) {
+	switch v := v.(type) {
+	case Int:
+		return Int{new(big.Int).Abs(v.Int)}, nil
+	case Rat:
+		return Rat{new(big.Rat).Abs(v.Rat)}, nil
+	case Float:
+		return Float{new(big.Float).Abs(v.Float)}, nil
+	case Complex:
+		return Float{absComplex(v, ev.floatPrecision(v))}, nil
+	}
+	return nil, ErrDomain
+}
+
+// roundFunc adapts a rounding function over exact rationals. Floats are
+// converted exactly before rounding, so the result is always an Int.
+func roundFunc(fn func(*big.Rat) *big.Int) func(Evaluator, Value) (Value, error) {
+	return func(ev Evaluator, v Value) (Value, error) {
+		if isComplex(v) || isDate(v) {
+			return nil, ErrDomain
+		}
+		return Int{fn(toRat(v))}, nil
+	}
+}
+
+func floorRat(r *big.Rat) *big.Int {
+	// big.Rat keeps its denominator positive, so euclidean division
+	// rounds toward negative infinity.
+	return new(big.Int).Div(r.Num(), r.Denom())
+}
+
+func ceilRat(r *big.Rat) *big.Int {
+	return new(big.Int).Neg(floorRat(new(big.Rat).Neg(r)))
+}
+
+func truncRat(r *big.Rat) *big.Int {
+	return new(big.Int).Quo(r.Num(), r.Denom())
+}
+
+// roundRat rounds half away from zero.
+func roundRat(r *big.Rat) *big.Int {
+	abs := new(big.Rat).Abs(r)
+	res := floorRat(abs.Add(abs, big.NewRat(1, 2)))
+	if r.Sign() < 0 {
+		res.Neg(res)
+	}
+	return res
+}
+
+// extremum returns min when want is -1 and max when want is 1. They take
+// the elements of lists among their arguments, as in "max([1, 2], 3)".
+func extremum(want int) Func {
+	return func(ev Evaluator, args []Value) (Value, error) {
+		if len(args) == 0 {
+			return nil, ErrArity
+		}
+		args = flatten(args)
+		if len(args) == 0 || !isReal(args...) {
+			// complex numbers are not ordered, and quantities and
+			// dates are not compared
+			return nil, ErrDomain
+		}
+		best := args[0]
+		for _, arg := range args[1:] {
+			if compareValues(arg, best) == want {
+				best = arg
+			}
+		}
+		return best, nil
+	}
+}
+
+// compareValues returns -1, 0 or 1 as a is less than, equal to or greater
+// than b.
+func compareValues(a, b Value) int {
+	return toRat(a).Cmp(toRat(b))
+}
@@ -0,0 +1,239 @@
+package arith
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestFunctions(t *testing.T) {
+	type testCase struct {
+		in    string
+		angle AngleMode
+		out   string
+		err   error
+	}
+	tcs := []testCase{
+		{in: "sin(0)", out: "0"},
+		{in: "sin(30)", angle: Degrees, out: "0.5"},
+		{in: "cos(60)", angle: Degrees, out: "0.5"},
+		{in: "tan(45)", angle: Degrees, out: "1"},
+		{in: "asin(1)", angle: Degrees, out: "90"},
+		{in: "acos(0)*2", out: "3.14159265358979"},
+		{in: "atan(1)", angle: Degrees, out: "45"},
+		{in: "asin(2)", err: ErrDomain},
+		{in: "sinh(0)+cosh(0)", out: "1"},
+		{in: "tanh(0)", out: "0"},
+		{in: "acosh(1)", out: "0"},
+		{in: "acosh(0)", err: ErrDomain},
+		{in: "atanh(1)", err: ErrDomain},
+		{in: "exp(0)", out: "1"},
+		{in: "ln(exp(2))", out: "2"},
+		{in: "ln(0)", err: ErrDomain},
+		{in: "log(1000)", out: "3"},
+		{in: "log(8, 2)", out: "3"},
+		{in: "log(8, 1)", err: ErrDomain},
+		{in: "log2(1024)", out: "10"},
+		{in: "exp(1000)", err: ErrOverflow},
+		{in: "sqrt(16)", out: "4"},
+		{in: "abs(0-5/2)", out: "2.5"},
+		{in: "floor(7/2)", out: "3"},
+		{in: "floor(-7/2)", out: "-4"},
+		{in: "ceil(7/2)", out: "4"},
+		{in: "ceil(-7/2)", out: "-3"},
+		{in: "trunc(-7/2)", out: "-3"},
+		{in: "round(5/2)", out: "3"},
+		{in: "round(-5/2)", out: "-3"},
+		{in: "round(2.4)", out: "2"},
+		{in: "min(3, 1, 2)", out: "1"},
+		{in: "max(3, 1/2, 7/2)", out: "3.5"},
+		{in: "max(1)", out: "1"},
+		{in: "max()", err: ErrArity},
+		{in: "sin(1, 2)", err: ErrArity},
+		{in: "pow(2, 10)", out: "1024"},
+		{in: "pow(2, -2)", out: "0.25"},
+		{in: "pow(2/3, 2)", out: "4/9"},
+		{in: "pow(4, 0.5)", out: "2"},
+		{in: "pow(0, -1)", err: ErrDivideByZero},
+		{in: "pow(-8, 1/3)", err: ErrDomain},
+		{in: "pow(10, 10000000000)", err: ErrOverflow},
+		{in: "pow(1, 10000000000)", out: "1"},
+		{in: "2 * max(1, sin(0)) + 1", out: "3"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			res, err := Evaluator{Angle: tc.angle}.Eval(tree)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.String() != tc.out {
+				t.Fatalf("out mismatch: expected %v vs %v", tc.out, res)
+			}
+		})
+	}
+}
+
+func TestParseCall(t *testing.T) {
+	tree, err := ParseString("max(1, 2 + 3, min(4))")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	call, ok := tree.(CallNode)
+	if !ok || call.Name != "max" || len(call.Args) != 3 {
+		t.Fatalf("unexpected tree %#v", tree)
+	}
+	if got := Pretty(tree); got != "max(1, 2 + 3, min(4))" {
+		t.Fatalf("unexpected pretty form %q", got)
+	}
+	var perr *ParseError
+	if _, err := ParseString("2 * nope(1)"); !errors.As(err, &perr) || perr.Kind != UnknownFunction || perr.Offset != 4 {
+		t.Fatalf("expected an unknown function error at offset 4, got %v", err)
+	}
+	for _, in := range []string{"max(1,", "max(1,)", "max(1 2)", "max(,1)", "max 1"} {
+		if _, err := ParseString(in); err == nil {
+			t.Errorf("%q: expected a parse error", in)
+		}
+	}
+}
+
+func TestFunctionRegistry(t *testing.T) {
+	reg := DefaultFunctions.Clone()
+	reg.Register("vat", 2, func(ev Evaluator, args []Value) (Value, error) {
+		return ev.binary(OpMultiply, args[0], args[1])
+	})
+	reg.Register("vat", 1, func(ev Evaluator, args []Value) (Value, error) {
+		return ev.binary(OpMultiply, args[0], Rat{big.NewRat(1, 5)})
+	})
+	reg.Register("count", Variadic, func(ev Evaluator, args []Value) (Value, error) {
+		return Int{big.NewInt(int64(len(args)))}, nil
+	})
+	if DefaultFunctions.Has("vat") {
+		t.Fatalf("registering with a clone changed DefaultFunctions")
+	}
+	type testCase struct {
+		in  string
+		out string
+		err error
+	}
+	tcs := []testCase{
+		{in: "vat(100)", out: "20"},
+		{in: "vat(100, 1/4)", out: "25"},
+		{in: "vat(1, 2, 3)", err: ErrArity},
+		{in: "count()", out: "0"},
+		{in: "count(1, 2, 3)", out: "3"},
+		{in: "max(count(1), 2)", out: "2"},
+	}
+	ps := Parser{Functions: reg}
+	ev := Evaluator{Functions: reg}
+	for _, tc := range tcs {
+		tree, err := ps.ParseString(tc.in)
+		if err != nil {
+			t.Fatalf("%q: parse failed: %v", tc.in, err)
+		}
+		res, err := ev.Eval(tree)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("%q: expected %v, got %v", tc.in, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.in, err)
+		}
+		if res.String() != tc.out {
+			t.Fatalf("%q: expected %v got %v", tc.in, tc.out, res)
+		}
+	}
+	// a tree parsed against one registry may name functions another lacks
+	tree, err := ps.ParseString("vat(100)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if _, err := EvalChecked(tree); !errors.Is(err, ErrUnknownFunc) {
+		t.Fatalf("expected %v, got %v", ErrUnknownFunc, err)
+	}
+}
+
+func TestUserFunctions(t *testing.T) {
+	reg := DefaultFunctions.Clone()
+	ps := Parser{Functions: reg}
+	ev := Evaluator{Env: NewEnvironment(), Functions: reg}
+	type step struct {
+		in  string
+		out string
+		err error
+	}
+	steps := []step{
+		{in: "f(x) = x*x + 1", out: "f(x) = x * x + 1"},
+		{in: "f(3)", out: "10"},
+		{in: "a = 2", out: "2"},
+		{in: "g(x, y) = a*x + f(y)", out: "g(x, y) = a * x + f(y)"},
+		{in: "g(1, 2)", out: "7"},
+		{in: "x", err: ErrUndefined},
+		{in: "fact(n) = n + fact(n - 1)", out: "fact(n) = n + fact(n - 1)"},
+		{in: "fact(1)", err: ErrRecursion},
+		{in: "h() = 1/0", out: "h() = 1 / 0"},
+		{in: "h() + 1", err: ErrDivideByZero},
+	}
+	for _, s := range steps {
+		tree, err := ps.ParseString(s.in)
+		if err != nil {
+			t.Fatalf("%q: parse failed: %v", s.in, err)
+		}
+		res, err := ev.Eval(tree)
+		if s.err != nil {
+			if !errors.Is(err, s.err) {
+				t.Fatalf("%q: expected %v, got %v", s.in, s.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", s.in, err)
+		}
+		if res.String() != s.out {
+			t.Fatalf("%q: expected %v got %v", s.in, s.out, res)
+		}
+	}
+	var everr *EvalError
+	tree, _ := ps.ParseString("h()")
+	if _, err := ev.Eval(tree); !errors.As(err, &everr) || Pretty(everr.Node) != "1 / 0" {
+		t.Fatalf("expected the error to point into the body of h, got %v", err)
+	}
+	for _, in := range []string{"f(x,) = x", "f(x y) = x", "k(x) = k2(x)"} {
+		if _, err := ps.ParseString(in); err == nil {
+			t.Errorf("%q: expected a parse error", in)
+		}
+	}
+	// only a head of distinct names defines a function that is not built
+	// in; anything else is an equation
+	for _, in := range []string{"sin(x) = 0.5", "max(1,2) = 2", "f(x, x) = x", "f(1) = 1"} {
+		tree, err := ps.ParseString(in)
+		if err != nil {
+			t.Fatalf("%q: parse failed: %v", in, err)
+		}
+		if _, ok := tree.(EquationNode); !ok {
+			t.Errorf("%q: expected an EquationNode, got %T", in, tree)
+		}
+	}
+	if reg.IsBuiltin("f") || !reg.IsBuiltin("sin") {
+		t.Errorf("expected sin but not f to be built in")
+	}
+	if err := reg.Define(UserFunc{Name: "sin", Params: []string{"x"}, Body: NumberNode{new(big.Rat)}}); !errors.Is(err, ErrBuiltin) {
+		t.Errorf("expected %v, got %v", ErrBuiltin, err)
+	}
+	tree, _ = Parser{Functions: NewFunctionRegistry()}.ParseString("sin(x) = 0")
+	if _, err := ev.Eval(tree); !errors.Is(err, ErrBuiltin) {
+		t.Errorf("expected %v, got %v", ErrBuiltin, err)
+	}
+}
@@ -0,0 +1,340 @@
+package arith
+
+import (
+	"io"
+	"strings"
+	"unicode"
+)
+
+// LexemeKind classifies a Lexeme.
+type LexemeKind uint8
+
+const (
+	// LexToken is a number, identifier or operator.
+	LexToken LexemeKind = iota
+	// LexSpace is a run of whitespace.
+	LexSpace
+	// LexComment is a # and the rest of its line.
+	LexComment
+)
+
+// A Span is the half open range of rune offsets [Start, End) a Lexeme was
+// read from.
+type Span struct {
+	Start, End int
+}
+
+// A Lexeme is a piece of source text. Lexemes of kind LexToken carry the
+// Token they spell; whitespace and comments are kept as lexemes too, so
+// joining the Text of every Lexeme reproduces the source exactly.
+type Lexeme struct {
+	Token
+	Kind LexemeKind
+	Span Span
+	// Text is the source text, e.g. "0xff" or "×" for tokens.
+	Text string
+}
+
+// opSpellings maps the spellings of operators, including Unicode and
+// multi-character aliases, to the operators they spell. Longer spellings
+// are matched first, so "//" is floor division rather than two divisions.
+var opSpellings = map[string]Op{
+	"+":  OpPlus,
+	"-":  OpMinus,
+	"−":  OpMinus,
+	"*":  OpMultiply,
+	"×":  OpMultiply,
+	"·":  OpMultiply,
+	"/":  OpDivide,
+	"÷":  OpDivide,
+	"//": OpFloorDivide,
+	"@":  OpMatMul,
+	"%":  OpModulo,
+	"^":  OpPower,
+	"**": OpPower,
+	"!":  OpFactorial,
+	"&":  OpAnd,
+	"|":  OpOr,
+	"~":  OpNot,
+	"<<": OpShiftLeft,
+	">>": OpShiftRight,
+	"√":  OpSquareRoot,
+	"=":  OpEquals,
+	"(":  OpOpenParen,
+	")":  OpCloseParen,
+	",":  OpComma,
+	"[":  OpOpenBracket,
+	"]":  OpCloseBracket,
+	"∫":  OpIntegral,
+	"Σ":  OpSum,
+	"∑":  OpSum,
+	"Π":  OpProduct,
+	"∏":  OpProduct,
+}
+
+// maxOpSpelling is the length, in runes, of the longest operator spelling.
+const maxOpSpelling = 2
+
+// wordOps are operators spelled like identifiers.
+var wordOps = map[string]Op{
+	"xor": OpXor,
+}
+
+// identAliases are symbols read as identifiers, so "2π" refers to the
+// constant named pi.
+var identAliases = map[rune]string{
+	'π': "pi",
+	'φ': "phi",
+	'τ': "tau",
+}
+
+// A Lexer splits source text into Lexemes.
+type Lexer struct {
+	src    []rune
+	offset int
+	// tokens is the number of LexToken lexemes read so far.
+	tokens int
+}
+
+// NewLexer returns a Lexer reading s.
+func NewLexer(s string) *Lexer {
+	return &Lexer{src: []rune(s)}
+}
+
+// Next returns the next Lexeme. It returns io.EOF at the end of the source
+// and an UnknownCharacter *ParseError for a character that begins no
+// lexeme.
+func (l *Lexer) Next() (Lexeme, error) {
+	rs := l.src[l.offset:]
+	if len(rs) == 0 {
+		return Lexeme{}, io.EOF
+	}
+	var (
+		n    int
+		kind = LexToken
+		tk   Token
+	)
+	if name, ok := identAliases[rs[0]]; ok {
+		n, tk = 1, idTk(name)
+	} else if n = scanSpace(rs); n != 0 {
+		kind = LexSpace
+	} else if n = scanComment(rs); n != 0 {
+		kind = LexComment
+	} else if op, m := scanOp(rs); m != 0 {
+		// operators are scanned before identifiers, since Σ and Π are
+		// letters
+		n, tk = m, oTk(op)
+	} else if n = scanIdent(rs); n != 0 {
+		word := string(rs[:n])
+		if op, ok := wordOps[word]; ok {
+			tk = oTk(op)
+		} else {
+			tk = idTk(word)
+		}
+	} else if n = scanDate(rs); n != 0 {
+		// dates are scanned before numbers, so "2024-03-15" is a date
+		// rather than a difference
+		date, err := ParseDate(string(rs[:n]))
+		if err != nil {
+			return Lexeme{}, err
+		}
+		tk = Token{Date: &date}
+	} else if n = scanNumber(rs); n != 0 {
+		num, err := ParseNumber(string(rs[:n]))
+		if err != nil {
+			return Lexeme{}, err
+		}
+		tk = Token{Number: num}
+	} else {
+		return Lexeme{}, &ParseError{
+			Kind:   UnknownCharacter,
+			Index:  l.tokens,
+			Offset: l.offset,
+			Char:   rs[0],
+		}
+	}
+	lx := Lexeme{
+		Token: tk,
+		Kind:  kind,
+		Span:  Span{Start: l.offset, End: l.offset + n},
+		Text:  string(rs[:n]),
+	}
+	l.offset += n
+	if kind == LexToken {
+		l.tokens++
+	}
+	return lx, nil
+}
+
+// Lex splits s into Lexemes.
+func Lex(s string) ([]Lexeme, error) {
+	l := NewLexer(s)
+	var lexemes []Lexeme
+	for {
+		lx, err := l.Next()
+		if err == io.EOF {
+			return lexemes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		lexemes = append(lexemes, lx)
+	}
+}
+
+// Tokens returns the tokens of lexemes, leaving out whitespace and
+// comments, and the span each token was read from.
+func Tokens(lexemes []Lexeme) ([]Token, []Span) {
+	tks := []Token{}
+	spans := []Span{}
+	for _, lx := range lexemes {
+		if lx.Kind == LexToken {
+			tks = append(tks, lx.Token)
+			spans = append(spans, lx.Span)
+		}
+	}
+	return tks, spans
+}
+
+// Source joins the text of lexemes, reproducing the source they were read
+// from.
+func Source(lexemes []Lexeme) string {
+	var sb strings.Builder
+	for _, lx := range lexemes {
+		sb.WriteString(lx.Text)
+	}
+	return sb.String()
+}
+
+// scanOp returns the operator spelled at the start of rs and the length of
+// its spelling, or a zero length if rs does not start with one.
+func scanOp(rs []rune) (Op, int) {
+	for n := maxOpSpelling; n > 0; n-- {
+		if n > len(rs) {
+			continue
+		}
+		if op, ok := opSpellings[string(rs[:n])]; ok {
+			return op, n
+		}
+	}
+	return "", 0
+}
+
+// scanSpace returns the length of the whitespace at the start of rs.
+func scanSpace(rs []rune) int {
+	i := 0
+	for i < len(rs) && unicode.IsSpace(rs[i]) {
+		i++
+	}
+	return i
+}
+
+// scanComment returns the length of the comment at the start of rs, which
+// runs from a # to the end of its line.
+func scanComment(rs []rune) int {
+	if len(rs) == 0 || rs[0] != '#' {
+		return 0
+	}
+	i := 1
+	for i < len(rs) && rs[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+// scanIdent returns the length of the identifier at the start of rs, or
+// zero if rs does not start with one. Identifiers are a letter followed by
+// letters, digits and underscores.
+func scanIdent(rs []rune) int {
+	if len(rs) == 0 || !unicode.IsLetter(rs[0]) {
+		return 0
+	}
+	i := 1
+	for i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_') {
+		i++
+	}
+	return i
+}
+
+// scanNumber returns the length of the numeric literal at the start of rs,
+// or zero if rs does not start with one. Literals are digits with an
+// optional decimal point and exponent, "12", "2.5", ".5", "3.", "1.2e-3",
+// or integers with a base prefix, "0xff", "0o17", "0b101".
+func scanNumber(rs []rune) int {
+	isDigit := func(i int) bool {
+		return i < len(rs) && rs[i] >= '0' && rs[i] <= '9'
+	}
+	if n := scanPrefixedInt(rs); n != 0 {
+		return n
+	}
+	i := 0
+	for isDigit(i) {
+		i++
+	}
+	digits := i
+	if i < len(rs) && rs[i] == '.' {
+		i++
+		for isDigit(i) {
+			i++
+		}
+		digits += i - digits - 1
+	}
+	if digits == 0 {
+		return 0
+	}
+	if i < len(rs) && (rs[i] == 'e' || rs[i] == 'E') {
+		j := i + 1
+		if j < len(rs) && (rs[j] == '+' || rs[j] == '-') {
+			j++
+		}
+		if isDigit(j) {
+			for isDigit(j) {
+				j++
+			}
+			i = j
+		}
+	}
+	return i
+}
+
+// scanPrefixedInt returns the length of the hexadecimal, octal or binary
+// integer literal at the start of rs, or zero if rs does not start with
+// one.
+func scanPrefixedInt(rs []rune) int {
+	if len(rs) < 3 || rs[0] != '0' {
+		return 0
+	}
+	var base int
+	switch unicode.ToLower(rs[1]) {
+	case 'x':
+		base = 16
+	case 'o':
+		base = 8
+	case 'b':
+		base = 2
+	default:
+		return 0
+	}
+	i := 2
+	for i < len(rs) && digitValue(rs[i]) < base {
+		i++
+	}
+	if i == 2 {
+		return 0
+	}
+	return i
+}
+
+// digitValue is the value of r as a digit in bases up to 16, or 16 if r is
+// not such a digit.
+func digitValue(r rune) int {
+	switch {
+	case r >= '0' && r <= '9':
+		return int(r - '0')
+	case r >= 'a' && r <= 'f':
+		return int(r-'a') + 10
+	case r >= 'A' && r <= 'F':
+		return int(r-'A') + 10
+	}
+	return 16
+}
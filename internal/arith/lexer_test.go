@@ -0,0 +1,97 @@
+package arith
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	src := "2×(x1 − 0xff) // 3 # the rest\n+ 2**3"
+	lexemes, err := Lex(src)
+	if err != nil {
+		t.Fatalf("lex failed: %v", err)
+	}
+	if got := Source(lexemes); got != src {
+		t.Fatalf("round trip mismatch: %q", got)
+	}
+	type want struct {
+		text string
+		kind LexemeKind
+		span Span
+		tk   string
+	}
+	wants := []want{
+		{text: "2", span: Span{0, 1}, tk: "2"},
+		{text: "×", span: Span{1, 2}, tk: "*"},
+		{text: "(", span: Span{2, 3}, tk: "("},
+		{text: "x1", span: Span{3, 5}, tk: "x1"},
+		{text: " ", kind: LexSpace, span: Span{5, 6}},
+		{text: "−", span: Span{6, 7}, tk: "-"},
+		{text: " ", kind: LexSpace, span: Span{7, 8}},
+		{text: "0xff", span: Span{8, 12}, tk: "255"},
+		{text: ")", span: Span{12, 13}, tk: ")"},
+		{text: " ", kind: LexSpace, span: Span{13, 14}},
+		{text: "//", span: Span{14, 16}, tk: "//"},
+		{text: " ", kind: LexSpace, span: Span{16, 17}},
+		{text: "3", span: Span{17, 18}, tk: "3"},
+		{text: " ", kind: LexSpace, span: Span{18, 19}},
+		{text: "# the rest", kind: LexComment, span: Span{19, 29}},
+		{text: "\n", kind: LexSpace, span: Span{29, 30}},
+		{text: "+", span: Span{30, 31}, tk: "+"},
+		{text: " ", kind: LexSpace, span: Span{31, 32}},
+		{text: "2", span: Span{32, 33}, tk: "2"},
+		{text: "**", span: Span{33, 35}, tk: "^"},
+		{text: "3", span: Span{35, 36}, tk: "3"},
+	}
+	if len(lexemes) != len(wants) {
+		t.Fatalf("expected %d lexemes, got %d: %v", len(wants), len(lexemes), lexemes)
+	}
+	for i, w := range wants {
+		lx := lexemes[i]
+		if lx.Text != w.text || lx.Kind != w.kind || lx.Span != w.span {
+			t.Errorf("lexeme %d: expected %q %v %v, got %q %v %v", i, w.text, w.kind, w.span, lx.Text, lx.Kind, lx.Span)
+		}
+		if lx.Kind == LexToken && lx.Token.String() != w.tk {
+			t.Errorf("lexeme %d: expected token %q, got %q", i, w.tk, lx.Token.String())
+		}
+	}
+	tks, spans := Tokens(lexemes)
+	if len(tks) != 13 || len(spans) != len(tks) || spans[12] != (Span{35, 36}) {
+		t.Fatalf("unexpected tokens %v at %v", tks, spans)
+	}
+}
+
+func TestLexAliases(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+	}
+	for _, tc := range []testCase{
+		{in: "6 ÷ 4 × 2", out: "6 / 4 * 2"},
+		{in: "2·π", out: "2 * π"},
+		{in: "−√4", out: "-√4"},
+		{in: "2**3**2", out: "2 ^ 3 ^ 2"},
+		{in: "6 xor 3 # comment", out: "6 xor 3"},
+	} {
+		tree, err := ParseString(tc.in)
+		if err != nil {
+			t.Errorf("%q: parse failed: %v", tc.in, err)
+			continue
+		}
+		if got := Pretty(tree); got != tc.out {
+			t.Errorf("%q: expected %q, got %q", tc.in, tc.out, got)
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	l := NewLexer("1 + $")
+	var err error
+	for i := 0; i < 5 && err == nil; i++ {
+		_, err = l.Next()
+	}
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Kind != UnknownCharacter || perr.Offset != 4 || perr.Index != 2 || perr.Char != '$' {
+		t.Fatalf("expected an unknown character error at offset 4, got %v", err)
+	}
+}
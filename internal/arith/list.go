@@ -0,0 +1,90 @@
+package arith
+
+// A List is a sequence of values, as in "[1, 2, 3]". Arithmetic on lists
+// applies element by element, and functions of one argument apply to each
+// element.
+type List []Value
+
+// String writes l as it would be parsed, as in "[1, 2.5, 3]".
+func (l List) String() string {
+	return Formatter{}.Format(l)
+}
+
+// isList reports whether any of vals is a List.
+func isList(vals ...Value) bool {
+	for _, v := range vals {
+		if _, ok := v.(List); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// mapList returns the List of fn applied to each element of l.
+func mapList(l List, fn func(Value) (Value, error)) (Value, error) {
+	res := make(List, len(l))
+	for i, v := range l {
+		var err error
+		if res[i], err = fn(v); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// elementwise applies fn to v, or to each element of v if it is a List.
+func elementwise(ev Evaluator, v Value, fn func(Evaluator, Value) (Value, error)) (Value, error) {
+	l, ok := v.(List)
+	if !ok {
+		return fn(ev, v)
+	}
+	return mapList(l, func(e Value) (Value, error) {
+		return elementwise(ev, e, fn)
+	})
+}
+
+// listBinary applies an operator element by element where either operand
+// is a List. Between a List and another value the operator applies to
+// each element and the value, so "[1, 2] * 3" is [3, 6]; two Lists must
+// be the same length.
+func (ev Evaluator) listBinary(op Op, lhs, rhs Value) (Value, error) {
+	l, lok := lhs.(List)
+	r, rok := rhs.(List)
+	if lok && rok && len(l) != len(r) {
+		return nil, ErrLength
+	}
+	n := len(l)
+	if !lok {
+		n = len(r)
+	}
+	res := make(List, n)
+	for i := range res {
+		a, b := lhs, rhs
+		if lok {
+			a = l[i]
+		}
+		if rok {
+			b = r[i]
+		}
+		var err error
+		if res[i], err = ev.binary(op, a, b); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// flatten returns the elements of vals, and of any Lists among them, in
+// order, so the statistical functions take "mean([1, 2], 3)" as three
+// values.
+func flatten(vals []Value) []Value {
+	var res []Value
+	for _, v := range vals {
+		if l, ok := v.(List); ok {
+			res = append(res, flatten(l)...)
+		} else {
+			res = append(res, v)
+		}
+	}
+	return res
+}
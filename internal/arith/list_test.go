@@ -0,0 +1,59 @@
+package arith
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLists(t *testing.T) {
+	type testCase struct {
+		in     string
+		pretty string
+		out    string
+		err    error
+	}
+	tcs := []testCase{
+		{in: "[]", pretty: "[]", out: "[]"},
+		{in: "[1,2 , 3]", pretty: "[1, 2, 3]", out: "[1, 2, 3]"},
+		{in: "[1, [2, 3]]", pretty: "[1, [2, 3]]", out: "[1, [2, 3]]"},
+		{in: "[1, 2, 3] * 2", pretty: "[1, 2, 3] * 2", out: "[2, 4, 6]"},
+		{in: "10 - [1, 2]", pretty: "10 - [1, 2]", out: "[9, 8]"},
+		{in: "[1, 2] + [3, 4]", pretty: "[1, 2] + [3, 4]", out: "[4, 6]"},
+		{in: "[[1, 2], [3, 4]] * 2", pretty: "[[1, 2], [3, 4]] * 2", out: "[[2, 4], [6, 8]]"},
+		{in: "[1, 2] + 10%", pretty: "[1, 2] + 10%", out: "[1.1, 2.2]"},
+		{in: "-[1, 2]", pretty: "-[1, 2]", out: "[-1, -2]"},
+		{in: "[3, 4]!", pretty: "[3, 4]!", out: "[6, 24]"},
+		{in: "sin([0, 0])", pretty: "sin([0, 0])", out: "[0, 0]"},
+		{in: "log([10, 100])", pretty: "log([10, 100])", out: "[1, 2]"},
+		{in: "max([1, 5], 3)", pretty: "max([1, 5], 3)", out: "5"},
+		{in: "[1 km, 500 m] to m", pretty: "[1 km, 500 m] to m", out: "[1000 m, 500 m]"},
+		{in: "[1, 2] + [1]", err: ErrLength},
+		{in: "log([10], 2)", err: ErrDomain},
+		{in: "max([])", err: ErrDomain},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := Parser{Units: DefaultUnits}.ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			v, err := EvalChecked(tree)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := Pretty(tree); got != tc.pretty {
+				t.Errorf("pretty mismatch: expected %v got %v", tc.pretty, got)
+			}
+			if got := v.String(); got != tc.out {
+				t.Fatalf("expected %v, got %v", tc.out, got)
+			}
+		})
+	}
+}
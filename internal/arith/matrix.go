@@ -0,0 +1,411 @@
+package arith
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// A vector is a List of numbers, as in "[1, 2, 3]", and a matrix a List
+// of its rows, as in "[[1, 2], [3, 4]]". Arithmetic operators apply to
+// them element by element; OpMatMul and the matrix functions treat them
+// as linear algebra. Entries may be any number or quantity, and exact
+// entries give exact results, so "inv([[2, 1], [1, 1]])" is
+// [[1, -1], [-1, 2]].
+
+// maxMatrixSize is the largest number of rows identity will create.
+const maxMatrixSize = 1000
+
+// A Shape is the length of each dimension of a value: none for a number,
+// its length for a vector, and its rows and columns for a matrix.
+type Shape []int
+
+// String writes s as its lengths joined by "×", as in "2×3", or "scalar"
+// for a number.
+func (s Shape) String() string {
+	if len(s) == 0 {
+		return "scalar"
+	}
+	strs := make([]string, len(s))
+	for i, n := range s {
+		strs[i] = strconv.Itoa(n)
+	}
+	return strings.Join(strs, "×")
+}
+
+// shapeOf returns the shape of v. A List whose elements are not all of
+// one shape has just its own length.
+func shapeOf(v Value) Shape {
+	l, ok := v.(List)
+	if !ok {
+		return Shape{}
+	}
+	s := Shape{len(l)}
+	if len(l) == 0 {
+		return s
+	}
+	inner := shapeOf(l[0])
+	for _, e := range l[1:] {
+		other := shapeOf(e)
+		if len(other) != len(inner) {
+			return s
+		}
+		for i := range inner {
+			if other[i] != inner[i] {
+				return s
+			}
+		}
+	}
+	return append(s, inner...)
+}
+
+// asVector returns v if it is a vector: a non-empty List of values that
+// are not Lists.
+func asVector(v Value) (List, bool) {
+	l, ok := v.(List)
+	if !ok || len(l) == 0 || isList(l...) {
+		return nil, false
+	}
+	return l, true
+}
+
+// asMatrix returns the rows of v if it is a matrix: a non-empty List of
+// vectors of the same length.
+func asMatrix(v Value) ([]List, bool) {
+	l, ok := v.(List)
+	if !ok || len(l) == 0 {
+		return nil, false
+	}
+	rows := make([]List, len(l))
+	for i, e := range l {
+		row, ok := asVector(e)
+		if !ok || (i > 0 && len(row) != len(rows[0])) {
+			return nil, false
+		}
+		rows[i] = row
+	}
+	return rows, true
+}
+
+// asSquare returns the rows of v if it is a square matrix.
+func asSquare(v Value) ([]List, error) {
+	rows, ok := asMatrix(v)
+	if !ok || len(rows) != len(rows[0]) {
+		return nil, &ShapeError{LHS: shapeOf(v)}
+	}
+	return rows, nil
+}
+
+// matrixValue returns rows as a List.
+func matrixValue(rows []List) List {
+	res := make(List, len(rows))
+	for i, row := range rows {
+		res[i] = row
+	}
+	return res
+}
+
+// columnMatrix returns the rows of the matrix with the single column v.
+func columnMatrix(v List) []List {
+	rows := make([]List, len(v))
+	for i, e := range v {
+		rows[i] = List{e}
+	}
+	return rows
+}
+
+// identity returns the rows of the n×n identity matrix.
+func identity(n int) []List {
+	rows := make([]List, n)
+	for i := range rows {
+		rows[i] = make(List, n)
+		for j := range rows[i] {
+			rows[i][j] = Int{new(big.Int)}
+		}
+		rows[i][i] = Int{big.NewInt(1)}
+	}
+	return rows
+}
+
+// column returns column j of a matrix.
+func column(rows []List, j int) List {
+	col := make(List, len(rows))
+	for i, row := range rows {
+		col[i] = row[j]
+	}
+	return col
+}
+
+// isZeroEntry reports whether v is zero, with or without a unit.
+func isZeroEntry(v Value) bool {
+	return isZero(toQuantity(v).Value)
+}
+
+// dot returns the sum of the products of the elements of two vectors of
+// the same length.
+func (ev Evaluator) dot(u, v List) (Value, error) {
+	prod, err := ev.listBinary(OpMultiply, u, v)
+	if err != nil {
+		return nil, err
+	}
+	return ev.sum(prod.(List))
+}
+
+// matMul is the matrix product lhs @ rhs. A vector on the left is a row
+// and on the right a column, so a vector times a matrix or a matrix times
+// a vector is a vector and a vector times a vector is their dot product.
+func (ev Evaluator) matMul(lhs, rhs Value) (Value, error) {
+	shapeErr := &ShapeError{LHS: shapeOf(lhs), RHS: shapeOf(rhs)}
+	a, aok := asMatrix(lhs)
+	b, bok := asMatrix(rhs)
+	u, uok := asVector(lhs)
+	v, vok := asVector(rhs)
+	switch {
+	case aok && bok && len(a[0]) == len(b):
+		res := make([]List, len(a))
+		for i, row := range a {
+			prod, err := ev.matMul(row, rhs)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = prod.(List)
+		}
+		return matrixValue(res), nil
+	case aok && vok && len(a[0]) == len(v):
+		res := make(List, len(a))
+		for i, row := range a {
+			var err error
+			if res[i], err = ev.dot(row, v); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case uok && bok && len(u) == len(b):
+		res := make(List, len(b[0]))
+		for j := range res {
+			var err error
+			if res[j], err = ev.dot(u, column(b, j)); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case uok && vok && len(u) == len(v):
+		return ev.dot(u, v)
+	}
+	return nil, shapeErr
+}
+
+// transposeFunc is transpose(m), the matrix whose rows are the columns of
+// m. A vector is transposed to a matrix of one column.
+func transposeFunc(ev Evaluator, args []Value) (Value, error) {
+	if v, ok := asVector(args[0]); ok {
+		return matrixValue(columnMatrix(v)), nil
+	}
+	rows, ok := asMatrix(args[0])
+	if !ok {
+		return nil, &ShapeError{LHS: shapeOf(args[0])}
+	}
+	res := make([]List, len(rows[0]))
+	for j := range res {
+		res[j] = column(rows, j)
+	}
+	return matrixValue(res), nil
+}
+
+// pivot returns the row at or below row col with the entry in column col
+// to eliminate with, or -1 if those entries are all zero. Of real entries
+// it picks the largest, which keeps floating point elimination accurate.
+func pivot(rows []List, col int) int {
+	best := -1
+	var bestAbs *big.Rat
+	for i := col; i < len(rows); i++ {
+		e := rows[i][col]
+		if isZeroEntry(e) {
+			continue
+		}
+		if !isReal(e) {
+			if best < 0 {
+				best = i
+			}
+			continue
+		}
+		if abs := new(big.Rat).Abs(toRat(e)); bestAbs == nil || abs.Cmp(bestAbs) > 0 {
+			best, bestAbs = i, abs
+		}
+	}
+	return best
+}
+
+// gaussJordan reduces the square matrix a to the identity by row
+// operations, applying each operation to the rows of b too, and returns
+// the determinant of a and what b becomes: a⁻¹b. b may be nil. It reports
+// ErrSingular, with a determinant of zero, if a has no inverse. Neither
+// matrix is changed.
+func (ev Evaluator) gaussJordan(a, b []List) (Value, []List, error) {
+	n := len(a)
+	rows := make([]List, n)
+	for i := range rows {
+		rows[i] = append(List{}, a[i]...)
+		if b != nil {
+			rows[i] = append(rows[i], b[i]...)
+		}
+	}
+	var det Value = Int{big.NewInt(1)}
+	for col := 0; col < n; col++ {
+		p := pivot(rows, col)
+		if p < 0 {
+			return Int{new(big.Int)}, nil, ErrSingular
+		}
+		var err error
+		if p != col {
+			rows[p], rows[col] = rows[col], rows[p]
+			if det, err = ev.unary(OpMinus, det); err != nil {
+				return nil, nil, err
+			}
+		}
+		pv := rows[col][col]
+		if det, err = ev.binary(OpMultiply, det, pv); err != nil {
+			return nil, nil, err
+		}
+		scaled, err := ev.binary(OpDivide, rows[col], pv)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows[col] = scaled.(List)
+		for i, row := range rows {
+			f := row[col]
+			if i == col || isZeroEntry(f) {
+				continue
+			}
+			sub, err := ev.binary(OpMultiply, rows[col], f)
+			if err != nil {
+				return nil, nil, err
+			}
+			if sub, err = ev.binary(OpMinus, row, sub); err != nil {
+				return nil, nil, err
+			}
+			rows[i] = sub.(List)
+		}
+	}
+	for i, row := range rows {
+		rows[i] = row[n:]
+	}
+	return det, rows, nil
+}
+
+// detFunc is det(m), the determinant of a square matrix.
+func detFunc(ev Evaluator, args []Value) (Value, error) {
+	rows, err := asSquare(args[0])
+	if err != nil {
+		return nil, err
+	}
+	det, _, err := ev.gaussJordan(rows, nil)
+	if errors.Is(err, ErrSingular) {
+		return det, nil
+	}
+	return det, err
+}
+
+// invFunc is inv(m), the inverse of a square matrix.
+func invFunc(ev Evaluator, args []Value) (Value, error) {
+	rows, err := asSquare(args[0])
+	if err != nil {
+		return nil, err
+	}
+	_, inv, err := ev.gaussJordan(rows, identity(len(rows)))
+	if err != nil {
+		return nil, err
+	}
+	return matrixValue(inv), nil
+}
+
+// linsolveFunc is linsolve(a, b), the solution x of the linear system
+// a @ x = b for a square matrix a. b may be a vector, giving a vector, or
+// a matrix, giving the solutions for each of its columns.
+func linsolveFunc(ev Evaluator, args []Value) (Value, error) {
+	rows, err := asSquare(args[0])
+	if err != nil {
+		return nil, err
+	}
+	shapeErr := &ShapeError{LHS: shapeOf(args[0]), RHS: shapeOf(args[1])}
+	if v, ok := asVector(args[1]); ok {
+		if len(v) != len(rows) {
+			return nil, shapeErr
+		}
+		_, x, err := ev.gaussJordan(rows, columnMatrix(v))
+		if err != nil {
+			return nil, err
+		}
+		return column(x, 0), nil
+	}
+	b, ok := asMatrix(args[1])
+	if !ok || len(b) != len(rows) {
+		return nil, shapeErr
+	}
+	_, x, err := ev.gaussJordan(rows, b)
+	if err != nil {
+		return nil, err
+	}
+	return matrixValue(x), nil
+}
+
+// traceFunc is trace(m), the sum of the diagonal of a square matrix.
+func traceFunc(ev Evaluator, args []Value) (Value, error) {
+	rows, err := asSquare(args[0])
+	if err != nil {
+		return nil, err
+	}
+	diag := make([]Value, len(rows))
+	for i, row := range rows {
+		diag[i] = row[i]
+	}
+	return ev.sum(diag)
+}
+
+// identityFunc is identity(n), the n×n identity matrix.
+func identityFunc(ev Evaluator, args []Value) (Value, error) {
+	n, ok := args[0].(Int)
+	if !ok || n.Sign() <= 0 || n.Cmp(big.NewInt(maxMatrixSize)) > 0 {
+		return nil, ErrDomain
+	}
+	return matrixValue(identity(int(n.Int64()))), nil
+}
+
+// dotFunc is dot(u, v), the dot product of two vectors of the same
+// length.
+func dotFunc(ev Evaluator, args []Value) (Value, error) {
+	u, uok := asVector(args[0])
+	v, vok := asVector(args[1])
+	if !uok || !vok || len(u) != len(v) {
+		return nil, &ShapeError{LHS: shapeOf(args[0]), RHS: shapeOf(args[1])}
+	}
+	return ev.dot(u, v)
+}
+
+// crossFunc is cross(u, v), the cross product of two vectors of length
+// three.
+func crossFunc(ev Evaluator, args []Value) (Value, error) {
+	u, uok := asVector(args[0])
+	v, vok := asVector(args[1])
+	if !uok || !vok || len(u) != 3 || len(v) != 3 {
+		return nil, &ShapeError{LHS: shapeOf(args[0]), RHS: shapeOf(args[1])}
+	}
+	res := make(List, 3)
+	for i := range res {
+		// the 2×2 determinant of the other two components
+		j, k := (i+1)%3, (i+2)%3
+		a, err := ev.binary(OpMultiply, u[j], v[k])
+		if err != nil {
+			return nil, err
+		}
+		b, err := ev.binary(OpMultiply, u[k], v[j])
+		if err != nil {
+			return nil, err
+		}
+		if res[i], err = ev.binary(OpMinus, a, b); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,106 @@
+package arith
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMatrices(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+		err error
+	}
+	tcs := []testCase{
+		{in: "[[1, 2], [3, 4]] @ [[5, 6], [7, 8]]", out: "[[19, 22], [43, 50]]"},
+		{in: "[[1, 2], [3, 4]] * [[5, 6], [7, 8]]", out: "[[5, 12], [21, 32]]"},
+		{in: "[[1, 2], [3, 4]] @ [5, 6]", out: "[17, 39]"},
+		{in: "[1, 2] @ [[1, 2], [3, 4]]", out: "[7, 10]"},
+		{in: "[1, 2, 3] @ [4, 5, 6]", out: "32"},
+		{in: "[[1, 2], [3, 4]] @ [[1, 2], [3, 4]] @ [1, 1]", out: "[17, 37]"},
+		{in: "transpose([[1, 2, 3], [4, 5, 6]])", out: "[[1, 4], [2, 5], [3, 6]]"},
+		{in: "transpose([1, 2])", out: "[[1], [2]]"},
+		{in: "det([[1, 2], [3, 4]])", out: "-2"},
+		{in: "det([[0, 1], [1, 0]])", out: "-1"},
+		{in: "det([[1, 2], [2, 4]])", out: "0"},
+		{in: "det([[2, 0, 1], [1, 3, 2], [1, 1, 2]])", out: "6"},
+		{in: "det([[1 m, 0], [0, 2 m]])", out: "2 m^2"},
+		{in: "inv([[2, 1], [1, 1]])", out: "[[1, -1], [-1, 2]]"},
+		{in: "inv([[1, 2], [3, 4]])", out: "[[-2, 1], [1.5, -0.5]]"},
+		{in: "linsolve([[2, 1], [1, 3]], [3, 5])", out: "[0.8, 1.4]"},
+		{in: "linsolve([[2, 1], [1, 3]], [[3, 1], [5, 0]])", out: "[[0.8, 0.6], [1.4, -0.2]]"},
+		{in: "trace([[1, 2], [3, 4]])", out: "5"},
+		{in: "identity(2)", out: "[[1, 0], [0, 1]]"},
+		{in: "dot([1, 2], [3, 4])", out: "11"},
+		{in: "cross([1, 0, 0], [0, 1, 0])", out: "[0, 0, 1]"},
+		{in: "[[1, 2]] @ [[1, 2]]", err: &ShapeError{}},
+		{in: "2 @ 3", err: &ShapeError{}},
+		{in: "[[1, 2], [3]] @ [1, 2]", err: &ShapeError{}},
+		{in: "det([[1, 2, 3]])", err: &ShapeError{}},
+		{in: "transpose(3)", err: &ShapeError{}},
+		{in: "linsolve([[2, 1], [1, 3]], [3])", err: &ShapeError{}},
+		{in: "dot([1, 2], [1, 2, 3])", err: &ShapeError{}},
+		{in: "cross([1, 2], [3, 4])", err: &ShapeError{}},
+		{in: "inv([[1, 2], [2, 4]])", err: ErrSingular},
+		{in: "linsolve([[1, 2], [2, 4]], [1, 2])", err: ErrSingular},
+		{in: "identity(0)", err: ErrDomain},
+		{in: "[[1, 2], [3, 4]] + [[1, 2]]", err: ErrLength},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := Parser{Units: DefaultUnits}.ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			v, err := EvalChecked(tree)
+			if tc.err != nil {
+				var serr *ShapeError
+				if errors.As(tc.err, &serr) {
+					if !errors.As(err, &serr) {
+						t.Fatalf("expected a ShapeError, got %v", err)
+					}
+				} else if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := v.String(); got != tc.out {
+				t.Fatalf("expected %v, got %v", tc.out, got)
+			}
+		})
+	}
+}
+
+func TestShapeError(t *testing.T) {
+	for _, c := range []struct {
+		err  *ShapeError
+		want string
+	}{
+		{&ShapeError{LHS: Shape{2, 3}, RHS: Shape{2}}, "incompatible shapes 2×3 and 2"},
+		{&ShapeError{LHS: Shape{}, RHS: Shape{1, 2}}, "incompatible shapes scalar and 1×2"},
+		{&ShapeError{LHS: Shape{1, 3}}, "wrong shape 1×3"},
+	} {
+		if got := c.err.Error(); got != c.want {
+			t.Errorf("expected %v, got %v", c.want, got)
+		}
+	}
+}
+
+func TestMatrixFloat(t *testing.T) {
+	tree, err := ParseString("[[4, 3], [6, 3]] @ inv([[4, 3], [6, 3]])")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	v, err := Evaluator{Backend: BackendFloat}.Eval(tree)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f := Formatter{Notation: NotationFixed, DecimalPlaces: 6}
+	if got := f.Format(v); got != "[[1.000000, 0.000000], [0.000000, 1.000000]]" {
+		t.Fatalf("expected the identity, got %v", got)
+	}
+}
@@ -0,0 +1,663 @@
+package arith
+
+import (
+	"math/big"
+)
+
+// productions
+// eq =
+//   eq binop eq
+//   ( eq )
+//   unop eq
+//   eq postop
+//   numeral
+//   date
+//   list
+// binop = - | + | * | / | // | % | ^ | & | "|" | xor | << | >>
+// unop = - | √ | ~
+// postop = ! | %
+// call = identifier ( ) | identifier ( args )
+// args = eq | eq , args
+// list = [ ] | [ args ]
+// range = rangeop ( eq , identifier , eq , eq )
+// rangeop = ∫ | Σ | Π
+//
+// constant = identifier, if registered as a constant
+// unit = identifier, if the Parser has a UnitRegistry holding it
+// convert = eq in eq | eq to eq, if the Parser has a UnitRegistry
+//
+// assign = identifier = eq
+// define = identifier ( ) = eq | identifier ( params ) = eq
+// params = identifier | identifier , params
+//
+// equation = eq = eq
+//
+// start = assign | define | equation | eq
+//
+// Calls may only name functions in the Parser's FunctionRegistry, or the
+// function a definition is defining. The identifier of a range may not
+// name a constant. A numeral followed by a unit is a single operand, so
+// "100 km / 2 h" is a speed, juxtaposed quantities are a parenthesized
+// sum, so "3d 4h" is (3 d + 4 h), and conversions bind more loosely than
+// any operator, so "5 km + 300 m to mi" converts the sum.
+//
+// Juxtaposed operands multiply, as in "2(3+4)"; see isImplicitMultiply.
+// % is a postop unless an operand follows it. Binary and postfix
+// operators are resolved by precedence climbing against the
+// binaryOps table, so "2*3+4" is (2*3)+4 and "10-3-2" is (10-3)-2.
+
+// A Parser builds syntax trees. The zero Parser recognises calls to
+// DefaultFunctions and the constants in DefaultConstants.
+type Parser struct {
+	// Functions holds the functions calls may name. Nil means
+	// DefaultFunctions.
+	Functions *FunctionRegistry
+	// Constants holds the names read as constants rather than variables.
+	// Nil means DefaultConstants.
+	Constants *ConstantRegistry
+	// Units holds the names read as units, and enables the in and to
+	// conversion keywords. Nil means no units, leaving names such as m and
+	// s free for variables; set it to DefaultUnits for the usual ones.
+	Units *UnitRegistry
+	// Equations reads every = as an equation, so "x = 3" and "f(x) = 1"
+	// are equations to solve rather than an assignment and a definition.
+	Equations bool
+}
+
+// Parse builds a syntax tree from a sequence of tokens with the zero
+// Parser.
+func Parse(tokens []Token) (Node, error) {
+	return Parser{}.Parse(tokens)
+}
+
+// Parse builds a syntax tree from a sequence of tokens. Malformed input
+// is reported as a *ParseError.
+func (ps Parser) Parse(tokens []Token) (tree Node, err error) {
+	if len(tokens) == 0 {
+		return nil, &ParseError{
+			Kind:     UnexpectedEnd,
+			Offset:   -1,
+			Expected: operandExpected(),
+		}
+	}
+	p := &parser{tokens: tokens, functions: ps.Functions, constants: ps.Constants, units: ps.Units}
+	if p.functions == nil {
+		p.functions = DefaultFunctions
+	}
+	if p.constants == nil {
+		p.constants = DefaultConstants
+	}
+	var assignTo *string
+	var def *FunctionDefNode
+	switch {
+	case ps.Equations:
+	case len(tokens) > 1 && tokens[0].Ident != nil && tokens[1].is(OpEquals):
+		if _, ok := p.constants.Lookup(*tokens[0].Ident); ok {
+			return nil, p.errorf(AssignToConstant, Expected{})
+		}
+		if p.isUnit(0) {
+			return nil, p.errorf(AssignToUnit, Expected{})
+		}
+		assignTo = tokens[0].Ident
+		p.i = 2
+	case p.isDefinition():
+		def = p.parseDefinitionHead()
+		p.defining = def.Name
+		p.params = make(map[string]bool, len(def.Params))
+		for _, param := range def.Params {
+			p.params[param] = true
+		}
+	}
+	tree, err = p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if tk, ok := p.peek(); ok && tk.is(OpEquals) && assignTo == nil && def == nil {
+		p.i++
+		rhs, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		tree = EquationNode{LHS: tree, RHS: rhs}
+	}
+	if tk, ok := p.peek(); ok {
+		kind := UnexpectedToken
+		switch {
+		case tk.is(OpCloseParen):
+			kind = UnbalancedParen
+		case tk.is(OpCloseBracket):
+			kind = UnbalancedBracket
+		}
+		return nil, p.errorf(kind, operatorExpected())
+	}
+	switch {
+	case assignTo != nil:
+		tree = AssignNode{
+			Name:  *assignTo,
+			Value: tree,
+		}
+	case def != nil:
+		def.Body = tree
+		tree = *def
+	}
+	return tree, nil
+}
+
+type parser struct {
+	tokens []Token
+	i      int
+	// depth is the number of currently open parentheses.
+	depth     int
+	functions *FunctionRegistry
+	constants *ConstantRegistry
+	units     *UnitRegistry
+	// defining is the name of the function whose body is being parsed,
+	// which the body may call before it is registered. params are its
+	// parameters, which hide constants of the same name.
+	defining string
+	params   map[string]bool
+}
+
+func (p *parser) peek() (Token, bool) {
+	if p.i >= len(p.tokens) {
+		return Token{}, false
+	}
+	return p.tokens[p.i], true
+}
+
+// errorf reports an error at the current token.
+func (p *parser) errorf(kind ParseErrorKind, expected Expected) *ParseError {
+	return p.errorAt(p.i, kind, expected)
+}
+
+func (p *parser) errorAt(i int, kind ParseErrorKind, expected Expected) *ParseError {
+	err := &ParseError{
+		Kind:     kind,
+		Index:    i,
+		Offset:   -1,
+		Expected: expected,
+	}
+	if i < len(p.tokens) {
+		tk := p.tokens[i]
+		err.Token = &tk
+	}
+	return err
+}
+
+// parseExpr parses an expression whose binary operators all bind at least
+// as tightly as minBinding.
+func (p *parser) parseExpr(minBinding int) (Node, error) {
+	lhs, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tk, ok := p.peek()
+		if !ok {
+			break
+		}
+		if p.isConversion() {
+			if minBinding > 0 {
+				break
+			}
+			p.i++
+			// binding tighter than a conversion, so "a to b to c"
+			// converts twice
+			unit, err := p.parseExpr(1)
+			if err != nil {
+				return nil, err
+			}
+			lhs = ConvertNode{Value: lhs, Unit: unit}
+			continue
+		}
+		if p.isImplicitMultiply() {
+			prec, _ := OpMultiply.BinaryPrecedence()
+			if prec.Binding < minBinding {
+				break
+			}
+			rhs, err := p.parseExpr(prec.Binding + 1)
+			if err != nil {
+				return nil, err
+			}
+			lhs = BinaryOpNode{
+				LHS: lhs,
+				Op:  OpMultiply,
+				RHS: rhs,
+			}
+			continue
+		}
+		if tk.Op == nil {
+			break
+		}
+		if prec, ok := tk.Op.PostfixPrecedence(); ok && p.isPostfix() {
+			if prec.Binding < minBinding {
+				break
+			}
+			p.i++
+			lhs = PostfixOpNode{
+				Inner: lhs,
+				Op:    *tk.Op,
+			}
+			continue
+		}
+		prec, ok := tk.Op.BinaryPrecedence()
+		if !ok || prec.Binding < minBinding {
+			break
+		}
+		p.i++
+		next := prec.Binding + 1
+		if prec.Assoc == AssocRight {
+			next = prec.Binding
+		}
+		rhs, err := p.parseExpr(next)
+		if err != nil {
+			return nil, err
+		}
+		lhs = BinaryOpNode{
+			LHS: lhs,
+			Op:  *tk.Op,
+			RHS: rhs,
+		}
+	}
+	return lhs, nil
+}
+
+// conversionWords are the identifiers that begin a conversion when the
+// parser reads units.
+var conversionWords = map[string]bool{
+	"in": true,
+	"to": true,
+}
+
+// isConversion reports whether the current token is a conversion keyword,
+// as in "2 GiB in MB".
+func (p *parser) isConversion() bool {
+	tk := p.tokens[p.i]
+	return p.units != nil && tk.Ident != nil && conversionWords[*tk.Ident]
+}
+
+// isUnit reports whether the token at index i names a unit.
+func (p *parser) isUnit(i int) bool {
+	if i >= len(p.tokens) || p.units == nil {
+		return false
+	}
+	tk := p.tokens[i]
+	if tk.Ident == nil || p.params[*tk.Ident] {
+		return false
+	}
+	if next := i + 1; next < len(p.tokens) && p.tokens[next].is(OpOpenParen) {
+		return false
+	}
+	if _, ok := p.constants.Lookup(*tk.Ident); ok {
+		return false
+	}
+	_, ok := p.units.Lookup(*tk.Ident)
+	return ok
+}
+
+// isImplicitMultiply reports whether the current token begins an operand
+// multiplied by the one before it, as written on paper: a number or
+// closing parenthesis followed by an opening parenthesis, an identifier, a
+// root or a range operator, as in "2(3+4)", "2x", "3√4" and "(1+2)(3+4)".
+func (p *parser) isImplicitMultiply() bool {
+	if p.i == 0 || p.i >= len(p.tokens) {
+		return false
+	}
+	prev, tk := p.tokens[p.i-1], p.tokens[p.i]
+	if prev.Number == nil && !prev.is(OpCloseParen) {
+		return false
+	}
+	return tk.Ident != nil || tk.is(OpOpenParen) || tk.is(OpSquareRoot) || (tk.Op != nil && tk.Op.IsRange())
+}
+
+// isPostfix reports whether the current token, a postfix operator, applies
+// to the operand before it. An operator that is also binary, like %, is
+// only postfix when no operand follows it: "7 % 2" is a remainder while
+// "10% + 5" and "10%" are percentages. An operator that is also binary,
+// like -, does not begin an operand, so "10% - 2" is a percentage too, and
+// a negative divisor is written "7 % (-2)".
+func (p *parser) isPostfix() bool {
+	if !p.tokens[p.i].Op.IsBinary() || p.i+1 == len(p.tokens) {
+		return true
+	}
+	next := p.tokens[p.i+1]
+	beginsOperand := next.Number != nil || next.Ident != nil || next.Date != nil || next.is(OpOpenParen) || next.is(OpOpenBracket) ||
+		(next.Op != nil && (next.Op.IsRange() || next.Op.IsUnary() && !next.Op.IsBinary()))
+	return !beginsOperand
+}
+
+// parsePrefix parses a single operand: a number, a parenthesized
+// expression, a list, a range, or a unary operator applied to an operand.
+func (p *parser) parsePrefix() (Node, error) {
+	tk, ok := p.peek()
+	if !ok {
+		// Parse rejects empty input up front, so something came before
+		// this and it must have been an operator.
+		return nil, p.errorf(TrailingOperator, operandExpected())
+	}
+	switch {
+	case tk.Number != nil:
+		if !p.isUnit(p.i + 1) {
+			p.i++
+			return NumberNode{new(big.Rat).Set(tk.Number)}, nil
+		}
+		// a number and its unit are one operand, so "100 km / 2 h" is a
+		// speed, and juxtaposed quantities are a sum, as in "3d 4h"
+		sum, err := p.parseQuantity()
+		if err != nil {
+			return nil, err
+		}
+		if !p.continuesQuantity() {
+			return sum, nil
+		}
+		for p.continuesQuantity() {
+			q, err := p.parseQuantity()
+			if err != nil {
+				return nil, err
+			}
+			sum = BinaryOpNode{LHS: sum, Op: OpPlus, RHS: q}
+		}
+		return ParenWrappedNode{Inner: sum}, nil
+	case tk.Date != nil:
+		p.i++
+		return DateNode{*tk.Date}, nil
+	case tk.Ident != nil:
+		p.i++
+		if next, ok := p.peek(); ok && next.is(OpOpenParen) {
+			if *tk.Ident != p.defining && !p.functions.Has(*tk.Ident) {
+				return nil, p.errorAt(p.i-1, UnknownFunction, Expected{})
+			}
+			return p.parseCall(*tk.Ident)
+		}
+		if c, ok := p.constants.Lookup(*tk.Ident); ok && !p.params[*tk.Ident] {
+			return ConstantNode{Name: *tk.Ident, Symbol: c.Symbol}, nil
+		}
+		if p.units != nil && !p.params[*tk.Ident] {
+			if _, ok := p.units.Lookup(*tk.Ident); ok {
+				return UnitNode{Name: *tk.Ident}, nil
+			}
+		}
+		return VariableNode{Name: *tk.Ident}, nil
+	case tk.Op != nil && *tk.Op == OpOpenParen:
+		open := p.i
+		p.i++
+		p.depth++
+		inner, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		closing, ok := p.peek()
+		if !ok {
+			return nil, p.errorAt(open, UnbalancedParen, operatorExpected(OpCloseParen))
+		}
+		if !closing.is(OpCloseParen) {
+			return nil, p.errorf(UnexpectedToken, operatorExpected(OpCloseParen))
+		}
+		p.i++
+		p.depth--
+		return ParenWrappedNode{
+			Inner: inner,
+		}, nil
+	case tk.is(OpOpenBracket):
+		return p.parseList()
+	case tk.Op != nil && tk.Op.IsRange():
+		return p.parseRange(*tk.Op)
+	case tk.Op != nil && tk.Op.IsUnary():
+		p.i++
+		prec, _ := tk.Op.UnaryPrecedence()
+		inner, err := p.parseExpr(prec.Binding)
+		if err != nil {
+			return nil, err
+		}
+		return UnaryOpNode{
+			Inner: inner,
+			Op:    *tk.Op,
+		}, nil
+	case tk.Op != nil && *tk.Op == OpCloseParen && p.depth == 0:
+		return nil, p.errorf(UnbalancedParen, operandExpected())
+	default:
+		return nil, p.errorf(UnexpectedToken, operandExpected())
+	}
+}
+
+// continuesQuantity reports whether a number and its unit come next.
+func (p *parser) continuesQuantity() bool {
+	tk, ok := p.peek()
+	return ok && tk.Number != nil && p.isUnit(p.i+1)
+}
+
+// parseQuantity parses a number followed by its unit, which may be
+// raised to a power, as in "3 m^2".
+func (p *parser) parseQuantity() (Node, error) {
+	num := NumberNode{new(big.Rat).Set(p.tokens[p.i].Number)}
+	p.i++
+	prec, _ := OpPower.BinaryPrecedence()
+	unit, err := p.parseExpr(prec.Binding)
+	if err != nil {
+		return nil, err
+	}
+	return BinaryOpNode{LHS: num, Op: OpMultiply, RHS: unit}, nil
+}
+
+// parseCall parses the parenthesized, comma separated arguments of a call
+// to the named function. The current token is the opening parenthesis.
+func (p *parser) parseCall(name string) (Node, error) {
+	open := p.i
+	p.i++
+	p.depth++
+	call := CallNode{Name: name}
+	if tk, ok := p.peek(); ok && tk.is(OpCloseParen) {
+		p.i++
+		p.depth--
+		return call, nil
+	}
+	for {
+		arg, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+		tk, ok := p.peek()
+		switch {
+		case !ok:
+			return nil, p.errorAt(open, UnbalancedParen, operatorExpected(OpComma, OpCloseParen))
+		case tk.is(OpComma):
+			p.i++
+		case tk.is(OpCloseParen):
+			p.i++
+			p.depth--
+			return call, nil
+		default:
+			return nil, p.errorf(UnexpectedToken, operatorExpected(OpComma, OpCloseParen))
+		}
+	}
+}
+
+// parseList parses the comma separated elements of a list literal. The
+// current token is the opening bracket.
+func (p *parser) parseList() (Node, error) {
+	open := p.i
+	p.i++
+	list := ListNode{}
+	if tk, ok := p.peek(); ok && tk.is(OpCloseBracket) {
+		p.i++
+		return list, nil
+	}
+	for {
+		elem, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		list.Elems = append(list.Elems, elem)
+		tk, ok := p.peek()
+		switch {
+		case !ok:
+			return nil, p.errorAt(open, UnbalancedBracket, operatorExpected(OpComma, OpCloseBracket))
+		case tk.is(OpComma):
+			p.i++
+		case tk.is(OpCloseBracket):
+			p.i++
+			return list, nil
+		default:
+			return nil, p.errorf(UnexpectedToken, operatorExpected(OpComma, OpCloseBracket))
+		}
+	}
+}
+
+// parseRange parses the parenthesized body, variable and bounds of a range
+// operator. The current token is the operator.
+func (p *parser) parseRange(op Op) (Node, error) {
+	p.i++
+	if tk, ok := p.peek(); !ok || !tk.is(OpOpenParen) {
+		return nil, p.errorf(UnexpectedToken, Expected{}.withOps(OpOpenParen))
+	}
+	open := p.i
+	p.i++
+	p.depth++
+	// next parses an argument and the comma or closing parenthesis after
+	// it.
+	next := func(last bool) (Node, error) {
+		arg, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		want := OpComma
+		if last {
+			want = OpCloseParen
+		}
+		tk, ok := p.peek()
+		switch {
+		case !ok:
+			return nil, p.errorAt(open, UnbalancedParen, operatorExpected(want))
+		case !tk.is(want):
+			return nil, p.errorf(UnexpectedToken, operatorExpected(want))
+		}
+		p.i++
+		return arg, nil
+	}
+	n := RangeOpNode{Op: op}
+	var err error
+	if n.Body, err = next(false); err != nil {
+		return nil, err
+	}
+	tk, ok := p.peek()
+	if !ok || tk.Ident == nil {
+		return nil, p.errorf(UnexpectedToken, Expected{Identifier: true})
+	}
+	if _, ok := p.constants.Lookup(*tk.Ident); ok && !p.params[*tk.Ident] {
+		return nil, p.errorf(AssignToConstant, Expected{})
+	}
+	if p.isUnit(p.i) {
+		return nil, p.errorf(AssignToUnit, Expected{})
+	}
+	n.Var = *tk.Ident
+	p.i++
+	if tk, ok := p.peek(); !ok || !tk.is(OpComma) {
+		return nil, p.errorf(UnexpectedToken, Expected{}.withOps(OpComma))
+	}
+	p.i++
+	if n.From, err = next(false); err != nil {
+		return nil, err
+	}
+	if n.To, err = next(true); err != nil {
+		return nil, err
+	}
+	p.depth--
+	return n, nil
+}
+
+// isDefinition reports whether the tokens begin with a function definition
+// head: a name that is not a built-in function and a parenthesized list of
+// distinct parameter names, followed by =, as in "f(x, y) = ...". Anything
+// else before an = is the left side of an equation, so "sin(x) = 0.5" and
+// "max(1, 2) = 2" are equations.
+func (p *parser) isDefinition() bool {
+	ts := p.tokens
+	if len(ts) < 4 || ts[0].Ident == nil || !ts[1].is(OpOpenParen) || p.functions.IsBuiltin(*ts[0].Ident) {
+		return false
+	}
+	seen := map[string]bool{}
+	i := 2
+	for ; i < len(ts) && !ts[i].is(OpCloseParen); i++ {
+		if len(seen) != 0 {
+			// a comma separates each parameter from the last
+			if !ts[i].is(OpComma) || i+1 == len(ts) {
+				return false
+			}
+			i++
+		}
+		if ts[i].Ident == nil || seen[*ts[i].Ident] {
+			return false
+		}
+		seen[*ts[i].Ident] = true
+	}
+	return i+1 < len(ts) && ts[i+1].is(OpEquals)
+}
+
+// parseDefinitionHead reads the name and parameters of the function
+// definition isDefinition found, leaving the current token at the start
+// of its body.
+func (p *parser) parseDefinitionHead() *FunctionDefNode {
+	def := &FunctionDefNode{Name: *p.tokens[0].Ident}
+	p.i = 2
+	for ; !p.tokens[p.i].is(OpCloseParen); p.i++ {
+		if tk := p.tokens[p.i]; tk.Ident != nil {
+			def.Params = append(def.Params, *tk.Ident)
+		}
+	}
+	// skip the ) and =
+	p.i += 2
+	return def
+}
+
+// opOrder fixes the order operators are listed in an Expected set.
+var opOrder = []Op{
+	OpPlus,
+	OpMinus,
+	OpMultiply,
+	OpDivide,
+	OpFloorDivide,
+	OpModulo,
+	OpMatMul,
+	OpPower,
+	OpFactorial,
+	OpAnd,
+	OpOr,
+	OpXor,
+	OpShiftLeft,
+	OpShiftRight,
+	OpSquareRoot,
+	OpNot,
+	OpIntegral,
+	OpSum,
+	OpProduct,
+	OpOpenParen,
+	OpCloseParen,
+	OpOpenBracket,
+	OpCloseBracket,
+	OpComma,
+}
+
+// operandExpected is what may begin an operand.
+func operandExpected() Expected {
+	e := Expected{Number: true, Identifier: true}
+	for _, op := range opOrder {
+		if op == OpOpenParen || op == OpOpenBracket || op.IsUnary() || op.IsRange() {
+			e.Ops = append(e.Ops, op)
+		}
+	}
+	return e
+}
+
+// operatorExpected is what may follow a complete operand. closers are the
+// tokens that would end the enclosing construct; with none the input may
+// end instead.
+func operatorExpected(closers ...Op) Expected {
+	e := Expected{End: len(closers) == 0}
+	for _, op := range opOrder {
+		if op.IsBinary() || op.IsPostfix() {
+			e.Ops = append(e.Ops, op)
+		}
+	}
+	return e.withOps(closers...)
+}
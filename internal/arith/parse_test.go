@@ -0,0 +1,446 @@
+package arith
+
+import (
+	"errors"
+	"go/ast"
+	"go/constant"
+	goparser "go/parser"
+	"go/token"
+	"io"
+	"math/big"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestParsePrecedence(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+	}
+	tcs := []testCase{
+		{in: "2*3+4", out: "10"},
+		{in: "2+3*4", out: "14"},
+		{in: "10-3-2", out: "5"},
+		{in: "100/10/5", out: "2"},
+		{in: "2*3*4", out: "24"},
+		{in: "8-2*3", out: "2"},
+		{in: "8/2*3", out: "12"},
+		{in: "8*2/4", out: "4"},
+		{in: "1-2+3", out: "2"},
+		{in: "1+2-3", out: "0"},
+		{in: "2*(3+4)", out: "14"},
+		{in: "(2+3)*(4+5)", out: "45"},
+		{in: "-2*3", out: "-6"},
+		{in: "-2+3", out: "1"},
+		{in: "--2", out: "2"},
+		{in: "2--2", out: "4"},
+		{in: "2*-3", out: "-6"},
+		{in: "-(2+3)*4", out: "-20"},
+		{in: "√4*4", out: "8"},
+		{in: "√(4*4)", out: "4"},
+		{in: "√16+9", out: "13"},
+		{in: "-√9", out: "-3"},
+		{in: "√√16", out: "2"},
+		{in: "((((1))))", out: "1"},
+		{in: "(1+(2*(3+(4*5))))", out: "47"},
+		{in: "2^3^2", out: "512"},
+		{in: "-2^2", out: "-4"},
+		{in: "(-2)^2", out: "4"},
+		{in: "2*3^2", out: "18"},
+		{in: "2^-1*4", out: "2"},
+		{in: "√2^2", out: "2"},
+		{in: "7%3", out: "1"},
+		{in: "-7%3", out: "2"},
+		{in: "7%(-3)", out: "-2"},
+		{in: "7 % -2", out: "-1.93"},
+		{in: "7 % -x", out: "-2.93"},
+		{in: "10% - 2", out: "-1.9"},
+		{in: "10% + 2", out: "2.1"},
+		{in: "50% - 10", out: "-9.5"},
+		{in: "(10%)*20 - 2", out: "0"},
+		{in: "7//2", out: "3"},
+		{in: "-7//2", out: "-4"},
+		{in: "1+7//2*2", out: "7"},
+		{in: "2*7%4", out: "2"},
+		{in: "3!", out: "6"},
+		{in: "-3!", out: "-6"},
+		{in: "2^3!", out: "64"},
+		{in: "3!^2", out: "36"},
+		{in: "3!!", out: "720"},
+		{in: "2*3!+1", out: "13"},
+		{in: "(√4)!", out: "2"},
+		{in: "200+10%", out: "220"},
+		{in: "200-10%", out: "180"},
+		{in: "200*10%", out: "20"},
+		{in: "(200+10%)*2", out: "440"},
+		{in: "50%*4", out: "2"},
+		{in: "7%3!", out: "1"},
+		{in: "0xff", out: "255"},
+		{in: "0b1010+0o7", out: "17"},
+		{in: "6&3", out: "2"},
+		{in: "6|3", out: "7"},
+		{in: "6 xor 3", out: "5"},
+		{in: "~0", out: "-1"},
+		{in: "-~5", out: "6"},
+		{in: "1<<4", out: "16"},
+		{in: "-17>>2", out: "-5"},
+		{in: "1<<2+1", out: "8"},
+		{in: "1|2&3", out: "3"},
+		{in: "1|6 xor 3&5", out: "7"},
+		{in: "5&3<<1", out: "4"},
+		{in: "0xf0>>4|1", out: "15"},
+		{in: "2(3+4)", out: "14"},
+		{in: "3√4", out: "6"},
+		{in: "(1+2)(3+4)", out: "21"},
+		{in: "2(3)(4)", out: "24"},
+		{in: "1+2(3)", out: "7"},
+		{in: "12/2(3)", out: "18"},
+		{in: "2(3)^2", out: "18"},
+		{in: "-2(3)", out: "-6"},
+		{in: "2^3(2)", out: "16"},
+		{in: "2max(3, 4)", out: "8"},
+		{in: "max(3, 4)(2)", out: "8"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			// x is 3 for the cases that use a variable
+			ev := Evaluator{Env: NewEnvironment()}
+			ev.Env.Set("x", Int{big.NewInt(3)})
+			res, _ := ev.Eval(tree)
+			if res.String() != tc.out {
+				t.Fatalf("out mismatch: expected %v vs %v (tree %v)", tc.out, res, Pretty(tree))
+			}
+		})
+	}
+}
+
+func TestParseTreeShape(t *testing.T) {
+	tree, err := ParseString("1-2*3-4")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	// ((1 - (2 * 3)) - 4)
+	outer, ok := tree.(BinaryOpNode)
+	if !ok || outer.Op != OpMinus {
+		t.Fatalf("expected outer minus, got %#v", tree)
+	}
+	if Pretty(outer.RHS) != "4" {
+		t.Fatalf("expected 4 on the right, got %#v", outer.RHS)
+	}
+	inner, ok := outer.LHS.(BinaryOpNode)
+	if !ok || inner.Op != OpMinus || Pretty(inner.LHS) != "1" {
+		t.Fatalf("expected 1 - ... on the left, got %#v", outer.LHS)
+	}
+	mul, ok := inner.RHS.(BinaryOpNode)
+	if !ok || mul.Op != OpMultiply {
+		t.Fatalf("expected 2 * 3, got %#v", inner.RHS)
+	}
+}
+
+func TestParseImplicitMultiply(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+	}
+	for _, tc := range []testCase{
+		{in: "2(3+4)", out: "2 * (3 + 4)"},
+		{in: "3√4", out: "3 * √4"},
+		{in: "(1+2)(3+4)", out: "(1 + 2) * (3 + 4)"},
+		{in: "2x^2", out: "2 * x ^ 2"},
+		{in: "2sin(0)", out: "2 * sin(0)"},
+		{in: "y = 2x", out: "y = 2 * x"},
+	} {
+		tree, err := ParseString(tc.in)
+		if err != nil {
+			t.Errorf("%q: parse failed: %v", tc.in, err)
+			continue
+		}
+		if got := Pretty(tree); got != tc.out {
+			t.Errorf("%q: expected %q, got %q", tc.in, tc.out, got)
+		}
+	}
+	// the multiply binds like an explicit one: 2x^2 is 2*(x^2)
+	tree, _ := ParseString("2x^2")
+	mul, ok := tree.(BinaryOpNode)
+	if !ok || mul.Op != OpMultiply {
+		t.Fatalf("expected an outer multiply, got %#v", tree)
+	}
+	if pow, ok := mul.RHS.(BinaryOpNode); !ok || pow.Op != OpPower {
+		t.Fatalf("expected x ^ 2 on the right, got %#v", mul.RHS)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"1+",
+		"*1",
+		"(1+2",
+		"1+2)",
+		"()",
+		"1 2",
+		"(1)2",
+		"√",
+	} {
+		in := in
+		t.Run(in, func(t *testing.T) {
+			if tree, err := ParseString(in); err == nil {
+				t.Fatalf("expected error, got %v", Pretty(tree))
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	type testCase struct {
+		in     string
+		kind   ParseErrorKind
+		index  int
+		offset int
+	}
+	tcs := []testCase{
+		{in: "", kind: UnexpectedEnd, index: 0, offset: 0},
+		{in: "1 +", kind: TrailingOperator, index: 2, offset: 3},
+		{in: "√", kind: TrailingOperator, index: 1, offset: 1},
+		{in: "* 1", kind: UnexpectedToken, index: 0, offset: 0},
+		{in: "1 * * 2", kind: UnexpectedToken, index: 2, offset: 4},
+		{in: "2 * (3 + 4", kind: UnbalancedParen, index: 2, offset: 4},
+		{in: "(3 + 4))", kind: UnbalancedParen, index: 5, offset: 7},
+		{in: ")", kind: UnbalancedParen, index: 0, offset: 0},
+		{in: "()", kind: UnexpectedToken, index: 1, offset: 1},
+		{in: "(12 3)", kind: UnexpectedToken, index: 2, offset: 4},
+		{in: "(3)4", kind: UnexpectedToken, index: 3, offset: 3},
+		{in: "1 + $", kind: UnknownCharacter, index: 2, offset: 4},
+		{in: "√√?", kind: UnknownCharacter, index: 2, offset: 2},
+		{in: "x =", kind: TrailingOperator, index: 2, offset: 3},
+		{in: "1 = 2 = 3", kind: UnexpectedToken, index: 3, offset: 6},
+		{in: "x = y = 2", kind: UnexpectedToken, index: 3, offset: 6},
+		{in: "x y", kind: UnexpectedToken, index: 1, offset: 2},
+		{in: "1 . 2", kind: UnknownCharacter, index: 1, offset: 2},
+		{in: "1.2.3", kind: UnexpectedToken, index: 1, offset: 3},
+		{in: "7 /// 2", kind: UnexpectedToken, index: 2, offset: 4},
+		{in: "2 ^", kind: TrailingOperator, index: 2, offset: 3},
+		{in: "!3", kind: UnexpectedToken, index: 0, offset: 0},
+		{in: "3 ! 2", kind: UnexpectedToken, index: 2, offset: 4},
+		{in: "1 < 2", kind: UnknownCharacter, index: 1, offset: 2},
+		{in: "1 xor", kind: TrailingOperator, index: 2, offset: 5},
+		{in: "x(1)", kind: UnknownFunction, index: 0, offset: 0},
+		{in: "[1, 2", kind: UnbalancedBracket, index: 0, offset: 0},
+		{in: "1]", kind: UnbalancedBracket, index: 1, offset: 1},
+		{in: "[1 2]", kind: UnexpectedToken, index: 2, offset: 3},
+		{in: "[1] @", kind: TrailingOperator, index: 4, offset: 5},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			_, err := ParseString(tc.in)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected a *ParseError, got %v", err)
+			}
+			if perr.Kind != tc.kind {
+				t.Errorf("kind mismatch: expected %v got %v", tc.kind, perr.Kind)
+			}
+			if perr.Index != tc.index {
+				t.Errorf("index mismatch: expected %v got %v", tc.index, perr.Index)
+			}
+			if perr.Offset != tc.offset {
+				t.Errorf("offset mismatch: expected %v got %v", tc.offset, perr.Offset)
+			}
+		})
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+	}
+	for _, tc := range []testCase{
+		{in: "12", out: "12"},
+		{in: "2.5", out: "5/2"},
+		{in: ".5", out: "1/2"},
+		{in: "3.", out: "3"},
+		{in: "1.2e-3", out: "3/2500"},
+		{in: "1e3", out: "1000"},
+		{in: "007", out: "7"},
+		{in: "0x10", out: "16"},
+		{in: "0XfF", out: "255"},
+		{in: "0o17", out: "15"},
+		{in: "0b101", out: "5"},
+	} {
+		r, err := ParseNumber(tc.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tc.in, err)
+			continue
+		}
+		if r.RatString() != tc.out {
+			t.Errorf("%q: expected %v, got %v", tc.in, tc.out, r.RatString())
+		}
+	}
+	for _, in := range []string{"", ".", "1.2.3", "e3", "1e", "1e+", "0x", "0xg", "0b102", "0o8", "0x1.5", "1/2", "-1"} {
+		if _, err := ParseNumber(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+	for _, in := range []string{"1e999999", "1e-999999", "1e999999999999999999999"} {
+		if _, err := ParseNumber(in); !errors.Is(err, ErrOverflow) {
+			t.Errorf("%q: expected %v, got %v", in, ErrOverflow, err)
+		}
+	}
+	if _, err := ParseString("2 * 1e999999999"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("expected %v, got %v", ErrOverflow, err)
+	}
+}
+
+func TestParseErrorExpected(t *testing.T) {
+	_, err := Parse([]Token{iTk(1), oTk(OpPlus)})
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a *ParseError, got %v", err)
+	}
+	if perr.Offset != -1 {
+		t.Fatalf("expected no source offset, got %v", perr.Offset)
+	}
+	if !perr.Expected.Number || perr.Expected.End {
+		t.Fatalf("expected an operand, got %v", perr.Expected)
+	}
+	if _, err := Parse(nil); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected empty input to match io.EOF, got %v", err)
+	}
+}
+
+// TestParseConformance checks the parser against Go's own constant
+// expression evaluator, which shares our precedence and associativity
+// for + - * / and unary minus.
+func TestParseConformance(t *testing.T) {
+	for _, backend := range []Backend{BackendRational, BackendInteger} {
+		ev := Evaluator{Backend: backend}
+		rng := rand.New(rand.NewSource(1))
+		const count = 500
+		checked := 0
+		for i := 0; checked < count; i++ {
+			expr := randomExpr(rng, 4)
+			want, ok := referenceEval(t, expr, backend == BackendInteger)
+			if !ok {
+				// divides by zero somewhere
+				continue
+			}
+			checked++
+			tree, err := ParseString(expr)
+			if err != nil {
+				t.Fatalf("%q: parse failed: %v", expr, err)
+			}
+			got, err := ev.Eval(tree)
+			if err != nil {
+				t.Fatalf("%q: eval failed: %v", expr, err)
+			}
+			if toRat(got).Cmp(want) != 0 {
+				t.Fatalf("%q: expected %v, got %v (tree %v)", expr, want, got, Pretty(tree))
+			}
+		}
+	}
+}
+
+func randomExpr(rng *rand.Rand, depth int) string {
+	if depth == 0 || rng.Intn(4) == 0 {
+		return strconv.Itoa(rng.Intn(20))
+	}
+	switch rng.Intn(6) {
+	case 0:
+		return "( " + randomExpr(rng, depth-1) + " )"
+	case 1:
+		return "- " + randomExpr(rng, depth-1)
+	default:
+		ops := []string{"+", "-", "*", "/"}
+		return randomExpr(rng, depth-1) + " " + ops[rng.Intn(len(ops))] + " " + randomExpr(rng, depth-1)
+	}
+}
+
+// referenceEval evaluates expr with go/constant. It reports false if the
+// expression divides by zero.
+func referenceEval(t *testing.T, expr string, intDiv bool) (*big.Rat, bool) {
+	t.Helper()
+	x, err := goparser.ParseExpr(expr)
+	if err != nil {
+		t.Fatalf("%q: reference parse failed: %v", expr, err)
+	}
+	v, ok := referenceEvalAST(t, x, intDiv)
+	if !ok {
+		return nil, false
+	}
+	switch v := constant.Val(v).(type) {
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case *big.Int:
+		return new(big.Rat).SetInt(v), true
+	case *big.Rat:
+		return v, true
+	default:
+		t.Fatalf("%q: unexpected reference result %v", expr, v)
+		return nil, false
+	}
+}
+
+func referenceEvalAST(t *testing.T, x ast.Expr, intDiv bool) (constant.Value, bool) {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		return constant.MakeFromLiteral(x.Value, x.Kind, 0), true
+	case *ast.ParenExpr:
+		return referenceEvalAST(t, x.X, intDiv)
+	case *ast.UnaryExpr:
+		v, ok := referenceEvalAST(t, x.X, intDiv)
+		if !ok {
+			return nil, false
+		}
+		return constant.UnaryOp(x.Op, v, 0), true
+	case *ast.BinaryExpr:
+		lhs, ok := referenceEvalAST(t, x.X, intDiv)
+		if !ok {
+			return nil, false
+		}
+		rhs, ok := referenceEvalAST(t, x.Y, intDiv)
+		if !ok {
+			return nil, false
+		}
+		op := x.Op
+		if op == token.QUO {
+			if constant.Sign(rhs) == 0 {
+				return nil, false
+			}
+			if intDiv {
+				// integer division, truncated toward zero
+				op = token.QUO_ASSIGN
+			}
+		}
+		return constant.BinaryOp(lhs, op, rhs), true
+	default:
+		t.Fatalf("unexpected reference node %T", x)
+		return nil, false
+	}
+}
+
+func TestPrettyRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		expr := randomExpr(rng, 4)
+		tree, err := ParseString(expr)
+		if err != nil {
+			t.Fatalf("%q: parse failed: %v", expr, err)
+		}
+		pretty := Pretty(tree)
+		tree2, err := ParseString(pretty)
+		if err != nil {
+			t.Fatalf("%q: reparse of %q failed: %v", expr, pretty, err)
+		}
+		if got := Pretty(tree2); got != pretty {
+			t.Fatalf("%q: round trip mismatch: %q vs %q", expr, pretty, got)
+		}
+	}
+}
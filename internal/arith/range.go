@@ -0,0 +1,232 @@
+package arith
+
+import (
+	"math"
+	"math/big"
+)
+
+// maxRangeTerms bounds the number of terms of a sum or product, so
+// "Σ(k, k, 1, 10^12)" fails with ErrOverflow instead of computing for
+// hours.
+const maxRangeTerms = 1 << 20
+
+// Integrals are refined until their estimated error is within
+// integralTolerance of their value, or below minIntegralError, by
+// splitting the interval with the largest error in two at most
+// maxIntegralSplits times.
+const (
+	integralTolerance = 1e-10
+	minIntegralError  = 1e-14
+	maxIntegralSplits = 200
+)
+
+// rangeOp evaluates a sum or product exactly, term by term, and an
+// integral approximately.
+func (ev Evaluator) rangeOp(n RangeOpNode) (Value, error) {
+	from, err := ev.Eval(n.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := ev.Eval(n.To)
+	if err != nil {
+		return nil, err
+	}
+	from, to = plain(from), plain(to)
+	for _, v := range []Value{from, to} {
+		switch v.(type) {
+		case Int, Rat, Float:
+		default:
+			return nil, &EvalError{Err: ErrDomain, Node: n}
+		}
+	}
+	if n.Op == OpIntegral {
+		return ev.integrate(n, toFloat64(from), toFloat64(to))
+	}
+	return ev.series(n, toRat(from), toRat(to))
+}
+
+// bind returns an Evaluator for the body of n with its variable bound to
+// v.
+func (ev Evaluator) bind(n RangeOpNode, v Value) Evaluator {
+	scope := &Environment{parent: ev.Env}
+	scope.Set(n.Var, v)
+	ev.Env = scope
+	return ev
+}
+
+// series adds or multiplies the body of n for every integer from lo to hi.
+// An empty range is the identity, 0 for sums and 1 for products.
+func (ev Evaluator) series(n RangeOpNode, lo, hi *big.Rat) (Value, error) {
+	if !lo.IsInt() || !hi.IsInt() {
+		return nil, &EvalError{Err: ErrDomain, Node: n}
+	}
+	count := new(big.Int).Sub(hi.Num(), lo.Num())
+	if count.Cmp(big.NewInt(maxRangeTerms)) >= 0 {
+		return nil, &EvalError{Err: ErrOverflow, Node: n}
+	}
+	op, identity := OpPlus, int64(0)
+	if n.Op == OpProduct {
+		op, identity = OpMultiply, 1
+	}
+	// accumulating from the first term rather than the identity lets
+	// terms have units, as in "Σ(k m, k, 1, 3)"
+	var acc Value
+	one := big.NewInt(1)
+	for k := new(big.Int).Set(lo.Num()); k.Cmp(hi.Num()) <= 0; k.Add(k, one) {
+		term, err := ev.bind(n, Int{new(big.Int).Set(k)}).Eval(n.Body)
+		if err != nil {
+			return nil, err
+		}
+		if acc == nil {
+			acc = plain(term)
+			continue
+		}
+		acc, err = ev.binary(op, acc, term)
+		if err != nil {
+			return nil, &EvalError{Err: err, Node: n}
+		}
+	}
+	if acc == nil {
+		return ev.Eval(NumberNode{big.NewRat(identity, 1)})
+	}
+	return acc, nil
+}
+
+// A segment is a piece of an integral and the estimated error of its
+// value.
+type segment struct {
+	a, b       float64
+	value, err float64
+}
+
+// integrate computes the integral of the body of n from a to b in float64
+// by adaptive Gauss–Kronrod quadrature. The result is an Estimate carrying
+// the error estimate. An integral whose error is still beyond the
+// tolerance after maxIntegralSplits, as a divergent one's is, fails with
+// ErrNoConverge.
+func (ev Evaluator) integrate(n RangeOpNode, a, b float64) (Value, error) {
+	f := func(x float64) (float64, error) {
+		v, err := ev.bind(n, fromFloat64(x)).Eval(n.Body)
+		if err != nil {
+			return 0, err
+		}
+		switch v := plain(v); v.(type) {
+		case Int, Rat, Float:
+			y := toFloat64(v)
+			if math.IsInf(y, 0) || math.IsNaN(y) {
+				return 0, &EvalError{Err: ErrOverflow, Node: n}
+			}
+			return y, nil
+		}
+		return 0, &EvalError{Err: ErrDomain, Node: n}
+	}
+	first, err := gaussKronrod(f, a, b)
+	if err != nil {
+		return nil, err
+	}
+	segs := []segment{first}
+	value, errEst := first.value, first.err
+	converged := func() bool {
+		return errEst <= math.Max(integralTolerance*math.Abs(value), minIntegralError)
+	}
+	for i := 0; i < maxIntegralSplits && !converged(); i++ {
+		worst := 0
+		for j, s := range segs {
+			if s.err > segs[worst].err {
+				worst = j
+			}
+		}
+		s := segs[worst]
+		mid := s.a + (s.b-s.a)/2
+		left, err := gaussKronrod(f, s.a, mid)
+		if err != nil {
+			return nil, err
+		}
+		right, err := gaussKronrod(f, mid, s.b)
+		if err != nil {
+			return nil, err
+		}
+		segs[worst] = left
+		segs = append(segs, right)
+		value, errEst = 0, 0
+		for _, s := range segs {
+			value += s.value
+			errEst += s.err
+		}
+	}
+	switch {
+	case math.IsInf(value, 0):
+		return nil, &EvalError{Err: ErrOverflow, Node: n}
+	case !converged():
+		return nil, &EvalError{Err: ErrNoConverge, Node: n}
+	}
+	return Estimate{
+		Float: fromFloat64(value).(Float),
+		Error: fromFloat64(errEst).(Float),
+	}, nil
+}
+
+// The nodes and weights of the 15 point Kronrod rule and of the 7 point
+// Gauss rule embedded in it, whose nodes are the odd indexed Kronrod
+// nodes. Only the nodes on one side of the midpoint are listed; the last
+// is the midpoint itself.
+var (
+	kronrodNodes = [8]float64{
+		0.991455371120812639206854697526329,
+		0.949107912342758524526189684047851,
+		0.864864423359769072789712788640926,
+		0.741531185599394439863864773280788,
+		0.586087235467691130294144845693013,
+		0.405845151377397166906606412076961,
+		0.207784955007898467600689403773245,
+		0,
+	}
+	kronrodWeights = [8]float64{
+		0.022935322010529224963732008058970,
+		0.063092092629978553290700663189204,
+		0.104790010322250183839876322541518,
+		0.140653259715525918745189590510238,
+		0.169004726639267902826583426598550,
+		0.190350578064785409913256402421014,
+		0.204432940075298892414161999234649,
+		0.209482141084727828012999174891714,
+	}
+	gaussWeights = [4]float64{
+		0.129484966168869693270611432679082,
+		0.279705391489276667901467771423780,
+		0.381830050505118944950369775488975,
+		0.417959183673469387755102040816327,
+	}
+)
+
+// gaussKronrod integrates f from a to b with the 15 point Kronrod rule,
+// estimating the error as its difference from the 7 point Gauss rule.
+func gaussKronrod(f func(float64) (float64, error), a, b float64) (segment, error) {
+	center, half := a+(b-a)/2, (b-a)/2
+	fc, err := f(center)
+	if err != nil {
+		return segment{}, err
+	}
+	kronrod, gauss := fc*kronrodWeights[7], fc*gaussWeights[3]
+	for i := 0; i < 7; i++ {
+		dx := half * kronrodNodes[i]
+		lo, err := f(center - dx)
+		if err != nil {
+			return segment{}, err
+		}
+		hi, err := f(center + dx)
+		if err != nil {
+			return segment{}, err
+		}
+		kronrod += kronrodWeights[i] * (lo + hi)
+		if i%2 == 1 {
+			gauss += gaussWeights[i/2] * (lo + hi)
+		}
+	}
+	return segment{
+		a:     a,
+		b:     b,
+		value: kronrod * half,
+		err:   math.Abs((kronrod - gauss) * half),
+	}, nil
+}
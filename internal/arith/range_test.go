@@ -0,0 +1,207 @@
+package arith
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestSeries(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+		err error
+	}
+	tcs := []testCase{
+		{in: "Σ(k, k, 1, 100)", out: "5050"},
+		{in: "∑(k^2, k, 1, 10)", out: "385"},
+		{in: "Σ(1/k, k, 1, 4)", out: "25/12"},
+		{in: "Π(k, k, 1, 20)", out: "2432902008176640000"},
+		{in: "∏(2, i, 1, 70)", out: "1180591620717411303424"},
+		{in: "Σ(k, k, 5, 4)", out: "0"},
+		{in: "Π(k, k, 5, 4)", out: "1"},
+		{in: "Σ(k, k, -2, 2)", out: "0"},
+		{in: "2Σ(k, k, 1, 3) + 1", out: "13"},
+		{in: "Σ(Σ(j*k, j, 1, k), k, 1, 3)", out: "25"},
+		{in: "Σ(k, k, 1, 2.5)", err: ErrDomain},
+		{in: "Σ(k, k, 0, 10^7)", err: ErrOverflow},
+		{in: "Σ(1/k, k, 0, 2)", err: ErrDivideByZero},
+		{in: "Σ(k*y, k, 1, 2)", err: ErrUndefined},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			v, err := EvalChecked(tree)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := v.String(); got != tc.out {
+				t.Fatalf("expected %v, got %v", tc.out, got)
+			}
+		})
+	}
+}
+
+func TestSeriesEnv(t *testing.T) {
+	env := NewEnvironment()
+	env.Set("k", Int{big.NewInt(7)})
+	env.Set("n", Int{big.NewInt(4)})
+	ev := Evaluator{Env: env}
+	tree, err := ParseString("Σ(k, k, 1, n) + k")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	v, err := ev.Eval(tree)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.String() != "17" {
+		t.Fatalf("expected 17, got %v", v)
+	}
+	if got, _ := env.Get("k"); got.String() != "7" {
+		t.Fatalf("k was rebound to %v", got)
+	}
+}
+
+func TestIntegral(t *testing.T) {
+	type testCase struct {
+		in   string
+		want float64
+		err  error
+	}
+	tcs := []testCase{
+		{in: "∫(x^2, x, 0, 1)", want: 1.0 / 3},
+		{in: "∫(x^2, x, 1, 0)", want: -1.0 / 3},
+		{in: "∫(x, x, 2, 2)", want: 0},
+		{in: "∫(sin(x), x, 0, π)", want: 2},
+		{in: "∫(exp(-x^2), x, -10, 10)", want: math.Sqrt(math.Pi)},
+		{in: "∫(√x, x, 0, 1)", want: 2.0 / 3},
+		{in: "∫(1/x, x, 1, e)", want: 1},
+		{in: "∫(abs(x), x, -1, 2)", want: 2.5},
+		{in: "∫(t, t, 0, 1) * 4", want: 2},
+		{in: "∫(∫(x*y, y, 0, 1), x, 0, 2)", want: 1},
+		{in: "∫(√x, x, -1, 1)", err: ErrDomain},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			v, err := EvalChecked(tree)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := toFloat64(plain(v))
+			if math.Abs(got-tc.want) > 1e-9 {
+				t.Fatalf("expected %v, got %v", tc.want, v)
+			}
+			if est, ok := v.(Estimate); ok && toFloat64(est.Error) > 1e-9 {
+				t.Fatalf("error estimate of %v is too large", v)
+			}
+		})
+	}
+}
+
+func TestIntegralEstimate(t *testing.T) {
+	tree, err := ParseString("∫(x^2, x, 0, 3)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	v, err := EvalChecked(tree)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	est, ok := v.(Estimate)
+	if !ok {
+		t.Fatalf("expected an Estimate, got %T", v)
+	}
+	f := Formatter{Notation: NotationFixed, DecimalPlaces: 3}
+	if got := f.Format(est); got != "9.000" {
+		t.Fatalf("expected 9.000, got %q", got)
+	}
+	est.Error = fromFloat64(0.01).(Float)
+	if got := f.Format(est); got != "9.000 ± 0.01" {
+		t.Fatalf("expected 9.000 ± 0.01, got %q", got)
+	}
+	// refinement gives up on a divergent integral, and says so
+	tree, err = ParseString("∫(1/x, x, 0, 1)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if _, err = EvalChecked(tree); !errors.Is(err, ErrNoConverge) {
+		t.Fatalf("expected %v, got %v", ErrNoConverge, err)
+	}
+	// an Estimate computes as its value
+	tree, err = ParseString("∫(x^2, x, 0, 3) / 9")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	v, err = EvalChecked(tree)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := v.(Float); !ok || math.Abs(toFloat64(v)-1) > 1e-12 {
+		t.Fatalf("expected a Float near 1, got %v", v)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	type testCase struct {
+		in     string
+		pretty string
+		kind   ParseErrorKind
+		offset int
+	}
+	tcs := []testCase{
+		{in: "Σ(k^2,k,1,n)", pretty: "Σ(k ^ 2, k, 1, n)"},
+		{in: "∏(k, k, 1, 3)!", pretty: "Π(k, k, 1, 3)!"},
+		{in: "∫ (x, x, 0, 1)", pretty: "∫(x, x, 0, 1)"},
+		{in: "Σ k", kind: UnexpectedToken, offset: 2},
+		{in: "Σ(k, 2, 1, 3)", kind: UnexpectedToken, offset: 5},
+		{in: "Σ(k, k, 1)", kind: UnexpectedToken, offset: 9},
+		{in: "Σ(k, k 1, 3)", kind: UnexpectedToken, offset: 7},
+		{in: "Σ(k, k, 1, 3", kind: UnbalancedParen, offset: 1},
+		{in: "Σ(e, e, 1, 3)", kind: AssignToConstant, offset: 5},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if tc.pretty == "" {
+				var perr *ParseError
+				if !errors.As(err, &perr) {
+					t.Fatalf("expected a ParseError, got %v", err)
+				}
+				if perr.Kind != tc.kind || perr.Offset != tc.offset {
+					t.Fatalf("expected %v at offset %d, got %v", tc.kind, tc.offset, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			if got := Pretty(tree); got != tc.pretty {
+				t.Fatalf("expected %q, got %q", tc.pretty, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,486 @@
+package arith
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Simplify rewrites a tree into a simpler tree with the same value. It
+// folds constant subexpressions, drops identities such as x+0 and x*1,
+// collects like terms and powers, as in "2x + x*x - x" to "x ^ 2 + x",
+// orders terms by descending degree, and keeps only the parentheses
+// Pretty needs to write the result unambiguously.
+//
+// Simplify assumes exact arithmetic, as BackendRational computes. It may
+// remove a subexpression that would have failed to evaluate, so "x/x" is
+// 1 even though it is undefined for x = 0, but whenever a tree evaluates
+// without error its simplification evaluates to the same value. Products
+// of sums are not expanded. Calls are never folded, since their functions
+// depend on the Evaluator, and neither are sums, products and integrals,
+// which may take long to compute.
+func Simplify(n Node) Node {
+	switch v := n.(type) {
+	case AssignNode:
+		return AssignNode{Name: v.Name, Value: Simplify(v.Value)}
+	case FunctionDefNode:
+		return FunctionDefNode{Name: v.Name, Params: v.Params, Body: Simplify(v.Body)}
+	case EquationNode:
+		return EquationNode{LHS: Simplify(v.LHS), RHS: Simplify(v.RHS)}
+	default:
+		return toPoly(n).node()
+	}
+}
+
+// A poly is a sum of terms, no two of which have the same factors. The
+// empty poly is zero.
+type poly []term
+
+// A term is a nonzero rational coefficient times a product of factors,
+// which are sorted by key and never raised to the power zero.
+type term struct {
+	coef    *big.Rat
+	factors []factor
+}
+
+// A factor is a subexpression Simplify cannot see into, such as a
+// variable or a call, raised to an integer power.
+type factor struct {
+	base Node
+	// key is the base written by Pretty. Equal keys are equal bases.
+	key string
+	exp *big.Int
+	// sum is the base as a poly, if the base is a sum.
+	sum poly
+}
+
+func toPoly(n Node) poly {
+	switch v := n.(type) {
+	case NumberNode:
+		return constPoly(new(big.Rat).Set(v.Rat))
+	case ParenWrappedNode:
+		return toPoly(v.Inner)
+	case BinaryOpNode:
+		if pct, ok := isPercent(v.RHS); ok && (v.Op == OpPlus || v.Op == OpMinus) {
+			// "200 + 10%" is not a sum of 200 and 0.1, so keep it whole
+			return leaf(BinaryOpNode{
+				LHS: wrap(toPoly(v.LHS).node(), binaryOps[v.Op].Binding),
+				RHS: PostfixOpNode{Inner: wrap(toPoly(pct.Inner).node(), postfixOps[OpModulo].Binding), Op: OpModulo},
+				Op:  v.Op,
+			})
+		}
+		lhs, rhs := toPoly(v.LHS), toPoly(v.RHS)
+		switch v.Op {
+		case OpPlus:
+			return lhs.add(rhs)
+		case OpMinus:
+			return lhs.add(rhs.scale(big.NewRat(-1, 1)))
+		case OpMultiply:
+			return lhs.mul(rhs)
+		case OpDivide:
+			c, ok := rhs.constant()
+			if !ok {
+				return lhs.mul(rhs.pow(big.NewInt(-1)))
+			}
+			if c.Sign() != 0 {
+				return lhs.scale(new(big.Rat).Inv(c))
+			}
+		case OpPower:
+			if e, ok := rhs.constant(); ok && e.IsInt() {
+				return lhs.pow(e.Num())
+			}
+		}
+		return leaf(binaryNode(v.Op, lhs.node(), rhs.node()))
+	case UnaryOpNode:
+		inner := toPoly(v.Inner)
+		if v.Op == OpMinus {
+			return inner.scale(big.NewRat(-1, 1))
+		}
+		return leaf(unaryNode(v.Op, inner.node()))
+	case PostfixOpNode:
+		return leaf(postfixNode(v.Op, toPoly(v.Inner).node()))
+	case CallNode:
+		args := make([]Node, len(v.Args))
+		for i, arg := range v.Args {
+			args[i] = Simplify(arg)
+		}
+		return atomPoly(CallNode{Name: v.Name, Args: args})
+	case RangeOpNode:
+		return leaf(RangeOpNode{Op: v.Op, Body: Simplify(v.Body), Var: v.Var, From: Simplify(v.From), To: Simplify(v.To)})
+	case ListNode:
+		elems := make([]Node, len(v.Elems))
+		for i, e := range v.Elems {
+			elems[i] = Simplify(e)
+		}
+		return atomPoly(ListNode{Elems: elems})
+	case ConvertNode:
+		return atomPoly(ConvertNode{Value: Simplify(v.Value), Unit: Simplify(v.Unit)})
+	default:
+		return atomPoly(n)
+	}
+}
+
+func constPoly(r *big.Rat) poly {
+	if r.Sign() == 0 {
+		return nil
+	}
+	return poly{{coef: r}}
+}
+
+func atomPoly(n Node) poly {
+	return poly{{
+		coef:    big.NewRat(1, 1),
+		factors: []factor{{base: n, key: Pretty(n), exp: big.NewInt(1)}},
+	}}
+}
+
+// leaf folds n to a number if it evaluates exactly without variables,
+// calls or ranges, and treats it as a single factor otherwise.
+func leaf(n Node) poly {
+	if !foldable(n) {
+		return atomPoly(n)
+	}
+	v, err := Evaluator{}.Eval(n)
+	switch v := v.(type) {
+	case Int, Rat:
+		if err == nil {
+			return constPoly(new(big.Rat).Set(toRat(v)))
+		}
+	}
+	return atomPoly(n)
+}
+
+// foldable reports whether n has no calls or ranges, which leaf must not
+// evaluate.
+func foldable(n Node) bool {
+	switch v := n.(type) {
+	case CallNode, RangeOpNode:
+		return false
+	case ParenWrappedNode:
+		return foldable(v.Inner)
+	case BinaryOpNode:
+		return foldable(v.LHS) && foldable(v.RHS)
+	case UnaryOpNode:
+		return foldable(v.Inner)
+	case PostfixOpNode:
+		return foldable(v.Inner)
+	case ListNode:
+		for _, e := range v.Elems {
+			if !foldable(e) {
+				return false
+			}
+		}
+	case ConvertNode:
+		return foldable(v.Value) && foldable(v.Unit)
+	}
+	return true
+}
+
+// constant returns the value of p if it has no factors.
+func (p poly) constant() (*big.Rat, bool) {
+	switch {
+	case len(p) == 0:
+		return new(big.Rat), true
+	case len(p) == 1 && len(p[0].factors) == 0:
+		return p[0].coef, true
+	}
+	return nil, false
+}
+
+func (p poly) add(q poly) poly {
+	var res poly
+	index := make(map[string]int)
+	for _, t := range append(p[:len(p):len(p)], q...) {
+		key := t.key()
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(res)
+			res = append(res, term{coef: new(big.Rat).Set(t.coef), factors: t.factors})
+			continue
+		}
+		res[i].coef.Add(res[i].coef, t.coef)
+	}
+	// drop the terms that cancelled out
+	kept := res[:0]
+	for _, t := range res {
+		if t.coef.Sign() != 0 {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+func (p poly) scale(r *big.Rat) poly {
+	if r.Sign() == 0 {
+		return nil
+	}
+	res := make(poly, len(p))
+	for i, t := range p {
+		res[i] = term{coef: new(big.Rat).Mul(t.coef, r), factors: t.factors}
+	}
+	return res
+}
+
+func (p poly) mul(q poly) poly {
+	if c, ok := p.constant(); ok {
+		return q.scale(c)
+	}
+	if c, ok := q.constant(); ok {
+		return p.scale(c)
+	}
+	return p.term().mul(q.term()).poly()
+}
+
+// pow raises p to the integer power e.
+func (p poly) pow(e *big.Int) poly {
+	switch {
+	case e.Sign() == 0:
+		return constPoly(big.NewRat(1, 1))
+	case e.IsInt64() && e.Int64() == 1:
+		return p
+	}
+	exp := NumberNode{new(big.Rat).SetInt(e)}
+	if _, ok := p.constant(); ok {
+		return leaf(binaryNode(OpPower, p.node(), exp))
+	}
+	t := p.term()
+	coef, err := Evaluator{}.pow(ratValue(t.coef), Int{e})
+	if err != nil {
+		return atomPoly(binaryNode(OpPower, p.node(), exp))
+	}
+	res := term{coef: new(big.Rat).Set(toRat(coef)), factors: make([]factor, len(t.factors))}
+	for i, f := range t.factors {
+		f.exp = new(big.Int).Mul(f.exp, e)
+		res.factors[i] = f
+	}
+	return res.poly()
+}
+
+// term returns p as a single term, treating a sum as one factor. The
+// coefficient of the sum's leading term is moved out of it, so that
+// "-2x - 2" is -2 times "x + 1" and multiples of a sum are like terms.
+func (p poly) term() term {
+	if len(p) == 1 {
+		return p[0]
+	}
+	lead := p.sorted()[0].coef
+	sum := p.scale(new(big.Rat).Inv(lead))
+	t := atomPoly(sum.node())[0]
+	t.coef = new(big.Rat).Set(lead)
+	t.factors[0].sum = sum
+	return t
+}
+
+// poly returns t as a poly, distributing its coefficient over a sum left
+// as its only factor, as when "(x + 1)*y/y" cancels to "x + 1".
+func (t term) poly() poly {
+	if len(t.factors) == 1 && t.factors[0].sum != nil && t.factors[0].exp.IsInt64() && t.factors[0].exp.Int64() == 1 {
+		return t.factors[0].sum.scale(t.coef)
+	}
+	return poly{t}
+}
+
+func (t term) mul(u term) term {
+	res := term{coef: new(big.Rat).Mul(t.coef, u.coef)}
+	i, j := 0, 0
+	for i < len(t.factors) || j < len(u.factors) {
+		switch {
+		case j == len(u.factors) || i < len(t.factors) && t.factors[i].key < u.factors[j].key:
+			res.factors = append(res.factors, t.factors[i])
+			i++
+		case i == len(t.factors) || u.factors[j].key < t.factors[i].key:
+			res.factors = append(res.factors, u.factors[j])
+			j++
+		default:
+			f := t.factors[i]
+			f.exp = new(big.Int).Add(f.exp, u.factors[j].exp)
+			if f.exp.Sign() != 0 {
+				res.factors = append(res.factors, f)
+			}
+			i++
+			j++
+		}
+	}
+	return res
+}
+
+// key identifies the factors of t, so terms with equal keys are like
+// terms.
+func (t term) key() string {
+	keys := make([]string, len(t.factors))
+	for i, f := range t.factors {
+		keys[i] = f.key + "^" + f.exp.String()
+	}
+	return strings.Join(keys, "*")
+}
+
+func (t term) degree() *big.Int {
+	d := new(big.Int)
+	for _, f := range t.factors {
+		d.Add(d, f.exp)
+	}
+	return d
+}
+
+// sorted returns the terms of p, highest degree first.
+func (p poly) sorted() poly {
+	terms := append(poly(nil), p...)
+	sort.SliceStable(terms, func(i, j int) bool {
+		if c := terms[i].degree().Cmp(terms[j].degree()); c != 0 {
+			return c > 0
+		}
+		return terms[i].key() < terms[j].key()
+	})
+	return terms
+}
+
+// node writes p as a tree, highest degree terms first.
+func (p poly) node() Node {
+	if len(p) == 0 {
+		return NumberNode{new(big.Rat)}
+	}
+	terms := p.sorted()
+	n := terms[0].node()
+	for _, t := range terms[1:] {
+		if t.coef.Sign() < 0 {
+			neg := term{coef: new(big.Rat).Neg(t.coef), factors: t.factors}
+			n = binaryNode(OpMinus, n, neg.node())
+		} else {
+			n = binaryNode(OpPlus, n, t.node())
+		}
+	}
+	return n
+}
+
+// node writes t as a product, dividing by the coefficient's denominator
+// and by the factors raised to negative powers.
+func (t term) node() Node {
+	if len(t.factors) == 0 {
+		return NumberNode{new(big.Rat).Set(t.coef)}
+	}
+	var numer, denom []Node
+	num := new(big.Int).Abs(t.coef.Num())
+	if num.Cmp(big.NewInt(1)) != 0 {
+		numer = append(numer, NumberNode{new(big.Rat).SetInt(num)})
+	}
+	if !t.coef.IsInt() {
+		denom = append(denom, NumberNode{new(big.Rat).SetInt(t.coef.Denom())})
+	}
+	for _, f := range t.factors {
+		if f.exp.Sign() > 0 {
+			numer = append(numer, powNode(f.base, f.exp))
+		} else {
+			denom = append(denom, powNode(f.base, new(big.Int).Neg(f.exp)))
+		}
+	}
+	if len(numer) == 0 {
+		numer = append(numer, NumberNode{big.NewRat(1, 1)})
+	}
+	if t.coef.Sign() < 0 {
+		if c, ok := numer[0].(NumberNode); ok {
+			numer[0] = NumberNode{new(big.Rat).Neg(c.Rat)}
+		} else {
+			numer[0] = unaryNode(OpMinus, numer[0])
+		}
+	}
+	n := product(numer)
+	if len(denom) != 0 {
+		n = binaryNode(OpDivide, n, product(denom))
+	}
+	return n
+}
+
+func product(ns []Node) Node {
+	n := ns[0]
+	for _, m := range ns[1:] {
+		n = binaryNode(OpMultiply, n, m)
+	}
+	return n
+}
+
+func powNode(base Node, e *big.Int) Node {
+	if e.Cmp(big.NewInt(1)) == 0 {
+		return base
+	}
+	return binaryNode(OpPower, base, NumberNode{new(big.Rat).SetInt(e)})
+}
+
+// binaryNode, unaryNode and postfixNode build nodes from operands without
+// parentheses, wrapping the operands that need them to be read back as
+// written.
+func binaryNode(op Op, lhs, rhs Node) Node {
+	prec := binaryOps[op]
+	lmin, rmin := prec.Binding, prec.Binding+1
+	if prec.Assoc == AssocRight {
+		lmin, rmin = prec.Binding+1, prec.Binding
+	}
+	rhs = wrap(rhs, rmin)
+	if _, ok := isPercent(rhs); ok && (op == OpPlus || op == OpMinus) {
+		// otherwise it would read as a percentage of lhs
+		rhs = ParenWrappedNode{Inner: rhs}
+	}
+	if op == OpModulo && startsWithMinus(rhs) {
+		// otherwise % would read as a percentage followed by a minus
+		rhs = ParenWrappedNode{Inner: rhs}
+	}
+	return BinaryOpNode{LHS: wrap(lhs, lmin), RHS: rhs, Op: op}
+}
+
+func unaryNode(op Op, inner Node) Node {
+	return UnaryOpNode{Inner: wrap(inner, unaryOps[op].Binding), Op: op}
+}
+
+func postfixNode(op Op, inner Node) Node {
+	return PostfixOpNode{Inner: wrap(inner, postfixOps[op].Binding), Op: op}
+}
+
+// atomicBinding is the binding of nodes that never need parentheses.
+const atomicBinding = 100
+
+// wrap parenthesizes n if it binds less tightly than min.
+func wrap(n Node, min int) Node {
+	if binding(n) < min {
+		return ParenWrappedNode{Inner: n}
+	}
+	return n
+}
+
+// binding is how tightly the operator at the top of n binds once written
+// out. Negative numbers are written with a leading minus and fractions
+// as quotients, so they bind like those operators.
+func binding(n Node) int {
+	switch v := n.(type) {
+	case ConvertNode:
+		// conversions bind more loosely than any operator
+		return 0
+	case BinaryOpNode:
+		return binaryOps[v.Op].Binding
+	case UnaryOpNode:
+		return unaryOps[v.Op].Binding
+	case PostfixOpNode:
+		return postfixOps[v.Op].Binding
+	case NumberNode:
+		if _, ok := decimalPlaces(v.Rat); !ok {
+			return binaryOps[OpDivide].Binding
+		}
+		if v.Sign() < 0 {
+			return unaryOps[OpMinus].Binding
+		}
+	}
+	return atomicBinding
+}
+
+// startsWithMinus reports whether n is written with a leading minus.
+func startsWithMinus(n Node) bool {
+	switch v := n.(type) {
+	case NumberNode:
+		return v.Sign() < 0
+	case UnaryOpNode:
+		return v.Op == OpMinus
+	case BinaryOpNode:
+		return startsWithMinus(v.LHS)
+	case PostfixOpNode:
+		return startsWithMinus(v.Inner)
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package arith
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+	}
+	tcs := []testCase{
+		{in: "1+2*3", out: "7"},
+		{in: "x+0", out: "x"},
+		{in: "1*x", out: "x"},
+		{in: "x/1", out: "x"},
+		{in: "x^1", out: "x"},
+		{in: "x^0", out: "1"},
+		{in: "0*x", out: "0"},
+		{in: "--x", out: "x"},
+		{in: "((x))", out: "x"},
+		{in: "x+x", out: "2 * x"},
+		{in: "2x + x*x - x", out: "x ^ 2 + x"},
+		{in: "1 + x + 2 + x", out: "2 * x + 3"},
+		{in: "y*x + x*y", out: "2 * x * y"},
+		{in: "x - x", out: "0"},
+		{in: "x/x", out: "1"},
+		{in: "x^2 * x^3", out: "x ^ 5"},
+		{in: "(2x)^2", out: "4 * x ^ 2"},
+		{in: "x/2", out: "x / 2"},
+		{in: "2x/3", out: "2 * x / 3"},
+		{in: "1/x", out: "1 / x"},
+		{in: "-2/(3x)", out: "-2 / (3 * x)"},
+		{in: "x/y", out: "x / y"},
+		{in: "-x*y", out: "-x * y"},
+		{in: "-(x^2)", out: "-x ^ 2"},
+		{in: "1 - x", out: "-x + 1"},
+		{in: "x - (y - x)", out: "2 * x - y"},
+		{in: "2(x+1)", out: "2 * x + 2"},
+		{in: "(x+1)(x+1)", out: "(x + 1) ^ 2"},
+		{in: "(x+1)/(x+1)", out: "1"},
+		{in: "(2x+2)(x+1)", out: "2 * (x + 1) ^ 2"},
+		{in: "(x+1)/(-x-1)", out: "-1"},
+		{in: "x^(1/3)", out: "x ^ (1/3)"},
+		{in: "x^y", out: "x ^ y"},
+		{in: "(x^y)^2", out: "(x ^ y) ^ 2"},
+		{in: "(-1)^x", out: "(-1) ^ x"},
+		{in: "x/3 + 1/3", out: "x / 3 + 1/3"},
+		{in: "2π + π", out: "3 * π"},
+		{in: "√4 + √2", out: "√2 + 2"},
+		{in: "(1+2)!", out: "6"},
+		{in: "(x+1)!", out: "(x + 1)!"},
+		{in: "sin(x*1) + sin(x)", out: "2 * sin(x)"},
+		{in: "max(1+1, x)", out: "max(2, x)"},
+		{in: "x % (0-3)", out: "x % (-3)"},
+		{in: "(x%) - 1", out: "x% - 1"},
+		{in: "x + 10%", out: "x + 10%"},
+		{in: "x + (10%)", out: "x + 0.1"},
+		{in: "x + (y%)", out: "x + (y%)"},
+		{in: "1/0 + x", out: "1 / 0 + x"},
+		{in: "Σ(k, k, 1, 4) + x", out: "x + Σ(k, k, 1, 4)"},
+		{in: "Σ(k, k, 1, 10^9)", out: "Σ(k, k, 1, 1000000000)"},
+		{in: "(Σ(k, k, 1, 2) + 1)!", out: "(Σ(k, k, 1, 2) + 1)!"},
+		{in: "√(sin(0) + 4)", out: "√(sin(0) + 4)"},
+		{in: "Σ(1*k*x + 0, k, 1, n)", out: "Σ(k * x, k, 1, n)"},
+		{in: "∫(x+x, x, 0, 1)", out: "∫(2 * x, x, 0, 1)"},
+		{in: "a = 2*3", out: "a = 6"},
+		{in: "f(x) = x*x + 0", out: "f(x) = x ^ 2"},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			if got := Pretty(Simplify(tree)); got != tc.out {
+				t.Fatalf("expected %q, got %q", tc.out, got)
+			}
+		})
+	}
+	// a user function is not called either
+	funcs := DefaultFunctions.Clone()
+	if err := funcs.Define(UserFunc{Name: "f", Params: []string{"x"}, Body: VariableNode{Name: "x"}}); err != nil {
+		t.Fatalf("define failed: %v", err)
+	}
+	tree, err := Parser{Functions: funcs}.ParseString("f(2) * 1 + Σ(k, k, 1, 3)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got := Pretty(Simplify(tree)); got != "f(2) + Σ(k, k, 1, 3)" {
+		t.Fatalf("expected f(2) + Σ(k, k, 1, 3), got %q", got)
+	}
+}
+
+// TestSimplifyPreservesValue checks random trees against their
+// simplifications: both evaluate to the same value, the simplification
+// reads back as written, and simplifying again changes nothing. Trees
+// with Floats in them leave out the operators whose results jump, since
+// Floats computed in a different order may land either side of a jump.
+func TestSimplifyPreservesValue(t *testing.T) {
+	env := NewEnvironment()
+	env.Set("x", Rat{big.NewRat(3, 2)})
+	env.Set("y", Int{big.NewInt(-2)})
+	env.Set("z", Float{new(big.Float).SetPrec(64).SetFloat64(1.25)})
+	ev := Evaluator{Env: env}
+	for seed := int64(1); seed <= 10; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		checked := 0
+		for i := 0; i < 2000; i++ {
+			tree := randomTree(rng, 4, i%2 == 0)
+			want, err := ev.Eval(tree)
+			if err != nil {
+				continue
+			}
+			checked++
+			simple := Simplify(tree)
+			src := Pretty(simple)
+			got, err := ev.Eval(simple)
+			if err != nil {
+				t.Fatalf("%s simplified to %s, which failed: %v", Pretty(tree), src, err)
+			}
+			if !sameValue(want, got) {
+				t.Fatalf("%s is %v but simplified to %s, which is %v", Pretty(tree), want, src, got)
+			}
+			reread, err := ParseString(src)
+			if err != nil {
+				t.Fatalf("%s simplified to %s, which does not parse: %v", Pretty(tree), src, err)
+			}
+			if got, err := ev.Eval(reread); err != nil || !sameValue(want, got) {
+				t.Fatalf("%s simplified to %s, which reads back as %v, %v", Pretty(tree), src, got, err)
+			}
+			if again := Pretty(Simplify(simple)); again != src {
+				t.Fatalf("%s simplified to %s, then to %s", Pretty(tree), src, again)
+			}
+		}
+		if checked < 500 {
+			t.Fatalf("only %d random trees evaluated with seed %d", checked, seed)
+		}
+	}
+}
+
+// randomTree builds a tree of at most depth levels. Unless floats is set
+// it has only exact values in it.
+func randomTree(rng *rand.Rand, depth int, floats bool) Node {
+	if depth == 0 || rng.Intn(4) == 0 {
+		switch rng.Intn(6) {
+		case 0:
+			return NumberNode{big.NewRat(int64(rng.Intn(7)), int64(rng.Intn(3)+1))}
+		case 1:
+			if floats {
+				return ConstantNode{Name: "pi", Symbol: "π"}
+			}
+			fallthrough
+		case 2, 3:
+			return NumberNode{big.NewRat(int64(rng.Intn(5)), 1)}
+		default:
+			if floats {
+				return VariableNode{Name: []string{"x", "y", "z"}[rng.Intn(3)]}
+			}
+			return VariableNode{Name: []string{"x", "y"}[rng.Intn(2)]}
+		}
+	}
+	switch rng.Intn(10) {
+	case 0:
+		return UnaryOpNode{Inner: randomTree(rng, depth-1, floats), Op: OpMinus}
+	case 1:
+		return ParenWrappedNode{Inner: randomTree(rng, depth-1, floats)}
+	case 2:
+		exp := NumberNode{big.NewRat(int64(rng.Intn(5)-1), 1)}
+		return BinaryOpNode{LHS: randomTree(rng, depth-1, floats), RHS: exp, Op: OpPower}
+	case 3:
+		if floats {
+			return UnaryOpNode{Inner: randomTree(rng, depth-1, floats), Op: OpSquareRoot}
+		}
+		return PostfixOpNode{Inner: randomTree(rng, depth-1, floats), Op: OpFactorial}
+	case 4:
+		return PostfixOpNode{Inner: randomTree(rng, depth-1, floats), Op: OpModulo}
+	case 5:
+		if !floats {
+			op := []Op{OpModulo, OpFloorDivide}[rng.Intn(2)]
+			return BinaryOpNode{LHS: randomTree(rng, depth-1, floats), RHS: randomTree(rng, depth-1, floats), Op: op}
+		}
+		fallthrough
+	default:
+		op := []Op{OpPlus, OpMinus, OpMultiply, OpDivide}[rng.Intn(4)]
+		return BinaryOpNode{LHS: randomTree(rng, depth-1, floats), RHS: randomTree(rng, depth-1, floats), Op: op}
+	}
+}
+
+// sameValue compares exact values exactly and Floats to within rounding.
+func sameValue(a, b Value) bool {
+	if numericRank(a) != rankFloat && numericRank(b) != rankFloat {
+		return toRat(a).Cmp(toRat(b)) == 0
+	}
+	x, y := toFloat(a, 64), toFloat(b, 64)
+	diff := new(big.Float).Sub(x, y)
+	diff.Abs(diff)
+	scale := new(big.Float).Abs(x)
+	if scale.Cmp(big.NewFloat(1)) < 0 {
+		scale.SetInt64(1)
+	}
+	return diff.Cmp(scale.Mul(scale, big.NewFloat(1e-9))) <= 0
+}
@@ -0,0 +1,371 @@
+package arith
+
+import (
+	"math"
+	"math/big"
+	"sort"
+)
+
+// The defaults a zero Solver uses.
+const (
+	DefaultSolveMin        = -1000
+	DefaultSolveMax        = 1000
+	DefaultSolveSamples    = 2000
+	DefaultSolveTolerance  = 1e-12
+	DefaultSolveIterations = 100
+)
+
+// A Solver finds the real roots of equations in one unknown numerically.
+// It samples the equation across a range, refines each change of sign
+// with Newton's method, or the secant method where the equation has no
+// derivative, falling back to bisection whenever a step leaves the
+// bracket, and looks for roots the equation touches without crossing
+// near the smallest samples. The zero Solver is ready to use.
+type Solver struct {
+	// Evaluator evaluates the sides of equations. Variables other than
+	// the unknown are read from its Env.
+	Evaluator Evaluator
+	// Min and Max bound the range roots are searched for in. Zero for
+	// both means DefaultSolveMin and DefaultSolveMax.
+	Min, Max float64
+	// Samples is the number of intervals the range is divided into.
+	// Roots closer together than an interval may be missed. Zero means
+	// DefaultSolveSamples.
+	Samples int
+	// Tolerance is how small a step must become, relative to the root,
+	// for a root to be accepted, and how close to zero the difference
+	// between the sides must come at a root the equation touches without
+	// crossing. Zero means DefaultSolveTolerance.
+	Tolerance float64
+	// MaxIterations limits the steps taken to refine each root. Zero
+	// means DefaultSolveIterations.
+	MaxIterations int
+}
+
+// Solve returns the roots of an equation for the named unknown in
+// ascending order. A tree that is not an EquationNode is solved as the
+// equation AsEquation spells it as. Roots are Floats, except that a root
+// at which the equation holds exactly for a nearby simple fraction is
+// returned as that fraction. An equation that does not mention the
+// unknown is reported as an *EvalError wrapping ErrNoUnknown, one that
+// holds wherever it can be evaluated in the range, as "x = x" does, as
+// one wrapping ErrIdentity, and one that cannot be evaluated anywhere in
+// the range as the error from evaluating it.
+func (s Solver) Solve(eq Node, unknown string) ([]Value, error) {
+	e := AsEquation(eq)
+	diff := BinaryOpNode{LHS: ParenWrappedNode{Inner: e.LHS}, RHS: ParenWrappedNode{Inner: e.RHS}, Op: OpMinus}
+	if !dependsOn(diff, unknown) {
+		return nil, &EvalError{Err: ErrNoUnknown, Node: eq}
+	}
+	sv := solver{Solver: s.withDefaults(), diff: diff, unknown: unknown}
+	if d, err := DeriveChecked(diff, unknown); err == nil {
+		sv.deriv = d
+	}
+	return sv.solve()
+}
+
+// AsEquation returns the equation a tree spells. An assignment is an
+// equation of its two sides, so "x = 3" equates x and 3, and any other
+// expression is equated to zero.
+func AsEquation(n Node) EquationNode {
+	switch v := n.(type) {
+	case EquationNode:
+		return v
+	case AssignNode:
+		return EquationNode{LHS: VariableNode{Name: v.Name}, RHS: v.Value}
+	}
+	return EquationNode{LHS: n, RHS: NumberNode{new(big.Rat)}}
+}
+
+func (s Solver) withDefaults() Solver {
+	if s.Min == 0 && s.Max == 0 {
+		s.Min, s.Max = DefaultSolveMin, DefaultSolveMax
+	}
+	if s.Samples <= 0 {
+		s.Samples = DefaultSolveSamples
+	}
+	if s.Tolerance <= 0 {
+		s.Tolerance = DefaultSolveTolerance
+	}
+	if s.MaxIterations <= 0 {
+		s.MaxIterations = DefaultSolveIterations
+	}
+	return s
+}
+
+// solver solves diff = 0 for unknown.
+type solver struct {
+	Solver
+	diff    Node
+	unknown string
+	// deriv is the derivative of diff, if it has one.
+	deriv Node
+}
+
+func (sv solver) solve() ([]Value, error) {
+	if !(sv.Min < sv.Max) {
+		return nil, &EvalError{Err: ErrDomain, Node: sv.diff}
+	}
+	xs := make([]float64, sv.Samples+1)
+	fs := make([]float64, sv.Samples+1)
+	var firstErr error
+	for i := range xs {
+		xs[i] = sv.Min + (sv.Max-sv.Min)*float64(i)/float64(sv.Samples)
+		f, err := sv.at(sv.diff, xs[i])
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		fs[i] = f
+	}
+	var roots []float64
+	evaluated, identity := false, true
+	for i := range xs {
+		if math.IsNaN(fs[i]) {
+			continue
+		}
+		evaluated = true
+		identity = identity && fs[i] == 0
+		if fs[i] == 0 {
+			// an equation that holds across an interval, as "floor(x) = 2"
+			// does, has only the start of the interval reported
+			if i == 0 || fs[i-1] != 0 {
+				roots = append(roots, xs[i])
+			} else if mid, _ := sv.at(sv.diff, (xs[i-1]+xs[i])/2); mid != 0 {
+				roots = append(roots, xs[i])
+			}
+			continue
+		}
+		if i > 0 && !math.IsNaN(fs[i-1]) && fs[i-1] != 0 && (fs[i-1] < 0) != (fs[i] < 0) {
+			if r, ok := sv.bracketed(xs[i-1], xs[i], fs[i-1], fs[i]); ok {
+				roots = append(roots, r)
+			}
+			continue
+		}
+		if i > 0 && i < len(xs)-1 && sv.touches(fs[i-1], fs[i], fs[i+1]) {
+			if r, ok := sv.touching(xs[i-1], xs[i], xs[i+1]); ok {
+				roots = append(roots, r)
+			}
+		}
+	}
+	switch {
+	case !evaluated:
+		return nil, firstErr
+	case identity:
+		// every sample is a root, so none of them is worth reporting
+		return nil, &EvalError{Err: ErrIdentity, Node: sv.diff}
+	}
+	return sv.values(roots), nil
+}
+
+// at evaluates n with the unknown bound to x, returning NaN if it cannot
+// be evaluated there.
+func (sv solver) at(n Node, x float64) (float64, error) {
+	scope := &Environment{parent: sv.Evaluator.Env}
+	scope.Set(sv.unknown, fromFloat64(x))
+	ev := sv.Evaluator
+	ev.Env = scope
+	v, err := ev.Eval(n)
+	if err != nil {
+		return math.NaN(), err
+	}
+	switch v := plain(v); v.(type) {
+	case Int, Rat, Float:
+		return toFloat64(v), nil
+	}
+	return math.NaN(), nil
+}
+
+// step returns the next estimate of a root after x, using the derivative
+// if there is one and the secant through (a, fa) and (b, fb) otherwise.
+func (sv solver) step(x, fx, a, b, fa, fb float64) float64 {
+	if sv.deriv != nil {
+		if d, _ := sv.at(sv.deriv, x); d != 0 && !math.IsNaN(d) {
+			return x - fx/d
+		}
+	}
+	return a - fa*(b-a)/(fb-fa)
+}
+
+// bracketed refines a root between a and b, where the sides differ with
+// opposite signs. A change of sign across a pole, as in 1/x, is not a
+// root, so the root is only accepted if the sides come closer than at
+// either end of the bracket.
+func (sv solver) bracketed(a, b, fa, fb float64) (float64, bool) {
+	limit := math.Min(math.Abs(fa), math.Abs(fb))
+	x := a - fa*(b-a)/(fb-fa)
+	for i := 0; i < sv.MaxIterations; i++ {
+		fx, _ := sv.at(sv.diff, x)
+		if math.IsNaN(fx) {
+			x = (a + b) / 2
+			continue
+		}
+		if fx == 0 || b-a <= sv.Tolerance*math.Max(1, math.Abs(x)) {
+			break
+		}
+		if (fx < 0) == (fa < 0) {
+			a, fa = x, fx
+		} else {
+			b, fb = x, fx
+		}
+		next := sv.step(x, fx, a, b, fa, fb)
+		if !(next >= a && next <= b) {
+			next = (a + b) / 2
+		}
+		if math.Abs(next-x) <= sv.Tolerance*math.Max(1, math.Abs(x)) {
+			x = next
+			break
+		}
+		x = next
+	}
+	fx, _ := sv.at(sv.diff, x)
+	return x, math.Abs(fx) < limit
+}
+
+// touches reports whether the middle of three samples without a change of
+// sign is closest to zero, as near a root the equation touches.
+func (sv solver) touches(f0, f1, f2 float64) bool {
+	if math.IsNaN(f0) || math.IsNaN(f2) || (f0 < 0) != (f1 < 0) || (f1 < 0) != (f2 < 0) {
+		return false
+	}
+	return math.Abs(f1) < math.Abs(f0) && math.Abs(f1) <= math.Abs(f2)
+}
+
+// touching looks for a root near x that the equation touches without
+// crossing, as "x^2 = 0" does, staying between lo and hi.
+func (sv solver) touching(lo, x, hi float64) (float64, bool) {
+	h := (hi - lo) / 4
+	prev := x + h
+	fprev, _ := sv.at(sv.diff, prev)
+	for i := 0; i < sv.MaxIterations; i++ {
+		fx, _ := sv.at(sv.diff, x)
+		switch {
+		case math.IsNaN(fx):
+			return 0, false
+		case math.Abs(fx) <= sv.Tolerance:
+			return x, true
+		}
+		next := sv.step(x, fx, prev, x, fprev, fx)
+		if math.IsNaN(next) || math.IsInf(next, 0) || next < lo || next > hi || next == x {
+			return 0, false
+		}
+		prev, fprev = x, fx
+		x = next
+	}
+	return 0, false
+}
+
+// values sorts roots, drops duplicates and converts them to Values,
+// preferring exact fractions.
+func (sv solver) values(roots []float64) []Value {
+	sort.Float64s(roots)
+	var vals []Value
+	last := math.NaN()
+	for _, r := range roots {
+		if math.Abs(r-last) <= 1e3*sv.Tolerance*math.Max(1, math.Abs(r)) {
+			continue
+		}
+		last = r
+		vals = append(vals, sv.exact(r))
+	}
+	return vals
+}
+
+// maxSnapDenominator bounds the denominators of the fractions roots are
+// checked against.
+const maxSnapDenominator = 1000
+
+// exact returns r as a fraction if the equation holds exactly at a
+// continued fraction convergent of r, and as a Float otherwise.
+func (sv solver) exact(r float64) Value {
+	scope := &Environment{parent: sv.Evaluator.Env}
+	ev := sv.Evaluator
+	ev.Env = scope
+	// convergents h/k of r, from the recurrences h = a*h1 + h2 and
+	// k = a*k1 + k2
+	h1, h2 := big.NewInt(1), big.NewInt(0)
+	k1, k2 := big.NewInt(0), big.NewInt(1)
+	frac := r
+	for i := 0; i < 20 && !math.IsInf(frac, 0); i++ {
+		a := math.Floor(frac)
+		ai, _ := big.NewFloat(a).Int(nil)
+		h := new(big.Int).Add(new(big.Int).Mul(ai, h1), h2)
+		k := new(big.Int).Add(new(big.Int).Mul(ai, k1), k2)
+		if k.Cmp(big.NewInt(maxSnapDenominator)) > 0 {
+			break
+		}
+		c := new(big.Rat).SetFrac(h, k)
+		scope.Set(sv.unknown, ratValue(c))
+		if v, err := ev.Eval(sv.diff); err == nil && isZero(v) {
+			return ratValue(c)
+		}
+		h1, h2 = h, h1
+		k1, k2 = k, k1
+		if frac == a {
+			break
+		}
+		frac = 1 / (frac - a)
+	}
+	return fromFloat64(r)
+}
+
+// Variables returns the names of the variables a tree reads, in sorted
+// order. Parameters of a function definition and the variables bound by
+// range operators are not included.
+func Variables(n Node) []string {
+	seen := map[string]bool{}
+	var walk func(n Node, params map[string]bool)
+	walk = func(n Node, params map[string]bool) {
+		switch v := n.(type) {
+		case VariableNode:
+			if !params[v.Name] {
+				seen[v.Name] = true
+			}
+		case ParenWrappedNode:
+			walk(v.Inner, params)
+		case BinaryOpNode:
+			walk(v.LHS, params)
+			walk(v.RHS, params)
+		case UnaryOpNode:
+			walk(v.Inner, params)
+		case PostfixOpNode:
+			walk(v.Inner, params)
+		case CallNode:
+			for _, arg := range v.Args {
+				walk(arg, params)
+			}
+		case ListNode:
+			for _, e := range v.Elems {
+				walk(e, params)
+			}
+		case AssignNode:
+			walk(v.Value, params)
+		case FunctionDefNode:
+			inner := make(map[string]bool, len(v.Params))
+			for _, param := range v.Params {
+				inner[param] = true
+			}
+			walk(v.Body, inner)
+		case EquationNode:
+			walk(v.LHS, params)
+			walk(v.RHS, params)
+		case ConvertNode:
+			walk(v.Value, params)
+			walk(v.Unit, params)
+		case RangeOpNode:
+			walk(v.From, params)
+			walk(v.To, params)
+			inner := map[string]bool{v.Var: true}
+			for param := range params {
+				inner[param] = true
+			}
+			walk(v.Body, inner)
+		}
+	}
+	walk(n, nil)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,152 @@
+package arith
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestSolve(t *testing.T) {
+	type testCase struct {
+		in       string
+		min, max float64
+		out      string
+		err      error
+	}
+	tcs := []testCase{
+		{in: "x^2 - 2 = 0", out: "-1.41421356237309 1.41421356237309"},
+		{in: "x^2 = 4", out: "-2 2"},
+		{in: "x^3 - x", out: "-1 0 1"},
+		{in: "x/3 = 1/7", out: "3/7"},
+		{in: "x = 3", out: "3"},
+		{in: "x^2 = 0", out: "0"},
+		{in: "(x - 0.5)^2", out: "0.5"},
+		{in: "(x-1)^2*(x+2)", out: "-2 1"},
+		{in: "x^4 - 5x^2 + 4 = 0", out: "-2 -1 1 2"},
+		{in: "x^2 + 1 = 0", out: ""},
+		{in: "1/x = 0", out: ""},
+		{in: "√x = 2", out: "4"},
+		{in: "cos(x) = x", out: "0.739085133215161"},
+		{in: "exp(x) = 2", out: "0.693147180559945"},
+		{in: "sin(x) = 0", min: -4, max: 4, out: "-3.14159265358979 0 3.14159265358979"},
+		{in: "floor(x) = 2", out: "2"},
+		{in: "x^2 = 4", min: 0, max: 10, out: "2"},
+		{in: "x = 3", min: 5, max: 10, out: ""},
+		{in: "2 = 3", err: ErrNoUnknown},
+		{in: "x = x", err: ErrIdentity},
+		{in: "2x = x + x", err: ErrIdentity},
+		{in: "sin(x) = 0.5", min: 0, max: 2, out: "0.523598775598299"},
+		{in: "x*y = 1", err: ErrUndefined},
+		{in: "x = 1", min: 1, max: -1, err: ErrDomain},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			roots, err := Solver{Min: tc.min, Max: tc.max}.Solve(tree, "x")
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			strs := make([]string, len(roots))
+			for i, r := range roots {
+				strs[i] = r.String()
+			}
+			if got := strings.Join(strs, " "); got != tc.out {
+				t.Fatalf("expected roots %q, got %q", tc.out, got)
+			}
+		})
+	}
+}
+
+func TestSolveEnv(t *testing.T) {
+	env := NewEnvironment()
+	env.Set("a", Int{big.NewInt(9)})
+	env.Set("x", Int{big.NewInt(100)})
+	tree, err := ParseString("x^2 = a")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	roots, err := Solver{Evaluator: Evaluator{Env: env}}.Solve(tree, "x")
+	if err != nil || len(roots) != 2 || roots[0].String() != "-3" || roots[1].String() != "3" {
+		t.Fatalf("unexpected roots %v, %v", roots, err)
+	}
+	if v, _ := env.Get("x"); v.String() != "100" {
+		t.Fatalf("solving changed x to %v", v)
+	}
+}
+
+func TestEquation(t *testing.T) {
+	tree, err := ParseString("x^2 - 2*x = 3 - 1")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	eq, ok := tree.(EquationNode)
+	if !ok {
+		t.Fatalf("expected an EquationNode, got %T", tree)
+	}
+	if got := Pretty(eq); got != "x ^ 2 - 2 * x = 3 - 1" {
+		t.Fatalf("unexpected pretty form %q", got)
+	}
+	if got := Pretty(Simplify(eq)); got != "x ^ 2 - 2 * x = 2" {
+		t.Fatalf("unexpected simplified form %q", got)
+	}
+	if _, err := EvalChecked(eq); !errors.Is(err, ErrEquation) {
+		t.Fatalf("expected %v, got %v", ErrEquation, err)
+	}
+	if names := Variables(eq); len(names) != 1 || names[0] != "x" {
+		t.Fatalf("unexpected variables %v", names)
+	}
+	for in, out := range map[string]string{
+		"x = 3":      "x = 3",
+		"x^2":        "x ^ 2 = 0",
+		"sin(x) = 0": "sin(x) = 0",
+	} {
+		tree, err := Parser{Functions: DefaultFunctions.Clone()}.ParseString(in)
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		if got := Pretty(AsEquation(tree)); got != out {
+			t.Fatalf("%s: expected equation %q, got %q", in, out, got)
+		}
+	}
+	funcs := DefaultFunctions.Clone()
+	if err := funcs.Define(UserFunc{Name: "f", Params: []string{"x"}, Body: VariableNode{Name: "x"}}); err != nil {
+		t.Fatalf("define failed: %v", err)
+	}
+	for _, in := range []string{"x = 3", "f(x) = 3"} {
+		tree, err := Parser{Functions: funcs, Equations: true}.ParseString(in)
+		if err != nil {
+			t.Fatalf("parse failed: %v", err)
+		}
+		if _, ok := tree.(EquationNode); !ok {
+			t.Fatalf("%s: expected an EquationNode, got %T", in, tree)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	tree, err := Parser{Functions: DefaultFunctions.Clone()}.ParseString("f(x, y) = x*z + max(y, b, π)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got := strings.Join(Variables(tree), " "); got != "b z" {
+		t.Fatalf("unexpected variables %q", got)
+	}
+	tree, err = ParseString("Σ(k*x, k, 1, n) + k")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got := strings.Join(Variables(tree), " "); got != "k n x" {
+		t.Fatalf("unexpected variables %q", got)
+	}
+}
@@ -0,0 +1,297 @@
+package arith
+
+import (
+	"math/big"
+	"sort"
+)
+
+// The statistical functions take any mix of numbers and lists, as in
+// "mean([1, 2, 3])" or "mean(1, 2, 3)", except that percentile, linreg and
+// corr take whole lists. Means, sums and variances are computed with the
+// Evaluator's arithmetic, so they are exact for exact data and keep the
+// unit of quantities; the functions that order their data take only real
+// numbers.
+
+// sumFunc is sum(...), the sum of the data, or zero for none.
+func sumFunc(ev Evaluator, args []Value) (Value, error) {
+	data := flatten(args)
+	if len(data) == 0 {
+		return Int{new(big.Int)}, nil
+	}
+	return ev.sum(data)
+}
+
+// sum adds data, which must not be empty.
+func (ev Evaluator) sum(data []Value) (Value, error) {
+	acc := data[0]
+	for _, v := range data[1:] {
+		var err error
+		if acc, err = ev.binary(OpPlus, acc, v); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// countFunc is count(...), the number of data.
+func countFunc(ev Evaluator, args []Value) (Value, error) {
+	return Int{big.NewInt(int64(len(flatten(args))))}, nil
+}
+
+// mean returns the arithmetic mean of data, which must not be empty.
+func (ev Evaluator) mean(data []Value) (Value, error) {
+	if len(data) == 0 {
+		return nil, ErrDomain
+	}
+	sum, err := ev.sum(data)
+	if err != nil {
+		return nil, err
+	}
+	return ev.binary(OpDivide, sum, Int{big.NewInt(int64(len(data)))})
+}
+
+// meanFunc is mean(...), the arithmetic mean of the data.
+func meanFunc(ev Evaluator, args []Value) (Value, error) {
+	return ev.mean(flatten(args))
+}
+
+// sorted returns a sorted copy of data, which must be real numbers.
+func sorted(data []Value) ([]Value, error) {
+	if len(data) == 0 || !isReal(data...) {
+		return nil, ErrDomain
+	}
+	s := append([]Value(nil), data...)
+	sort.SliceStable(s, func(i, j int) bool {
+		return compareValues(s[i], s[j]) < 0
+	})
+	return s, nil
+}
+
+// medianFunc is median(...), the middle of the sorted data, or the mean of
+// the two middle values of an even number of data.
+func medianFunc(ev Evaluator, args []Value) (Value, error) {
+	s, err := sorted(flatten(args))
+	if err != nil {
+		return nil, err
+	}
+	mid := len(s) / 2
+	if len(s)%2 == 1 {
+		return s[mid], nil
+	}
+	return ev.mean(s[mid-1 : mid+1])
+}
+
+// modeFunc is mode(...), the most frequent of the data, or the least of
+// the most frequent if several are equally frequent.
+func modeFunc(ev Evaluator, args []Value) (Value, error) {
+	s, err := sorted(flatten(args))
+	if err != nil {
+		return nil, err
+	}
+	best, bestRun := s[0], 0
+	for i := 0; i < len(s); {
+		j := i + 1
+		for j < len(s) && compareValues(s[j], s[i]) == 0 {
+			j++
+		}
+		if j-i > bestRun {
+			best, bestRun = s[i], j-i
+		}
+		i = j
+	}
+	return best, nil
+}
+
+// variance returns the variance of data: its mean squared deviation from
+// its mean, divided by one less than the number of data for a sample.
+func (ev Evaluator) variance(data []Value, sample bool) (Value, error) {
+	n := int64(len(data))
+	if sample {
+		n--
+	}
+	if n <= 0 {
+		return nil, ErrDomain
+	}
+	mean, err := ev.mean(data)
+	if err != nil {
+		return nil, err
+	}
+	squares := make([]Value, len(data))
+	for i, v := range data {
+		d, err := ev.binary(OpMinus, v, mean)
+		if err != nil {
+			return nil, err
+		}
+		if squares[i], err = ev.binary(OpMultiply, d, d); err != nil {
+			return nil, err
+		}
+	}
+	sum, err := ev.sum(squares)
+	if err != nil {
+		return nil, err
+	}
+	return ev.binary(OpDivide, sum, Int{big.NewInt(n)})
+}
+
+// varianceFunc returns variance(...), the sample variance, or with sample
+// false pvariance(...), the population variance.
+func varianceFunc(sample bool) Func {
+	return func(ev Evaluator, args []Value) (Value, error) {
+		return ev.variance(flatten(args), sample)
+	}
+}
+
+// stddevFunc returns stddev(...), the sample standard deviation, or with
+// sample false pstddev(...), the population standard deviation.
+func stddevFunc(sample bool) Func {
+	return func(ev Evaluator, args []Value) (Value, error) {
+		v, err := ev.variance(flatten(args), sample)
+		if err != nil {
+			return nil, err
+		}
+		return ev.unary(OpSquareRoot, v)
+	}
+}
+
+// percentileFunc is percentile(data, p), the value p percent of the way
+// through the sorted data, interpolating linearly between neighbours, so
+// percentile(data, 50) is the median.
+func percentileFunc(ev Evaluator, args []Value) (Value, error) {
+	data, ok := args[0].(List)
+	if !ok || !isReal(args[1]) {
+		return nil, ErrDomain
+	}
+	s, err := sorted(flatten(data))
+	if err != nil {
+		return nil, err
+	}
+	p := toRat(args[1])
+	if p.Sign() < 0 || p.Cmp(big.NewRat(100, 1)) > 0 {
+		return nil, ErrDomain
+	}
+	// the rank of p among the data, counting from zero
+	rank := new(big.Rat).Mul(p, big.NewRat(int64(len(s)-1), 100))
+	i := floorRat(rank).Int64()
+	if int(i) == len(s)-1 {
+		return s[i], nil
+	}
+	frac := ratValue(rank.Sub(rank, new(big.Rat).SetInt64(i)))
+	d, err := ev.binary(OpMinus, s[i+1], s[i])
+	if err != nil {
+		return nil, err
+	}
+	if d, err = ev.binary(OpMultiply, d, frac); err != nil {
+		return nil, err
+	}
+	return ev.binary(OpPlus, s[i], d)
+}
+
+// pairs returns the two lists of paired data linreg and corr take, which
+// must be the same length and hold at least two pairs.
+func pairs(args []Value) (List, List, error) {
+	xs, xok := args[0].(List)
+	ys, yok := args[1].(List)
+	if !xok || !yok {
+		return nil, nil, ErrDomain
+	}
+	if len(xs) != len(ys) {
+		return nil, nil, ErrLength
+	}
+	if len(xs) < 2 {
+		return nil, nil, ErrDomain
+	}
+	return xs, ys, nil
+}
+
+// deviations returns the sums of the products of the deviations of xs and
+// ys from their means: sxx, syy and sxy.
+func (ev Evaluator) deviations(xs, ys List) (sxx, syy, sxy Value, err error) {
+	mx, err := ev.mean(xs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	my, err := ev.mean(ys)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	dx, err := ev.binary(OpMinus, xs, mx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	dy, err := ev.binary(OpMinus, ys, my)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sums := make([]Value, 3)
+	for i, pair := range [][2]Value{{dx, dx}, {dy, dy}, {dx, dy}} {
+		prod, err := ev.binary(OpMultiply, pair[0], pair[1])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if sums[i], err = ev.sum(prod.(List)); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return sums[0], sums[1], sums[2], nil
+}
+
+// linregFunc is linreg(xs, ys), the least squares line through the points
+// (xs[i], ys[i]), as the list [slope, intercept].
+func linregFunc(ev Evaluator, args []Value) (Value, error) {
+	xs, ys, err := pairs(args)
+	if err != nil {
+		return nil, err
+	}
+	sxx, _, sxy, err := ev.deviations(xs, ys)
+	if err != nil {
+		return nil, err
+	}
+	if isZero(toQuantity(sxx).Value) {
+		// every x is the same, so the line is vertical
+		return nil, ErrDomain
+	}
+	slope, err := ev.binary(OpDivide, sxy, sxx)
+	if err != nil {
+		return nil, err
+	}
+	mx, err := ev.mean(xs)
+	if err != nil {
+		return nil, err
+	}
+	my, err := ev.mean(ys)
+	if err != nil {
+		return nil, err
+	}
+	intercept, err := ev.binary(OpMultiply, slope, mx)
+	if err != nil {
+		return nil, err
+	}
+	if intercept, err = ev.binary(OpMinus, my, intercept); err != nil {
+		return nil, err
+	}
+	return List{slope, intercept}, nil
+}
+
+// corrFunc is corr(xs, ys), the correlation coefficient of paired data,
+// from -1 for points on a falling line to 1 for points on a rising one.
+func corrFunc(ev Evaluator, args []Value) (Value, error) {
+	xs, ys, err := pairs(args)
+	if err != nil {
+		return nil, err
+	}
+	sxx, syy, sxy, err := ev.deviations(xs, ys)
+	if err != nil {
+		return nil, err
+	}
+	if isZero(toQuantity(sxx).Value) || isZero(toQuantity(syy).Value) {
+		return nil, ErrDomain
+	}
+	den, err := ev.binary(OpMultiply, sxx, syy)
+	if err != nil {
+		return nil, err
+	}
+	if den, err = ev.unary(OpSquareRoot, den); err != nil {
+		return nil, err
+	}
+	return ev.binary(OpDivide, sxy, den)
+}
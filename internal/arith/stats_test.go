@@ -0,0 +1,65 @@
+package arith
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatistics(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+		err error
+	}
+	tcs := []testCase{
+		{in: "sum([1, 2, 3], 4)", out: "10"},
+		{in: "sum([])", out: "0"},
+		{in: "count([1, [2, 3]])", out: "3"},
+		{in: "mean([1, 2, 3, 4])", out: "2.5"},
+		{in: "mean(1, 2)", out: "1.5"},
+		{in: "mean([1 m, 2 m])", out: "1.5 m"},
+		{in: "median(3, 1, 2)", out: "2"},
+		{in: "median([4, 1, 3, 2])", out: "2.5"},
+		{in: "mode([3, 3, 1, 2, 2])", out: "2"},
+		{in: "variance([2, 4, 4, 4, 5, 5, 7, 9])", out: "32/7"},
+		{in: "pvariance([2, 4, 4, 4, 5, 5, 7, 9])", out: "4"},
+		{in: "pstddev([2, 4, 4, 4, 5, 5, 7, 9])", out: "2"},
+		{in: "stddev([1 m, 3 m])", out: "1.414213562373095049 m"},
+		{in: "percentile([1, 2, 3, 4, 5], 90)", out: "4.6"},
+		{in: "percentile([15, 20, 35, 40, 50], 40)", out: "29"},
+		{in: "percentile([5, 1], 100)", out: "5"},
+		{in: "linreg([1, 2, 3], [2, 4, 6.5])", out: "[2.25, -1/3]"},
+		{in: "corr([1, 2, 3], [2, 4, 6])", out: "1"},
+		{in: "corr([1, 2, 3], [3, 2, 1])", out: "-1"},
+		{in: "mean()", err: ErrDomain},
+		{in: "variance(1)", err: ErrDomain},
+		{in: "median([1 m])", err: ErrDomain},
+		{in: "percentile([1, 2], 101)", err: ErrDomain},
+		{in: "percentile(1, 50)", err: ErrDomain},
+		{in: "linreg([1, 2], [1])", err: ErrLength},
+		{in: "linreg([1, 1], [1, 2])", err: ErrDomain},
+		{in: "corr([1, 2], [3, 3])", err: ErrDomain},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := Parser{Units: DefaultUnits}.ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			v, err := EvalChecked(tree)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := v.String(); got != tc.out {
+				t.Fatalf("expected %v, got %v", tc.out, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,547 @@
+package arith
+
+import (
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The base dimensions, indexing a Dimension. Each is measured in its SI
+// base unit, in bits for information, and in the reference currency of
+// the exchange rates for money.
+const (
+	DimLength = iota
+	DimMass
+	DimTime
+	DimCurrent
+	DimTemperature
+	DimAmount
+	DimLuminosity
+	DimInformation
+	DimCurrency
+	numDims
+)
+
+// A Dimension holds the exponent of each base dimension of a quantity:
+// speed is length^1 time^-1. Quantities may only be added, subtracted and
+// converted to one another when their Dimensions are equal.
+type Dimension [numDims]int
+
+func (d Dimension) isZero() bool {
+	return d == Dimension{}
+}
+
+// A PrefixSet selects the prefixes a unit may be written with.
+type PrefixSet uint8
+
+const (
+	// SIPrefixes are the decimal prefixes from q (10^-30) to Q (10^30), as
+	// in "km", "µs" and "GB". Both µ and u spell micro.
+	SIPrefixes PrefixSet = 1 << iota
+	// BinaryPrefixes are the powers of 1024 from Ki to Yi, as in "GiB".
+	BinaryPrefixes
+)
+
+// siPrefixes and binaryPrefixes map prefixes to the power of ten or two
+// they scale by.
+var (
+	siPrefixes = map[string]int{
+		"Q": 30, "R": 27, "Y": 24, "Z": 21, "E": 18, "P": 15, "T": 12, "G": 9, "M": 6, "k": 3, "h": 2, "da": 1,
+		"d": -1, "c": -2, "m": -3, "µ": -6, "u": -6, "n": -9, "p": -12, "f": -15, "a": -18, "z": -21, "y": -24, "r": -27, "q": -30,
+	}
+	binaryPrefixes = map[string]int{
+		"Ki": 10, "Mi": 20, "Gi": 30, "Ti": 40, "Pi": 50, "Ei": 60, "Zi": 70, "Yi": 80,
+	}
+)
+
+// A UnitDef defines a unit as a multiple of the base units.
+type UnitDef struct {
+	Dim Dimension
+	// Scale is the size of the unit in base units, e.g. 60 for minutes
+	// and 1/1000 for grams, as mass is measured in kilograms.
+	Scale    *big.Rat
+	Prefixes PrefixSet
+}
+
+// A UnitRegistry holds the units expressions can refer to by name. The
+// zero UnitRegistry is empty and ready to use, and a UnitRegistry is safe
+// for concurrent use.
+type UnitRegistry struct {
+	mu    sync.RWMutex
+	units map[string]UnitDef
+}
+
+// NewUnitRegistry returns an empty UnitRegistry.
+func NewUnitRegistry() *UnitRegistry {
+	return &UnitRegistry{}
+}
+
+// Register makes def available as name, and as name with any of its
+// prefixes, replacing any unit already registered as name. It panics if
+// name is not an identifier.
+func (r *UnitRegistry) Register(name string, def UnitDef) {
+	if rs := []rune(name); len(rs) == 0 || scanIdent(rs) != len(rs) {
+		panic("arith: invalid unit name " + strconv.Quote(name))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.units == nil {
+		r.units = make(map[string]UnitDef)
+	}
+	r.units[name] = def
+}
+
+// Lookup returns the unit spelled name, either registered as name or a
+// prefix followed by the name of a unit that takes it. Registered names
+// win, so "min" is minutes rather than milli-inches, and longer prefixes
+// win over shorter ones.
+func (r *UnitRegistry) Lookup(name string) (UnitDef, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if def, ok := r.units[name]; ok {
+		return def, true
+	}
+	rs := []rune(name)
+	for _, n := range []int{2, 1} {
+		if len(rs) <= n {
+			continue
+		}
+		prefix, base := string(rs[:n]), string(rs[n:])
+		def, ok := r.units[base]
+		if !ok {
+			continue
+		}
+		if e, ok := siPrefixes[prefix]; ok && def.Prefixes&SIPrefixes != 0 {
+			return def.scaled(powRat(big.NewRat(10, 1), e)), true
+		}
+		if e, ok := binaryPrefixes[prefix]; ok && def.Prefixes&BinaryPrefixes != 0 {
+			return def.scaled(powRat(big.NewRat(2, 1), e)), true
+		}
+	}
+	return UnitDef{}, false
+}
+
+// scaled returns def multiplied by k, without prefixes of its own.
+func (def UnitDef) scaled(k *big.Rat) UnitDef {
+	return UnitDef{Dim: def.Dim, Scale: new(big.Rat).Mul(def.Scale, k)}
+}
+
+// Names returns the registered names, without prefixes, in sorted order.
+func (r *UnitRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.units))
+	for name := range r.units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clone returns a copy of r. Registering units with the copy does not
+// affect r.
+func (r *UnitRegistry) Clone() *UnitRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := &UnitRegistry{units: make(map[string]UnitDef, len(r.units))}
+	for name, def := range r.units {
+		c.units[name] = def
+	}
+	return c
+}
+
+// DefaultUnits are the SI base and common derived units, the usual units
+// of time, the bit and the byte, and imperial lengths and masses. Units
+// are opt in for a Parser, as names like m and s would otherwise hide
+// variables, so DefaultUnits are only used by an Evaluator that does not
+// specify a UnitRegistry.
+var DefaultUnits = defaultUnits()
+
+func defaultUnits() *UnitRegistry {
+	r := NewUnitRegistry()
+	dim := func(exps ...int) Dimension {
+		var d Dimension
+		copy(d[:], exps)
+		return d
+	}
+	length, mass, time := dim(1), dim(0, 1), dim(0, 0, 1)
+	energy := dim(2, 1, -2)
+	for _, u := range []struct {
+		name     string
+		dim      Dimension
+		scale    *big.Rat
+		prefixes PrefixSet
+	}{
+		{"m", length, big.NewRat(1, 1), SIPrefixes},
+		{"g", mass, big.NewRat(1, 1000), SIPrefixes},
+		{"s", time, big.NewRat(1, 1), SIPrefixes},
+		{"A", dim(0, 0, 0, 1), big.NewRat(1, 1), SIPrefixes},
+		{"K", dim(0, 0, 0, 0, 1), big.NewRat(1, 1), SIPrefixes},
+		{"mol", dim(0, 0, 0, 0, 0, 1), big.NewRat(1, 1), SIPrefixes},
+		{"cd", dim(0, 0, 0, 0, 0, 0, 1), big.NewRat(1, 1), SIPrefixes},
+		{"bit", dim(0, 0, 0, 0, 0, 0, 0, 1), big.NewRat(1, 1), SIPrefixes | BinaryPrefixes},
+		{"B", dim(0, 0, 0, 0, 0, 0, 0, 1), big.NewRat(8, 1), SIPrefixes | BinaryPrefixes},
+
+		{"min", time, big.NewRat(60, 1), 0},
+		{"h", time, big.NewRat(3600, 1), 0},
+		{"d", time, big.NewRat(86400, 1), 0},
+		{"wk", time, big.NewRat(604800, 1), 0},
+		// the Julian year of 365.25 days
+		{"yr", time, big.NewRat(31557600, 1), 0},
+
+		{"Hz", dim(0, 0, -1), big.NewRat(1, 1), SIPrefixes},
+		{"N", dim(1, 1, -2), big.NewRat(1, 1), SIPrefixes},
+		{"Pa", dim(-1, 1, -2), big.NewRat(1, 1), SIPrefixes},
+		{"J", energy, big.NewRat(1, 1), SIPrefixes},
+		{"Wh", energy, big.NewRat(3600, 1), SIPrefixes},
+		{"W", dim(2, 1, -3), big.NewRat(1, 1), SIPrefixes},
+		{"C", dim(0, 0, 1, 1), big.NewRat(1, 1), SIPrefixes},
+		{"V", dim(2, 1, -3, -1), big.NewRat(1, 1), SIPrefixes},
+		{"L", dim(3), big.NewRat(1, 1000), SIPrefixes},
+		{"t", mass, big.NewRat(1000, 1), SIPrefixes},
+		{"ha", dim(2), big.NewRat(10000, 1), 0},
+
+		// "in" is taken by conversions, so inches are spelled out
+		{"inch", length, big.NewRat(254, 10000), 0},
+		{"ft", length, big.NewRat(3048, 10000), 0},
+		{"yd", length, big.NewRat(9144, 10000), 0},
+		{"mi", length, big.NewRat(1609344, 1000), 0},
+		{"lb", mass, big.NewRat(45359237, 100000000), 0},
+		{"oz", mass, big.NewRat(45359237, 1600000000), 0},
+	} {
+		r.Register(u.name, UnitDef{Dim: u.dim, Scale: u.scale, Prefixes: u.prefixes})
+	}
+	return r
+}
+
+// powRat returns x^e.
+func powRat(x *big.Rat, e int) *big.Rat {
+	n := e
+	if n < 0 {
+		n = -n
+	}
+	res := new(big.Rat).SetFrac(
+		new(big.Int).Exp(x.Num(), big.NewInt(int64(n)), nil),
+		new(big.Int).Exp(x.Denom(), big.NewInt(int64(n)), nil),
+	)
+	if e < 0 {
+		res.Inv(res)
+	}
+	return res
+}
+
+// A Unit is a product of named units raised to integer powers, as in
+// "km/h" or "kg*m/s^2". The empty Unit is dimensionless.
+type Unit []UnitFactor
+
+// A UnitFactor is a named unit raised to a nonzero power.
+type UnitFactor struct {
+	Name string
+	Exp  int
+	Def  UnitDef
+}
+
+// Dim returns the Dimension of u.
+func (u Unit) Dim() Dimension {
+	var d Dimension
+	for _, f := range u {
+		for i, e := range f.Def.Dim {
+			d[i] += e * f.Exp
+		}
+	}
+	return d
+}
+
+// Scale returns the size of u in base units.
+func (u Unit) Scale() *big.Rat {
+	res := big.NewRat(1, 1)
+	for _, f := range u {
+		res.Mul(res, powRat(f.Def.Scale, f.Exp))
+	}
+	return res
+}
+
+// String writes u as it would be parsed, as in "m/s^2". The empty Unit is
+// written "1".
+func (u Unit) String() string {
+	if len(u) == 0 {
+		return "1"
+	}
+	var num, den []string
+	for _, f := range u {
+		e := f.Exp
+		if e < 0 {
+			e = -e
+		}
+		s := f.Name
+		if e != 1 {
+			s += string(OpPower) + strconv.Itoa(e)
+		}
+		if f.Exp > 0 {
+			num = append(num, s)
+		} else {
+			den = append(den, s)
+		}
+	}
+	if len(num) == 0 {
+		for i, f := range u {
+			den[i] = f.Name + string(OpPower) + strconv.Itoa(f.Exp)
+		}
+		return strings.Join(den, string(OpMultiply))
+	}
+	s := strings.Join(num, string(OpMultiply))
+	switch len(den) {
+	case 0:
+	case 1:
+		s += string(OpDivide) + den[0]
+	default:
+		s += string(OpDivide) + "(" + strings.Join(den, string(OpMultiply)) + ")"
+	}
+	return s
+}
+
+// mulUnits returns the product of u and v raised to exp, which is 1 for
+// multiplication and -1 for division, and the factor the magnitude must be
+// multiplied by. Factors of v with the dimension of a factor of u are
+// converted to it, so "2 km * 300 m" is in km^2 and "1 km / 1 m" cancels.
+func mulUnits(u, v Unit, exp int) (Unit, *big.Rat) {
+	res := append(Unit(nil), u...)
+	k := big.NewRat(1, 1)
+	for _, f := range v {
+		e := f.Exp * exp
+		i := 0
+		for ; i < len(res); i++ {
+			if res[i].Name == f.Name {
+				break
+			}
+			if res[i].Def.Dim == f.Def.Dim {
+				k.Mul(k, powRat(new(big.Rat).Quo(f.Def.Scale, res[i].Def.Scale), e))
+				break
+			}
+		}
+		if i == len(res) {
+			res = append(res, UnitFactor{Name: f.Name, Def: f.Def})
+		}
+		res[i].Exp += e
+	}
+	kept := res[:0]
+	for _, f := range res {
+		if f.Exp != 0 {
+			kept = append(kept, f)
+		}
+	}
+	return kept, k
+}
+
+// powUnit returns u raised to a power, which may be a fraction n/d if
+// every exponent of u is divisible by d, as √(m^2) is m.
+func powUnit(u Unit, n, d int) (Unit, bool) {
+	res := make(Unit, len(u))
+	for i, f := range u {
+		if f.Exp*n%d != 0 {
+			return nil, false
+		}
+		res[i] = UnitFactor{Name: f.Name, Exp: f.Exp * n / d, Def: f.Def}
+	}
+	return res, true
+}
+
+// A Quantity is a number with a unit, as in "5 km". Evaluation never
+// produces a dimensionless Quantity; those are returned as numbers.
+type Quantity struct {
+	Value Value
+	Unit  Unit
+	// Mixed writes a duration in mixed units, as in "3d 4h". Differences
+	// of dates are mixed, as are sums and differences of durations in
+	// different units, like "3d 4h", or of a mixed duration, and
+	// negations of mixed durations. Conversions and other arithmetic
+	// give plain quantities, as in "76 h".
+	Mixed bool
+}
+
+// String writes q as its value and unit, as in "5.3 km".
+func (q Quantity) String() string {
+	return Formatter{}.Format(q)
+}
+
+// isQuantity reports whether any of vals is a Quantity.
+func isQuantity(vals ...Value) bool {
+	for _, v := range vals {
+		if _, ok := v.(Quantity); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// toQuantity returns v as a Quantity, dimensionless if v is a number.
+func toQuantity(v Value) Quantity {
+	if q, ok := v.(Quantity); ok {
+		return q
+	}
+	return Quantity{Value: v}
+}
+
+// quantity returns v in unit u, folding a dimensionless unit into v.
+func (ev Evaluator) quantity(v Value, u Unit) (Value, error) {
+	if len(u) == 0 {
+		return v, nil
+	}
+	if u.Dim().isZero() {
+		return ev.binary(OpMultiply, v, ratValue(u.Scale()))
+	}
+	return Quantity{Value: v, Unit: u}, nil
+}
+
+// rescale converts the magnitude v of a quantity from unit from to unit
+// to, which must have the same Dimension.
+func (ev Evaluator) rescale(v Value, from, to Unit) (Value, error) {
+	k := new(big.Rat).Quo(from.Scale(), to.Scale())
+	if k.Cmp(big.NewRat(1, 1)) == 0 {
+		return v, nil
+	}
+	return ev.binary(OpMultiply, v, ratValue(k))
+}
+
+// unit evaluates a named unit as one of it.
+func (ev Evaluator) unit(name string) (Value, error) {
+	units := ev.Units
+	if units == nil {
+		units = DefaultUnits
+	}
+	def, ok := units.Lookup(name)
+	if !ok {
+		return nil, ErrUnknownUnit
+	}
+	one, err := ev.Eval(NumberNode{big.NewRat(1, 1)})
+	if err != nil {
+		return nil, err
+	}
+	return Quantity{Value: one, Unit: Unit{{Name: name, Exp: 1, Def: def}}}, nil
+}
+
+// quantityBinary applies an operator where either operand is a Quantity.
+// Sums, differences and remainders are in the unit of the left operand;
+// products and quotients combine their units.
+func (ev Evaluator) quantityBinary(op Op, lhs, rhs Value) (Value, error) {
+	l, r := toQuantity(lhs), toQuantity(rhs)
+	switch op {
+	case OpPlus, OpMinus, OpModulo, OpFloorDivide:
+		if l.Unit.Dim() != r.Unit.Dim() {
+			return nil, &DimensionError{LHS: l.Unit, RHS: r.Unit}
+		}
+		rv, err := ev.rescale(r.Value, r.Unit, l.Unit)
+		if err != nil {
+			return nil, err
+		}
+		res, err := ev.binary(op, l.Value, rv)
+		if err != nil || op == OpFloorDivide {
+			// a floored quotient counts how many times r fits in l
+			return res, err
+		}
+		_, ldur := durationUnit(l.Unit)
+		_, rdur := durationUnit(r.Unit)
+		if op != OpModulo && ldur && rdur && (l.Mixed || r.Mixed || l.Unit[0].Name != r.Unit[0].Name) {
+			return Quantity{Value: res, Unit: l.Unit, Mixed: true}, nil
+		}
+		return ev.quantity(res, l.Unit)
+	case OpMultiply, OpDivide:
+		exp := 1
+		if op == OpDivide {
+			exp = -1
+		}
+		u, k := mulUnits(l.Unit, r.Unit, exp)
+		res, err := ev.binary(op, l.Value, r.Value)
+		if err != nil {
+			return nil, err
+		}
+		if k.Cmp(big.NewRat(1, 1)) != 0 {
+			if res, err = ev.binary(OpMultiply, res, ratValue(k)); err != nil {
+				return nil, err
+			}
+		}
+		return ev.quantity(res, u)
+	case OpPower:
+		if len(r.Unit) != 0 {
+			return nil, &DimensionError{LHS: r.Unit}
+		}
+		e := toRat(r.Value)
+		if e == nil || !e.Num().IsInt64() || !e.Denom().IsInt64() {
+			return nil, ErrDomain
+		}
+		u, ok := powUnit(l.Unit, int(e.Num().Int64()), int(e.Denom().Int64()))
+		if !ok {
+			return nil, ErrDomain
+		}
+		res, err := ev.binary(OpPower, l.Value, r.Value)
+		if err != nil {
+			return nil, err
+		}
+		return ev.quantity(res, u)
+	}
+	return nil, ErrDomain
+}
+
+// quantityUnary applies a unary operator to the magnitude of q.
+func (ev Evaluator) quantityUnary(op Op, q Quantity) (Value, error) {
+	switch op {
+	case OpMinus:
+		res, err := ev.unary(op, q.Value)
+		if err != nil {
+			return nil, err
+		}
+		return Quantity{Value: res, Unit: q.Unit, Mixed: q.Mixed}, nil
+	case OpSquareRoot:
+		u, ok := powUnit(q.Unit, 1, 2)
+		if !ok {
+			return nil, ErrDomain
+		}
+		res, err := ev.unary(op, q.Value)
+		if err != nil {
+			return nil, err
+		}
+		return ev.quantity(res, u)
+	}
+	return nil, ErrDomain
+}
+
+// convert expresses v in the unit of target, as in "90 min to h". A
+// target with a magnitude other than one counts in multiples of it.
+func (ev Evaluator) convert(v, target Value) (Value, error) {
+	if l, ok := v.(List); ok {
+		return mapList(l, func(e Value) (Value, error) {
+			return ev.convert(e, target)
+		})
+	}
+	q, t := toQuantity(v), toQuantity(target)
+	if q.Unit.Dim() != t.Unit.Dim() {
+		return nil, &DimensionError{LHS: q.Unit, RHS: t.Unit}
+	}
+	res, err := ev.rescale(q.Value, q.Unit, t.Unit)
+	if err != nil {
+		return nil, err
+	}
+	if res, err = ev.binary(OpDivide, res, t.Value); err != nil {
+		return nil, err
+	}
+	return ev.quantity(res, t.Unit)
+}
+
+// keepUnit adapts fn to apply to the magnitude of a Quantity and keep its
+// unit, as in "round(2.4 km)". abs, re, im, conj and the rounding
+// functions are adapted with it.
+func keepUnit(fn func(Evaluator, Value) (Value, error)) func(Evaluator, Value) (Value, error) {
+	return func(ev Evaluator, v Value) (Value, error) {
+		q, ok := v.(Quantity)
+		if !ok {
+			return fn(ev, v)
+		}
+		res, err := fn(ev, q.Value)
+		if err != nil {
+			return nil, err
+		}
+		return Quantity{Value: res, Unit: q.Unit}, nil
+	}
+}
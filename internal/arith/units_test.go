@@ -0,0 +1,185 @@
+package arith
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestUnits(t *testing.T) {
+	type testCase struct {
+		in  string
+		out string
+		err error
+	}
+	tcs := []testCase{
+		{in: "5 km + 300 m", out: "5.3 km"},
+		{in: "300 m + 5 km", out: "5300 m"},
+		{in: "2 GiB in MB", out: "2147.483648 MB"},
+		{in: "90 min to h", out: "1.5 h"},
+		{in: "1 KiB to bit", out: "8192 bit"},
+		{in: "5 km + 300 m to mi", out: "165625/50292 mi"},
+		{in: "1 mi to ft", out: "5280 ft"},
+		{in: "2 lb to g", out: "907.18474 g"},
+		{in: "100 km / 2 h", out: "50 km/h"},
+		{in: "100 km / 2 h to m/s", out: "125/9 m/s"},
+		{in: "3 m * 4 m", out: "12 m^2"},
+		{in: "2 km * 300 m", out: "0.6 km^2"},
+		{in: "1 km / 1 m", out: "1000"},
+		{in: "1/2 km", out: "0.5 km^-1"},
+		{in: "3 m^2 / 2 m", out: "1.5 m"},
+		{in: "6 m / 2 s^2", out: "3 m/s^2"},
+		{in: "1/s", out: "1 s^-1"},
+		{in: "10 N * 2 m to J", out: "20 J"},
+		{in: "1 kWh to J", out: "3600000 J"},
+		{in: "√(16 m^2)", out: "4 m"},
+		{in: "(3 m)^2", out: "9 m^2"},
+		{in: "-5 km", out: "-5 km"},
+		{in: "200 m + 10%", out: "220 m"},
+		{in: "7 m % 2 m", out: "1 m"},
+		{in: "7 m // 200 cm", out: "3"},
+		{in: "abs(-2 s)", out: "2 s"},
+		{in: "round(2.4 km)", out: "2 km"},
+		{in: "Σ(k*m, k, 1, 3)", out: "6 m"},
+		{in: "2 µs to ns", out: "2000 ns"},
+		{in: "1 L to cm^3", out: "1000 cm^3"},
+		{in: "3 kg + 2 s", err: &DimensionError{}},
+		{in: "1 m + 1", err: &DimensionError{}},
+		{in: "2^(1 s)", err: &DimensionError{}},
+		{in: "1 h to m", err: &DimensionError{}},
+		{in: "√(2 m)", err: ErrDomain},
+		{in: "sin(1 m)", err: ErrDomain},
+		{in: "(2 m)!", err: ErrDomain},
+		{in: "1 m & 1", err: ErrDomain},
+		{in: "max(1 m, 2 m)", err: ErrDomain},
+		{in: "5 km / 0", err: ErrDivideByZero},
+	}
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.in, func(t *testing.T) {
+			tree, err := Parser{Units: DefaultUnits}.ParseString(tc.in)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			v, err := EvalChecked(tree)
+			if tc.err != nil {
+				var derr *DimensionError
+				if errors.As(tc.err, &derr) {
+					if !errors.As(err, &derr) {
+						t.Fatalf("expected a DimensionError, got %v", err)
+					}
+				} else if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := v.String(); got != tc.out {
+				t.Fatalf("expected %v, got %v", tc.out, got)
+			}
+		})
+	}
+}
+
+func TestDimensionError(t *testing.T) {
+	tree, err := Parser{Units: DefaultUnits}.ParseString("3 kg + 2 s")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	_, err = EvalChecked(tree)
+	var derr *DimensionError
+	if !errors.As(err, &derr) {
+		t.Fatalf("expected a DimensionError, got %v", err)
+	}
+	if got := err.Error(); got != "incompatible units kg and s in 3 kg + 2 s" {
+		t.Fatalf("unexpected message %q", got)
+	}
+}
+
+func TestUnitLookup(t *testing.T) {
+	type testCase struct {
+		name  string
+		scale *big.Rat
+		ok    bool
+	}
+	tcs := []testCase{
+		{name: "m", scale: big.NewRat(1, 1), ok: true},
+		{name: "km", scale: big.NewRat(1000, 1), ok: true},
+		{name: "dam", scale: big.NewRat(10, 1), ok: true},
+		{name: "kg", scale: big.NewRat(1, 1), ok: true},
+		{name: "min", scale: big.NewRat(60, 1), ok: true},
+		{name: "MiB", scale: big.NewRat(8<<20, 1), ok: true},
+		{name: "kmin"},
+		{name: "Kim"},
+		{name: "k"},
+		{name: "x"},
+	}
+	for _, tc := range tcs {
+		def, ok := DefaultUnits.Lookup(tc.name)
+		if ok != tc.ok {
+			t.Fatalf("%s: expected found %v, got %v", tc.name, tc.ok, ok)
+		}
+		if ok && def.Scale.Cmp(tc.scale) != 0 {
+			t.Fatalf("%s: expected scale %v, got %v", tc.name, tc.scale, def.Scale)
+		}
+	}
+}
+
+func TestParseUnits(t *testing.T) {
+	type testCase struct {
+		in     string
+		pretty string
+	}
+	tcs := []testCase{
+		{in: "5km+300m", pretty: "5 km + 300 m"},
+		{in: "2 GiB in MB", pretty: "2 GiB to MB"},
+		{in: "100 km/h to m/s", pretty: "100 km / h to m / s"},
+		{in: "(90 min to h) * 2", pretty: "(90 min to h) * 2"},
+		{in: "x = 3 ft to m", pretty: "x = 3 ft to m"},
+		{in: "f(m) = m*s", pretty: "f(m) = m * s"},
+		{in: "1/2 km", pretty: "1 / 2 km"},
+		{in: "3 m^2", pretty: "3 * m ^ 2"},
+	}
+	for _, tc := range tcs {
+		tree, err := Parser{Units: DefaultUnits}.ParseString(tc.in)
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", tc.in, err)
+		}
+		if got := Pretty(tree); got != tc.pretty {
+			t.Fatalf("%s: expected %q, got %q", tc.in, tc.pretty, got)
+		}
+	}
+	// names of units cannot be assigned to, or they would read back as the
+	// unit, but parameters hide them
+	for _, in := range []string{"t = 5", "m = 5", "s = 2", "d = 1", "h = 3", "Σ(s, s, 1, 3)"} {
+		var perr *ParseError
+		if _, err := (Parser{Units: DefaultUnits}).ParseString(in); !errors.As(err, &perr) || perr.Kind != AssignToUnit {
+			t.Fatalf("%s: expected an assignment to unit error, got %v", in, err)
+		}
+	}
+	ev := Evaluator{Env: NewEnvironment(), Functions: DefaultFunctions.Clone(), Units: DefaultUnits}
+	for _, tc := range []struct{ in, out string }{
+		{in: "f(t) = t * 2", out: "f(t) = t * 2"},
+		{in: "f(5)", out: "10"},
+		{in: "f(1 t)", out: "2 t"},
+	} {
+		tree, err := Parser{Functions: ev.Functions, Units: DefaultUnits}.ParseString(tc.in)
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", tc.in, err)
+		}
+		v, err := ev.Eval(tree)
+		if err != nil || v.String() != tc.out {
+			t.Fatalf("%s: expected %v, got %v, %v", tc.in, tc.out, v, err)
+		}
+	}
+	// without units, the same names are variables
+	tree, err := ParseString("5 m")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if _, ok := tree.(BinaryOpNode).RHS.(VariableNode); !ok {
+		t.Fatalf("expected a variable, got %#v", tree)
+	}
+}
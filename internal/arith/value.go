@@ -0,0 +1,234 @@
+package arith
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Value is the result of evaluating a Node. The numeric implementations
+// are Int, Rat and Float; which of them an evaluation produces depends on
+// the Evaluator's Backend. Integrals produce an Estimate, complex results
+// a Complex, numbers with units a Quantity, dates a Date and list
+// literals a List.
+type Value interface {
+	String() string
+}
+
+// Int is an arbitrarily large integer.
+type Int struct{ *big.Int }
+
+// Rat is an exact fraction. Evaluation never produces a Rat with a
+// denominator of one; those are returned as Ints.
+type Rat struct{ *big.Rat }
+
+// Float is an arbitrary precision floating point number.
+type Float struct{ *big.Float }
+
+// Estimate is an approximate result, such as an integral computed by
+// quadrature, with an estimate of its absolute error. Computing with an
+// Estimate uses its Float and drops the Error.
+type Estimate struct {
+	Float
+	Error Float
+}
+
+// String writes e as its value and its error to two significant digits,
+// as in "0.333333333333333 ± 3.7e-15", leaving out an error too small to
+// change the digits written.
+func (e Estimate) String() string {
+	return Formatter{}.Format(e)
+}
+
+// Format makes %v and %s print like String instead of deferring to the
+// embedded Float.
+func (e Estimate) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v', 's':
+		fmt.Fprint(s, e.String())
+	default:
+		e.Float.Format(s, verb)
+	}
+}
+
+// plain returns the Float of an Estimate and any other Value unchanged.
+func plain(v Value) Value {
+	if e, ok := v.(Estimate); ok {
+		return e.Float
+	}
+	return v
+}
+
+// String writes r as a decimal if it has a finite decimal expansion and
+// as a fraction otherwise, so 7/2 is "3.5" while 1/3 stays "1/3".
+func (r Rat) String() string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	if places, ok := decimalPlaces(r.Rat); ok {
+		return r.FloatString(places)
+	}
+	return r.Rat.String()
+}
+
+// decimalPlaces returns the number of digits after the decimal point
+// needed to write r exactly, if r has a finite decimal expansion.
+func decimalPlaces(r *big.Rat) (int, bool) {
+	d := new(big.Int).Set(r.Denom())
+	two, five := big.NewInt(2), big.NewInt(5)
+	mod := new(big.Int)
+	digits := 0
+	for _, factor := range []*big.Int{two, five} {
+		count := 0
+		for {
+			q, m := new(big.Int).QuoRem(d, factor, mod)
+			if m.Sign() != 0 {
+				break
+			}
+			d = q
+			count++
+		}
+		if count > digits {
+			digits = count
+		}
+	}
+	return digits, d.IsInt64() && d.Int64() == 1
+}
+
+// String writes f with as many significant digits as its precision
+// supports.
+func (f Float) String() string {
+	return f.Text('g', decimalDigits(f.Prec()))
+}
+
+// Format makes %v and %s print like String instead of deferring to the
+// embedded *big.Float.
+func (f Float) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v', 's':
+		fmt.Fprint(s, f.String())
+	default:
+		f.Float.Format(s, verb)
+	}
+}
+
+// decimalDigits is the number of significant decimal digits a mantissa of
+// prec bits can faithfully represent.
+func decimalDigits(prec uint) int {
+	digits := int(float64(prec) * math.Log10(2))
+	if digits < 1 {
+		digits = 1
+	}
+	return digits
+}
+
+// numeric ranks order the numeric types so mixed operations promote to the
+// wider of their operands.
+const (
+	rankInt = iota
+	rankRat
+	rankFloat
+	rankComplex
+)
+
+func numericRank(v Value) int {
+	switch v.(type) {
+	case Int:
+		return rankInt
+	case Rat:
+		return rankRat
+	case Complex:
+		return rankComplex
+	default:
+		return rankFloat
+	}
+}
+
+// isReal reports whether every one of vals is a real number: an Int, a
+// Rat or a Float.
+func isReal(vals ...Value) bool {
+	for _, v := range vals {
+		switch v.(type) {
+		case Int, Rat, Float:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func toRat(v Value) *big.Rat {
+	switch v := v.(type) {
+	case Int:
+		return new(big.Rat).SetInt(v.Int)
+	case Rat:
+		return v.Rat
+	case Float:
+		r, _ := v.Rat(nil)
+		return r
+	}
+	return nil
+}
+
+func toFloat(v Value, prec uint) *big.Float {
+	f := new(big.Float).SetPrec(prec)
+	switch v := v.(type) {
+	case Int:
+		f.SetInt(v.Int)
+	case Rat:
+		f.SetRat(v.Rat)
+	case Float:
+		f.Set(v.Float)
+	}
+	return f
+}
+
+// ratValue returns r as an Int if it is whole and as a Rat otherwise.
+func ratValue(r *big.Rat) Value {
+	if r.IsInt() {
+		return Int{new(big.Int).Set(r.Num())}
+	}
+	return Rat{r}
+}
+
+// isZero reports whether v is numerically zero.
+func isZero(v Value) bool {
+	switch v := v.(type) {
+	case Int:
+		return v.Sign() == 0
+	case Rat:
+		return v.Sign() == 0
+	case Float:
+		return v.Sign() == 0
+	case Complex:
+		return v.Re.Sign() == 0 && v.Im.Sign() == 0
+	}
+	return false
+}
+
+// sign returns -1, 0 or 1 depending on the sign of v.
+func sign(v Value) int {
+	switch v := v.(type) {
+	case Int:
+		return v.Sign()
+	case Rat:
+		return v.Sign()
+	case Float:
+		return v.Sign()
+	}
+	return 0
+}
+
+// sqrtRat returns the exact square root of r if r is the square of a
+// rational number.
+func sqrtRat(r *big.Rat) (*big.Rat, bool) {
+	num := new(big.Int).Sqrt(r.Num())
+	if new(big.Int).Mul(num, num).Cmp(r.Num()) != 0 {
+		return nil, false
+	}
+	den := new(big.Int).Sqrt(r.Denom())
+	if new(big.Int).Mul(den, den).Cmp(r.Denom()) != 0 {
+		return nil, false
+	}
+	return new(big.Rat).SetFrac(num, den), true
+}
@@ -0,0 +1,89 @@
+package arith
+
+import (
+	"math/big"
+)
+
+// A WordSize makes integer results wrap around like machine integers of a
+// fixed width. The zero WordSize leaves integers unbounded.
+type WordSize struct {
+	// Bits is the width of a word, e.g. 8, 16, 32 or 64. Zero means
+	// unbounded.
+	Bits uint
+	// Signed words hold two's complement values from -2^(Bits-1) to
+	// 2^(Bits-1)-1; unsigned words hold values from 0 to 2^Bits-1.
+	Signed bool
+}
+
+// Wrap returns i reduced to w's range, keeping its low Bits bits.
+func (w WordSize) Wrap(i *big.Int) *big.Int {
+	if w.Bits == 0 {
+		return i
+	}
+	mod := new(big.Int).Lsh(big.NewInt(1), w.Bits)
+	res := new(big.Int).Mod(i, mod)
+	if w.Signed && res.Bit(int(w.Bits)-1) == 1 {
+		res.Sub(res, mod)
+	}
+	return res
+}
+
+func (w WordSize) wrap(v Value) Value {
+	if i, ok := v.(Int); ok && w.Bits != 0 {
+		return Int{w.Wrap(i.Int)}
+	}
+	return v
+}
+
+// toInt returns v as an integer, failing with ErrDomain if it has a
+// fractional part.
+func toInt(v Value) (*big.Int, error) {
+	if isComplex(v) {
+		return nil, ErrDomain
+	}
+	r := toRat(v)
+	if !r.IsInt() {
+		return nil, ErrDomain
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
+
+// bitwise applies a bitwise or shift operator to integer operands.
+func bitwise(op Op, lhs, rhs Value) (Value, error) {
+	l, err := toInt(lhs)
+	if err != nil {
+		return nil, err
+	}
+	r, err := toInt(rhs)
+	if err != nil {
+		return nil, err
+	}
+	res := new(big.Int)
+	switch op {
+	case OpAnd:
+		res.And(l, r)
+	case OpOr:
+		res.Or(l, r)
+	case OpXor:
+		res.Xor(l, r)
+	case OpShiftLeft, OpShiftRight:
+		if r.Sign() < 0 {
+			return nil, ErrDomain
+		}
+		if op == OpShiftRight {
+			if !r.IsInt64() || r.Int64() > int64(l.BitLen()) {
+				// everything is shifted out
+				return Int{res.Rsh(l, uint(l.BitLen()))}, nil
+			}
+			return Int{res.Rsh(l, uint(r.Int64()))}, nil
+		}
+		if !r.IsInt64() || r.Int64()+int64(l.BitLen()) > maxPowBits {
+			if l.Sign() == 0 {
+				return Int{res}, nil
+			}
+			return nil, ErrOverflow
+		}
+		res.Lsh(l, uint(r.Int64()))
+	}
+	return Int{res}, nil
+}
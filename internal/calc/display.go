@@ -0,0 +1,640 @@
+package calc
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/200sc/oakcalc/internal/arith"
+	"github.com/oakmound/oak/v3/entities/x/btn"
+	"github.com/oakmound/oak/v3/render"
+	"github.com/oakmound/oak/v3/scene"
+	"golang.org/x/image/colornames"
+)
+
+type arithmeticDisplay struct {
+	render.LayeredPoint
+	ctx     *scene.Context
+	fnt     *render.Font
+	current *render.Text
+
+	history          []render.Renderable
+	mu               sync.Mutex
+	currentOperation []arith.Token
+	// entry is the text of the number or identifier at the end of
+	// currentOperation while it is being typed, so "2." and "2.50" display
+	// as entered.
+	entry string
+	// errMarker underlines the token a failed parse complained about.
+	errMarker *render.Sprite
+
+	// ev evaluates with the session's variables and functions.
+	ev arith.Evaluator
+	// format writes expressions and results to the history and panel.
+	format arith.Formatter
+	// expressions are the sources of evaluated expressions, oldest first.
+	// recalled counts how far back Recall has gone.
+	expressions []string
+	recalled    int
+	// definitions are the functions defined this session, keyed by name
+	// and arity.
+	definitions map[string]arith.UserFunc
+	// panel is the text of the side panel, listing variables, statistics
+	// of the dataset or, in programmer mode, the last result in several
+	// bases.
+	panel []*render.Text
+
+	programmer bool
+	// statistics shows statistics of the dataset in the side panel
+	// instead of the session's variables.
+	statistics bool
+	// solving makes = solve the current operation as an equation. The
+	// first = typed in it separates the sides.
+	solving bool
+	// word is the word size used in programmer mode.
+	word arith.WordSize
+	// value is the last integer result in programmer mode.
+	value *big.Int
+	// bits toggle the bits of value; bitLabels are their texts.
+	bits      []btn.Btn
+	bitLabels [64]string
+}
+
+const (
+	historyX          = 400
+	historyY          = 400
+	historyLineHeight = 30
+)
+
+func (disp *arithmeticDisplay) AddToHistory(s string) {
+	disp.addToHistory(historyLineHeight, disp.fnt.NewText(s, historyX, historyY))
+}
+
+// addToHistory scrolls the history up by height and draws rs in the space
+// left at the bottom.
+func (disp *arithmeticDisplay) addToHistory(height float64, rs ...render.Renderable) {
+	for _, h := range disp.history {
+		h.ShiftY(-height)
+	}
+	for _, r := range rs {
+		disp.ctx.DrawStack.Draw(r, 1)
+		disp.history = append(disp.history, r)
+	}
+}
+
+func (disp *arithmeticDisplay) Add(t arith.Token) {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	// special cases
+	if t.Op != nil && *t.Op == arith.OpEquals {
+		if isDefinitionHead(disp.currentOperation, disp.ev.Functions) || (disp.solving && len(disp.currentOperation) != 0 && !hasEquals(disp.currentOperation)) {
+			// "x" then = starts an assignment to x, and "f ( x )" then =
+			// starts a definition of f. When solving, the first = after
+			// anything ends the left side of an equation.
+			disp.currentOperation = append(disp.currentOperation, t.Copy())
+			disp.entry = ""
+			disp.current.SetString(strings.Join(disp.tokenStrings(), " "))
+			return
+		}
+		if len(disp.currentOperation) == 0 {
+			disp.currentOperation = append(disp.currentOperation, arith.Token{
+				Number: big.NewRat(0, 1),
+			})
+		}
+		ps := disp.parser()
+		ps.Equations = disp.solving
+		tree, err := ps.Parse(disp.currentOperation)
+		var perr *arith.ParseError
+		if errors.As(err, &perr) {
+			// Leave the operation in place so it can be corrected.
+			disp.AddToHistory("Error: " + perr.Kind.String())
+			disp.markError(perr.Index)
+			return
+		}
+		if err == nil && disp.solving {
+			disp.solve(tree)
+		} else if err == nil {
+			disp.AddToHistory(disp.format.Pretty(tree))
+			disp.expressions = append(disp.expressions, arith.Pretty(tree))
+			disp.recalled = 0
+			result, err := disp.ev.Eval(tree)
+			var everr *arith.EvalError
+			f, defined := result.(arith.UserFunc)
+			switch {
+			case errors.As(err, &everr):
+				disp.AddToHistory("Error: " + everr.Err.Error())
+			case defined:
+				disp.definitions[f.Name+"/"+strconv.Itoa(len(f.Params))] = f
+			default:
+				disp.addResultToHistory(result)
+			}
+			if i, ok := result.(arith.Int); ok && disp.programmer {
+				disp.value = i.Int
+				disp.showProgrammer()
+			}
+			switch tree.(type) {
+			case arith.AssignNode, arith.FunctionDefNode:
+				disp.showPanel()
+			}
+		}
+		disp.currentOperation = []arith.Token{}
+		disp.entry = ""
+		disp.current.SetString("")
+		disp.clearError()
+		return
+	}
+	defer func() {
+		disp.current.SetString(strings.Join(disp.tokenStrings(), " "))
+		disp.clearError()
+	}()
+	if t.Op != nil && *t.Op == arith.OpBackspace {
+		if len(disp.entry) > 1 {
+			disp.setEntry(disp.entry[:len(disp.entry)-1])
+			return
+		}
+		if len(disp.currentOperation) != 0 {
+			disp.currentOperation = disp.currentOperation[:len(disp.currentOperation)-1]
+		}
+		disp.entry = ""
+		if len(disp.currentOperation) != 0 {
+			// resume editing a number or identifier we backed into
+			if last := disp.currentOperation[len(disp.currentOperation)-1]; last.Number != nil || last.Ident != nil {
+				disp.entry = last.String()
+			}
+		}
+		return
+	}
+	if t.Number != nil || t.Ident != nil || (t.Op != nil && *t.Op == arith.OpDecimalPoint) {
+		disp.appendToEntry(t)
+		return
+	}
+	disp.entry = ""
+	disp.currentOperation = append(disp.currentOperation, t.Copy())
+}
+
+// Insert appends complete tokens to the current operation, ending any
+// number or identifier being typed.
+func (disp *arithmeticDisplay) Insert(ts ...arith.Token) {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	for _, t := range ts {
+		disp.currentOperation = append(disp.currentOperation, t.Copy())
+	}
+	disp.entry = ""
+	disp.current.SetString(strings.Join(disp.tokenStrings(), " "))
+	disp.clearError()
+}
+
+// parser reads the names the evaluator knows: its functions, constants
+// and units.
+func (disp *arithmeticDisplay) parser() arith.Parser {
+	return arith.Parser{Functions: disp.ev.Functions, Constants: disp.ev.Constants, Units: disp.ev.Units}
+}
+
+// Derive writes the current expression and its derivative with respect to
+// variable to the history, leaving the expression in place. The
+// derivative can be recalled for editing like an evaluated expression.
+func (disp *arithmeticDisplay) Derive(variable string) {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	if len(disp.currentOperation) == 0 {
+		return
+	}
+	tree, err := disp.parser().Parse(disp.currentOperation)
+	var perr *arith.ParseError
+	if errors.As(err, &perr) {
+		disp.AddToHistory("Error: " + perr.Kind.String())
+		disp.markError(perr.Index)
+		return
+	}
+	if err != nil {
+		return
+	}
+	disp.AddToHistory("d/d" + variable + " " + disp.format.Pretty(tree))
+	d, err := arith.DeriveChecked(tree, variable)
+	var everr *arith.EvalError
+	if errors.As(err, &everr) {
+		disp.AddToHistory("Error: " + everr.Err.Error())
+		return
+	}
+	disp.AddToHistory(" = " + disp.format.Pretty(d))
+	disp.expressions = append(disp.expressions, arith.Pretty(d))
+	disp.recalled = 0
+}
+
+// Amortize writes the current expression, which must be a call
+// pmt(rate, periods, principal), and its payment to the history, and
+// lists the start and end of its amortization schedule in the side
+// panel. The expression is left in place.
+func (disp *arithmeticDisplay) Amortize() {
+	const maxLines = 6
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	if len(disp.currentOperation) == 0 || disp.programmer {
+		return
+	}
+	tree, err := disp.parser().Parse(disp.currentOperation)
+	var perr *arith.ParseError
+	if errors.As(err, &perr) {
+		disp.AddToHistory("Error: " + perr.Kind.String())
+		disp.markError(perr.Index)
+		return
+	}
+	if err != nil {
+		return
+	}
+	disp.AddToHistory(disp.format.Pretty(tree))
+	call, ok := tree.(arith.CallNode)
+	if !ok || call.Name != "pmt" || len(call.Args) != 3 {
+		disp.AddToHistory("Error: amortize pmt(rate, periods, principal)")
+		return
+	}
+	fail := func(err error) {
+		var everr *arith.EvalError
+		if errors.As(err, &everr) {
+			err = everr.Err
+		}
+		disp.AddToHistory("Error: " + err.Error())
+	}
+	// the arguments are evaluated once, for both the payment and the
+	// schedule
+	args := make([]arith.Value, len(call.Args))
+	for i, arg := range call.Args {
+		if args[i], err = disp.ev.Eval(arg); err != nil {
+			fail(err)
+			return
+		}
+	}
+	pmt, err := disp.ev.Functions.Lookup(call.Name, len(args))
+	if err != nil {
+		fail(err)
+		return
+	}
+	payment, err := pmt(disp.ev, args)
+	if err != nil {
+		fail(err)
+		return
+	}
+	schedule, err := disp.ev.Amortize(args[0], args[1], args[2])
+	if err != nil {
+		fail(err)
+		return
+	}
+	disp.AddToHistory(" = " + disp.format.Format(payment))
+	row := func(i int) string {
+		inst := schedule[i]
+		return strconv.Itoa(i+1) + "  " + disp.format.Format(inst.Interest) + "  " + disp.format.Format(inst.Principal) + "  " + disp.format.Format(inst.Balance)
+	}
+	lines := []string{"#  interest  principal  balance"}
+	for i := range schedule {
+		if i == maxLines-3 && len(schedule) > maxLines-1 {
+			// the first payments, then the last
+			lines = append(lines, "...", row(len(schedule)-1))
+			break
+		}
+		lines = append(lines, row(i))
+	}
+	disp.clearPanel()
+	disp.showLines(0, lines...)
+}
+
+// ToggleSolveMode switches = between evaluating and solving, returning
+// whether it now solves.
+func (disp *arithmeticDisplay) ToggleSolveMode() bool {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	disp.solving = !disp.solving
+	return disp.solving
+}
+
+// solve writes an equation and its roots to the history.
+func (disp *arithmeticDisplay) solve(tree arith.Node) {
+	eq := arith.AsEquation(tree)
+	disp.AddToHistory(disp.format.Pretty(eq))
+	disp.expressions = append(disp.expressions, arith.Pretty(eq))
+	disp.recalled = 0
+	unknown, ok := disp.unknown(eq)
+	if !ok {
+		disp.AddToHistory("Error: " + arith.ErrNoUnknown.Error())
+		return
+	}
+	roots, err := arith.Solver{Evaluator: disp.ev}.Solve(eq, unknown)
+	var everr *arith.EvalError
+	switch {
+	case errors.As(err, &everr):
+		disp.AddToHistory("Error: " + everr.Err.Error())
+	case len(roots) == 0:
+		disp.AddToHistory(" no real roots")
+	default:
+		strs := make([]string, len(roots))
+		for i, r := range roots {
+			strs[i] = disp.format.Format(r)
+		}
+		disp.AddToHistory(" " + unknown + " = " + strings.Join(strs, "; "))
+	}
+}
+
+// unknown picks the variable to solve an equation for: the only one
+// without a value, or failing that the only one, or failing that x.
+func (disp *arithmeticDisplay) unknown(eq arith.EquationNode) (string, bool) {
+	names := arith.Variables(eq)
+	var unbound []string
+	for _, name := range names {
+		if _, ok := disp.ev.Env.Get(name); !ok {
+			unbound = append(unbound, name)
+		}
+	}
+	switch {
+	case len(unbound) == 1:
+		return unbound[0], true
+	case len(names) == 1:
+		return names[0], true
+	}
+	for _, name := range names {
+		if name == "x" {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// AddHex appends hexadecimal digits to the number being typed, starting a
+// new "0x" number if a hexadecimal number is not being typed.
+func (disp *arithmeticDisplay) AddHex(digits string) {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	if !strings.HasPrefix(strings.ToLower(disp.entry), "0x") {
+		disp.currentOperation = append(disp.currentOperation, arith.Token{Number: new(big.Rat)})
+		disp.entry = "0x"
+	}
+	disp.setEntry(disp.entry + digits)
+	disp.current.SetString(strings.Join(disp.tokenStrings(), " "))
+	disp.clearError()
+}
+
+// Recall replaces the current operation with an earlier expression for
+// editing. Each call goes one expression further back.
+func (disp *arithmeticDisplay) Recall() {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	if disp.recalled == len(disp.expressions) {
+		return
+	}
+	disp.recalled++
+	lexemes, err := arith.Lex(disp.expressions[len(disp.expressions)-disp.recalled])
+	if err != nil {
+		return
+	}
+	disp.currentOperation, _ = arith.Tokens(lexemes)
+	disp.entry = ""
+	// keep typing the last number or identifier as it was written
+	if last := lexemes[len(lexemes)-1]; last.Number != nil || last.Ident != nil {
+		disp.entry = last.Text
+	}
+	disp.current.SetString(strings.Join(disp.tokenStrings(), " "))
+	disp.clearError()
+}
+
+// UpdateFormat changes how expressions and results are written. Results
+// already in the history are not rewritten.
+func (disp *arithmeticDisplay) UpdateFormat(update func(f *arith.Formatter)) {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	update(&disp.format)
+	disp.showPanel()
+}
+
+// ToggleAngleMode switches trigonometric functions between radians and
+// degrees, returning the new mode.
+func (disp *arithmeticDisplay) ToggleAngleMode() arith.AngleMode {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	if disp.ev.Angle == arith.Degrees {
+		disp.ev.Angle = arith.Radians
+	} else {
+		disp.ev.Angle = arith.Degrees
+	}
+	disp.format.PolarAngle = disp.ev.Angle
+	disp.showPanel()
+	return disp.ev.Angle
+}
+
+// ToggleComplexMode switches between real and complex results, returning
+// whether results may now be complex. In complex mode i is the imaginary
+// unit rather than a variable.
+func (disp *arithmeticDisplay) ToggleComplexMode() bool {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	disp.ev.Complex = !disp.ev.Complex
+	disp.ev.Constants = nil
+	if disp.ev.Complex {
+		disp.ev.Constants = arith.ComplexConstants
+	}
+	return disp.ev.Complex
+}
+
+// SetLocation changes the time zone dates are read and written in. Dates
+// already in the history are not rewritten.
+func (disp *arithmeticDisplay) SetLocation(loc *time.Location) {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	disp.ev.Location = loc
+	disp.format.Location = loc
+	disp.showPanel()
+}
+
+// appendToEntry extends the number or identifier being typed with a
+// digit, letter or decimal point, starting a new token if the character
+// cannot continue the current one.
+func (disp *arithmeticDisplay) appendToEntry(t arith.Token) {
+	ch := t.String()
+	var last arith.Token
+	if len(disp.currentOperation) != 0 {
+		last = disp.currentOperation[len(disp.currentOperation)-1]
+	}
+	switch {
+	case disp.entry != "" && last.Number != nil && t.Ident != nil && continuesNumber(disp.entry, ch):
+		// a base prefix or hexadecimal digit
+	case disp.entry != "" && last.Ident != nil && t.Op == nil:
+		// letters and digits continue an identifier
+	case disp.entry != "" && last.Number != nil && t.Ident == nil:
+		// digits and decimal points continue a number
+	case t.Ident != nil:
+		disp.currentOperation = append(disp.currentOperation, arith.Token{Ident: new(string)})
+		disp.entry = ""
+	default:
+		disp.currentOperation = append(disp.currentOperation, arith.Token{Number: new(big.Rat)})
+		disp.entry = ""
+	}
+	if ch == string(arith.OpDecimalPoint) && strings.Contains(disp.entry, ch) {
+		return
+	}
+	disp.setEntry(disp.entry + ch)
+}
+
+// continuesNumber reports whether the letter ch extends the number entry,
+// as x does "0" and f does "0x1".
+func continuesNumber(entry, ch string) bool {
+	lower := strings.ToLower(entry)
+	switch {
+	case lower == "0":
+		return ch == "x" || ch == "o" || ch == "b"
+	case strings.HasPrefix(lower, "0x"):
+		return len(ch) == 1 && strings.Contains("abcdefABCDEF", ch)
+	}
+	return false
+}
+
+// setEntry replaces the text of the token being typed and updates the
+// token to match.
+func (disp *arithmeticDisplay) setEntry(entry string) {
+	disp.entry = entry
+	last := &disp.currentOperation[len(disp.currentOperation)-1]
+	if last.Ident != nil {
+		last.Ident = &entry
+		return
+	}
+	num, err := arith.ParseNumber(entry)
+	if err != nil {
+		// a lone decimal point
+		num = new(big.Rat)
+	}
+	last.Number = num
+}
+
+// isDefinitionHead reports whether ts is a name, or a name that is not a
+// built-in function and a parenthesized list of distinct names, that =
+// would begin an assignment or a function definition for.
+func isDefinitionHead(ts []arith.Token, functions *arith.FunctionRegistry) bool {
+	if len(ts) == 0 || ts[0].Ident == nil {
+		return false
+	}
+	if len(ts) == 1 {
+		return true
+	}
+	if len(ts) < 3 || !isOp(ts[1], arith.OpOpenParen) || !isOp(ts[len(ts)-1], arith.OpCloseParen) || functions.IsBuiltin(*ts[0].Ident) {
+		return false
+	}
+	params := ts[2 : len(ts)-1]
+	seen := map[string]bool{}
+	for i, t := range params {
+		if i%2 == 1 {
+			if !isOp(t, arith.OpComma) {
+				return false
+			}
+			continue
+		}
+		if t.Ident == nil || seen[*t.Ident] {
+			return false
+		}
+		seen[*t.Ident] = true
+	}
+	return len(params) == 0 || len(params)%2 == 1
+}
+
+// hasEquals reports whether ts contains =.
+func hasEquals(ts []arith.Token) bool {
+	for _, t := range ts {
+		if isOp(t, arith.OpEquals) {
+			return true
+		}
+	}
+	return false
+}
+
+func isOp(t arith.Token, o arith.Op) bool {
+	return t.Op != nil && *t.Op == o
+}
+
+const (
+	panelX          = 20
+	panelY          = 40
+	panelLineHeight = 16
+)
+
+// clearPanel removes everything from the side panel.
+func (disp *arithmeticDisplay) clearPanel() {
+	for _, txt := range disp.panel {
+		txt.Undraw()
+	}
+	disp.panel = disp.panel[:0]
+	for _, b := range disp.bits {
+		b.Destroy()
+	}
+	disp.bits = nil
+}
+
+// showLines writes lines to the side panel, starting at line i.
+func (disp *arithmeticDisplay) showLines(i int, lines ...string) {
+	for j, line := range lines {
+		txt := disp.fnt.NewText(line, panelX, float64(panelY+(i+j)*panelLineHeight))
+		disp.ctx.DrawStack.Draw(txt, 1)
+		disp.panel = append(disp.panel, txt)
+	}
+}
+
+// showVariables lists the session's variables and functions in the side
+// panel.
+func (disp *arithmeticDisplay) showVariables() {
+	const maxLines = 6
+	disp.clearPanel()
+	lines := []string{"Variables"}
+	for _, name := range disp.ev.Env.Names() {
+		v, _ := disp.ev.Env.Get(name)
+		lines = append(lines, name+" = "+disp.format.Format(v))
+	}
+	keys := make([]string, 0, len(disp.definitions))
+	for key := range disp.definitions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		lines = append(lines, disp.definitions[key].String())
+	}
+	if len(lines) > maxLines {
+		lines = append(lines[:maxLines-1], "...")
+	}
+	disp.showLines(0, lines...)
+}
+
+func (disp *arithmeticDisplay) tokenStrings() []string {
+	strs := make([]string, len(disp.currentOperation))
+	for i, t := range disp.currentOperation {
+		strs[i] = t.String()
+	}
+	if disp.entry != "" {
+		strs[len(strs)-1] = disp.entry
+	}
+	return strs
+}
+
+// markError underlines the token at index i of the current operation, or
+// the end of the operation if i is past its last token.
+func (disp *arithmeticDisplay) markError(i int) {
+	disp.clearError()
+	strs := disp.tokenStrings()
+	prefix := strings.Join(strs[:i], " ")
+	if i > 0 {
+		prefix += " "
+	}
+	width := disp.fnt.MeasureString(" ").Round()
+	if i < len(strs) {
+		width = disp.fnt.MeasureString(strs[i]).Round()
+	}
+	x := disp.current.X() + float64(disp.fnt.MeasureString(prefix).Round())
+	y := disp.current.Y() + disp.fnt.Height() + 2
+	disp.errMarker = render.NewColorBox(width, 2, colornames.Red)
+	disp.errMarker.SetPos(x, y)
+	disp.ctx.DrawStack.Draw(disp.errMarker, 9)
+}
+
+func (disp *arithmeticDisplay) clearError() {
+	if disp.errMarker != nil {
+		disp.errMarker.Undraw()
+		disp.errMarker = nil
+	}
+}
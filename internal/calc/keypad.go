@@ -0,0 +1,956 @@
+package calc
+
+import (
+	"math/big"
+	"strconv"
+	"time"
+	"unicode"
+
+	"github.com/200sc/oakcalc/internal/arith"
+	"github.com/oakmound/oak/v3/entities/x/btn"
+	"github.com/oakmound/oak/v3/entities/x/mods"
+	"github.com/oakmound/oak/v3/event"
+	"github.com/oakmound/oak/v3/key"
+	"github.com/oakmound/oak/v3/mouse"
+	"github.com/oakmound/oak/v3/render"
+	"github.com/oakmound/oak/v3/scene"
+	"golang.org/x/image/colornames"
+	mkey "golang.org/x/mobile/event/key"
+)
+
+type tokenWithShortcut struct {
+	arith.Token
+	shortcutRune rune
+	shortcutKey  mkey.Code // for keys without runes
+	// label, if set, is shown on the button instead of the token.
+	label *string
+	// press, if set, is called instead of adding the token to the display.
+	press func(disp *arithmeticDisplay)
+}
+
+func (t *tokenWithShortcut) text() string {
+	if t.label != nil {
+		return *t.label
+	}
+	return t.String()
+}
+
+// A keypadPage is one layout of keypad buttons. Only the active page's
+// buttons are shown, but every page's shortcuts work from any page.
+type keypadPage struct {
+	name string
+	rows [][]tokenWithShortcut
+	// programmer pages switch the display to programmer mode.
+	programmer bool
+	// statistics pages show statistics of the dataset in the side panel.
+	statistics bool
+}
+
+type keypad struct {
+	ctx   *scene.Context
+	disp  *arithmeticDisplay
+	pages []keypadPage
+	// shown maps the keys of the active page to their buttons.
+	shown map[*tokenWithShortcut]btn.Btn
+
+	fnt      *render.Font
+	smallFnt *render.Font
+}
+
+const (
+	keyWidth    = 50
+	keyHeight   = 50
+	keyXSpacing = 10
+	keyYSpacing = 10
+	keyXStart   = 20
+	keyYStart   = 170
+	tabY        = 140
+	tabXSpacing = 4
+	tabHeight   = 24
+)
+
+var (
+	btnColor       = colornames.Darkolivegreen
+	highlightColor = mods.Lighter(btnColor, .10)
+	pressColor     = mods.Lighter(btnColor, .20)
+)
+
+func newKeypad(ctx *scene.Context, disp *arithmeticDisplay, pages ...keypadPage) *keypad {
+	kp := &keypad{
+		ctx:   ctx,
+		disp:  disp,
+		pages: pages,
+	}
+	kp.fnt, _ = render.DefaultFont().RegenerateWith(func(fg render.FontGenerator) render.FontGenerator {
+		fg.Size = 25
+		return fg
+	})
+	kp.fnt.Fallbacks = loadFallbackFonts(25)
+	kp.smallFnt, _ = render.DefaultFont().RegenerateWith(func(fg render.FontGenerator) render.FontGenerator {
+		fg.Size = 14
+		return fg
+	})
+	kp.smallFnt.Fallbacks = loadFallbackFonts(14)
+
+	// the tabs share the width of the six columns of keys
+	tabWidth := (6*keyWidth + 5*keyXSpacing - (len(pages)-1)*tabXSpacing) / len(pages)
+	for i, page := range pages {
+		i := i
+		kp.newButton(page.name, kp.smallFnt, float64(keyXStart+i*(tabWidth+tabXSpacing)), tabY, tabWidth, tabHeight, func() {
+			kp.show(i)
+		})
+	}
+
+	// Letters not claimed by a keypad shortcut type identifiers, and the
+	// up arrow recalls earlier expressions.
+	ctx.EventHandler.GlobalBind(key.Down, func(c event.CID, i interface{}) int {
+		kv, ok := i.(key.Event)
+		if !ok {
+			return 0
+		}
+		if k := kp.shortcut(kv); k != nil {
+			kp.press(k)
+			return 0
+		}
+		if kv.Code == mkey.CodeUpArrow {
+			disp.Recall()
+			return 0
+		}
+		if unicode.IsLetter(kv.Rune) {
+			// read the letter as the lexer would, so "π" is the constant
+			// pi and "Π" a product
+			if lexemes, err := arith.Lex(string(kv.Rune)); err == nil && len(lexemes) == 1 {
+				disp.Add(lexemes[0].Token)
+			}
+		}
+		return 0
+	})
+	kp.show(0)
+	return kp
+}
+
+// shortcut finds the key, on any page, that kv is a shortcut for.
+func (kp *keypad) shortcut(kv key.Event) *tokenWithShortcut {
+	for _, page := range kp.pages {
+		for _, row := range page.rows {
+			for i := range row {
+				k := &row[i]
+				if k.shortcutRune != 0 && kv.Rune == k.shortcutRune {
+					return k
+				} else if k.shortcutKey != 0 && kv.Code == k.shortcutKey {
+					return k
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// press acts on a key as if its button was clicked, flashing the button if
+// it is on the active page.
+func (kp *keypad) press(k *tokenWithShortcut) {
+	if b, ok := kp.shown[k]; ok {
+		if sw, ok := b.GetRenderable().(*render.Switch); ok {
+			sw.Set("onpress")
+			kp.ctx.DoAfter(50*time.Millisecond, func() {
+				sw.Set("nohover")
+			})
+		}
+	}
+	if k.press != nil {
+		k.press(kp.disp)
+		return
+	}
+	kp.disp.Add(k.Token)
+}
+
+// show replaces the buttons on screen with those of the page at index i.
+func (kp *keypad) show(i int) {
+	for _, b := range kp.shown {
+		b.Destroy()
+	}
+	kp.shown = make(map[*tokenWithShortcut]btn.Btn)
+	kp.disp.SetProgrammerMode(kp.pages[i].programmer)
+	kp.disp.SetStatisticsMode(kp.pages[i].statistics)
+	y := float64(keyYStart)
+	for _, row := range kp.pages[i].rows {
+		x := float64(keyXStart)
+		for j := range row {
+			k := &row[j]
+			fnt := kp.fnt
+			if len([]rune(k.text())) > 2 {
+				fnt = kp.smallFnt
+			}
+			kp.shown[k] = kp.newButton(k.text(), fnt, x, y, keyWidth, keyHeight, func() {
+				kp.press(k)
+			}, k.label)
+			x += keyWidth + keyXSpacing
+		}
+		y += keyHeight + keyYSpacing
+	}
+}
+
+// newButton creates a button that calls onClick when clicked. If label is
+// given the button's text follows it as it changes.
+func (kp *keypad) newButton(text string, fnt *render.Font, x, y float64, w, h int, onClick func(), label ...*string) btn.Btn {
+	r := render.NewSwitch("nohover", map[string]render.Modifiable{
+		"nohover": render.NewColorBox(w, h, btnColor),
+		"hover":   render.NewColorBox(w, h, highlightColor),
+		"onpress": render.NewColorBox(w, h, pressColor),
+	})
+	txtOpt := btn.Text(text)
+	if len(label) != 0 && label[0] != nil {
+		txtOpt = btn.TextPtr(label[0])
+	}
+	txtX, txtY := 12.0, 8.0
+	if fnt == kp.smallFnt {
+		txtX, txtY = 5, float64(h)/2-8
+	}
+	ctx := kp.ctx
+	return btn.New(
+		txtOpt,
+		btn.TxtOff(txtX, txtY),
+		btn.Font(fnt),
+		btn.Pos(x, y),
+		btn.Width(float64(w)),
+		btn.Height(float64(h)),
+		btn.Renderable(r),
+		btn.Layers(1),
+		btn.Click(mouse.Binding(func(c event.CID, e *mouse.Event) int {
+			onClick()
+			return 0
+		})),
+		btn.Binding(mouse.Start, mouse.Binding(func(c event.CID, e *mouse.Event) int {
+			b, _ := ctx.CallerMap.GetEntity(c).(btn.Btn)
+			if sw, ok := b.GetRenderable().(*render.Switch); ok {
+				sw.Set("hover")
+			}
+			return 0
+		})),
+		btn.Binding(mouse.Stop, mouse.Binding(func(c event.CID, e *mouse.Event) int {
+			b, _ := ctx.CallerMap.GetEntity(c).(btn.Btn)
+			if sw, ok := b.GetRenderable().(*render.Switch); ok {
+				sw.Set("nohover")
+			}
+			return 0
+		})),
+		btn.Binding(mouse.PressOn, mouse.Binding(func(c event.CID, e *mouse.Event) int {
+			b, _ := ctx.CallerMap.GetEntity(c).(btn.Btn)
+			if sw, ok := b.GetRenderable().(*render.Switch); ok {
+				sw.Set("onpress")
+			}
+			return 0
+		})),
+	)
+}
+
+func basicPage() keypadPage {
+	return keypadPage{
+		name: "basic",
+		rows: [][]tokenWithShortcut{
+			{
+				{
+					Token:        arith.Token{Number: big.NewRat(7, 1)},
+					shortcutRune: '7',
+				},
+				{
+					Token:        arith.Token{Number: big.NewRat(8, 1)},
+					shortcutRune: '8',
+				},
+				{
+					Token:        arith.Token{Number: big.NewRat(9, 1)},
+					shortcutRune: '9',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpDivide)},
+					shortcutRune: '/',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpOpenParen)},
+					shortcutRune: '(',
+				},
+				deriveKey("x"),
+			}, {
+				{
+					Token:        arith.Token{Number: big.NewRat(4, 1)},
+					shortcutRune: '4',
+				},
+				{
+					Token:        arith.Token{Number: big.NewRat(5, 1)},
+					shortcutRune: '5',
+				},
+				{
+					Token:        arith.Token{Number: big.NewRat(6, 1)},
+					shortcutRune: '6',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpMultiply)},
+					shortcutRune: '*',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpCloseParen)},
+					shortcutRune: ')',
+				},
+				solveKey(),
+			}, {
+				{
+					Token:        arith.Token{Number: big.NewRat(1, 1)},
+					shortcutRune: '1',
+				},
+				{
+					Token:        arith.Token{Number: big.NewRat(2, 1)},
+					shortcutRune: '2',
+				},
+				{
+					Token:        arith.Token{Number: big.NewRat(3, 1)},
+					shortcutRune: '3',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpMinus)},
+					shortcutRune: '-',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpSquareRoot)},
+					shortcutRune: 'q',
+				},
+				rangeKey(arith.OpIntegral),
+			}, {
+				{
+					Token:       arith.Token{Op: opP(arith.OpBackspace)},
+					shortcutKey: mkey.CodeDeleteBackspace,
+				},
+				{
+					Token:        arith.Token{Number: big.NewRat(0, 1)},
+					shortcutRune: '0',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpDecimalPoint)},
+					shortcutRune: '.',
+				},
+				{
+					Token:       arith.Token{Op: opP(arith.OpEquals)},
+					shortcutKey: mkey.CodeReturnEnter,
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpPlus)},
+					shortcutRune: '+',
+				},
+				rangeKey(arith.OpSum),
+			}, {
+				{
+					Token:        arith.Token{Op: opP(arith.OpPower)},
+					shortcutRune: '^',
+				},
+				{
+					// % is a remainder between operands and a percentage
+					// after one
+					Token:        arith.Token{Op: opP(arith.OpModulo)},
+					shortcutRune: '%',
+				},
+				{
+					// / is already division, so floor division is on the
+					// other slash.
+					Token:        arith.Token{Op: opP(arith.OpFloorDivide)},
+					shortcutRune: '\\',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpFactorial)},
+					shortcutRune: '!',
+				},
+				constantKey("pi", "π"),
+				constantKey("e", "e"),
+			},
+		},
+	}
+}
+
+// solveKey switches = between evaluating and solving equations.
+func solveKey() tokenWithShortcut {
+	label := "eval"
+	return tokenWithShortcut{
+		label: &label,
+		press: func(disp *arithmeticDisplay) {
+			if disp.ToggleSolveMode() {
+				label = "solve"
+			} else {
+				label = "eval"
+			}
+		},
+	}
+}
+
+// deriveKey shows the derivative of the current expression with respect
+// to variable.
+func deriveKey(variable string) tokenWithShortcut {
+	label := "d/d" + variable
+	return tokenWithShortcut{
+		label: &label,
+		press: func(disp *arithmeticDisplay) {
+			disp.Derive(variable)
+		},
+	}
+}
+
+// constantKey inserts the named constant, labelled with its symbol. Typing
+// the name works too, so constants have no shortcut.
+func constantKey(name, symbol string) tokenWithShortcut {
+	return tokenWithShortcut{
+		label: &symbol,
+		press: func(disp *arithmeticDisplay) {
+			disp.Insert(arith.Token{Ident: &name})
+		},
+	}
+}
+
+// functionKey inserts a call to the named function, leaving its argument
+// list open.
+func functionKey(name string) tokenWithShortcut {
+	return tokenWithShortcut{
+		label: &name,
+		press: func(disp *arithmeticDisplay) {
+			disp.Insert(arith.Token{Ident: &name}, arith.Token{Op: opP(arith.OpOpenParen)})
+		},
+	}
+}
+
+// rangeKey inserts a range operator, leaving its argument list open for
+// the body, variable and bounds. Typing the operator's symbol presses it,
+// rather than starting an identifier.
+func rangeKey(op arith.Op) tokenWithShortcut {
+	return tokenWithShortcut{
+		Token:        arith.Token{Op: opP(op)},
+		shortcutRune: []rune(string(op))[0],
+		press: func(disp *arithmeticDisplay) {
+			disp.Insert(arith.Token{Op: opP(op)}, arith.Token{Op: opP(arith.OpOpenParen)})
+		},
+	}
+}
+
+func scientificPage() keypadPage {
+	angleLabel := "rad"
+	page := keypadPage{
+		name: "sci",
+		rows: [][]tokenWithShortcut{
+			{
+				functionKey("sin"),
+				functionKey("cos"),
+				functionKey("tan"),
+				{
+					Token:        arith.Token{Op: opP(arith.OpComma)},
+					shortcutRune: ',',
+				},
+				{
+					Token: arith.Token{Op: opP(arith.OpCloseParen)},
+				},
+			}, {
+				functionKey("asin"),
+				functionKey("acos"),
+				functionKey("atan"),
+				functionKey("pow"),
+				{
+					label: &angleLabel,
+					press: func(disp *arithmeticDisplay) {
+						if disp.ToggleAngleMode() == arith.Degrees {
+							angleLabel = "deg"
+						} else {
+							angleLabel = "rad"
+						}
+					},
+				},
+			}, {
+				functionKey("sinh"),
+				functionKey("cosh"),
+				functionKey("tanh"),
+				functionKey("ln"),
+				functionKey("log"),
+			}, {
+				functionKey("asinh"),
+				functionKey("acosh"),
+				functionKey("atanh"),
+				functionKey("exp"),
+				functionKey("abs"),
+			}, {
+				functionKey("floor"),
+				functionKey("ceil"),
+				functionKey("round"),
+				functionKey("min"),
+				functionKey("max"),
+			},
+		},
+	}
+	// the last column configures how results are written
+	formatKeys := []tokenWithShortcut{
+		formatKey(4, func(f *arith.Formatter, i int) string {
+			f.Notation = []arith.Notation{
+				arith.NotationAuto,
+				arith.NotationFixed,
+				arith.NotationScientific,
+				arith.NotationEngineering,
+			}[i]
+			return []string{"auto", "fix", "sci", "eng"}[i]
+		}),
+		formatKey(5, func(f *arith.Formatter, i int) string {
+			n := []int{0, 2, 4, 8, 12}[i]
+			f.SignificantDigits = n
+			f.DecimalPlaces = n
+			if n == 0 {
+				return "all dig"
+			}
+			return strconv.Itoa(n) + " dig"
+		}),
+		formatKey(2, func(f *arith.Formatter, i int) string {
+			if i == 0 {
+				f.ThousandsSeparator = ""
+				return "1000"
+			}
+			f.ThousandsSeparator = ","
+			if f.DecimalSeparator == "," {
+				f.ThousandsSeparator = "."
+			}
+			return "1,000"
+		}),
+		formatKey(2, func(f *arith.Formatter, i int) string {
+			if i == 0 {
+				f.DecimalSeparator = ""
+				if f.ThousandsSeparator != "" {
+					f.ThousandsSeparator = ","
+				}
+				return "1.5"
+			}
+			f.DecimalSeparator = ","
+			if f.ThousandsSeparator != "" {
+				f.ThousandsSeparator = "."
+			}
+			return "1,5"
+		}),
+		formatKey(4, func(f *arith.Formatter, i int) string {
+			f.Radix = []int{10, 16, 8, 2}[i]
+			return []string{"dec", "hex", "oct", "bin"}[i]
+		}),
+	}
+	for i := range page.rows {
+		page.rows[i] = append(page.rows[i], formatKeys[i])
+	}
+	return page
+}
+
+// formatKey cycles through n choices of a formatting setting. set applies
+// choice i to a Formatter and returns the key's label for it.
+func formatKey(n int, set func(f *arith.Formatter, i int) string) tokenWithShortcut {
+	choice := 0
+	label := set(&arith.Formatter{}, choice)
+	return tokenWithShortcut{
+		label: &label,
+		press: func(disp *arithmeticDisplay) {
+			choice = (choice + 1) % n
+			disp.UpdateFormat(func(f *arith.Formatter) {
+				label = set(f, choice)
+			})
+		},
+	}
+}
+
+func digitKey(n int64) tokenWithShortcut {
+	return tokenWithShortcut{
+		Token: arith.Token{Number: big.NewRat(n, 1)},
+	}
+}
+
+// hexKey continues a hexadecimal number with digits, starting one if a
+// hexadecimal number is not being typed.
+func hexKey(digits string) tokenWithShortcut {
+	label := "0x" + digits
+	if digits != "" {
+		label = digits
+	}
+	return tokenWithShortcut{
+		label: &label,
+		press: func(disp *arithmeticDisplay) {
+			disp.AddHex(digits)
+		},
+	}
+}
+
+func complexPage() keypadPage {
+	modeLabel := "real"
+	return keypadPage{
+		name: "cplx",
+		rows: [][]tokenWithShortcut{
+			{
+				constantKey("i", "i"),
+				functionKey("re"),
+				functionKey("im"),
+				functionKey("conj"),
+				functionKey("arg"),
+				functionKey("abs"),
+			}, {
+				{
+					label: &modeLabel,
+					press: func(disp *arithmeticDisplay) {
+						if disp.ToggleComplexMode() {
+							modeLabel = "cplx"
+						} else {
+							modeLabel = "real"
+						}
+					},
+				},
+				formatKey(2, func(f *arith.Formatter, i int) string {
+					f.Polar = i == 1
+					return []string{"rect", "polar"}[i]
+				}),
+			},
+		},
+	}
+}
+
+// unitKey inserts the named unit. Like constants, units can be typed, so
+// they have no shortcut.
+func unitKey(name string) tokenWithShortcut {
+	return tokenWithShortcut{
+		label: &name,
+		press: func(disp *arithmeticDisplay) {
+			disp.Insert(arith.Token{Ident: &name})
+		},
+	}
+}
+
+func unitsPage() keypadPage {
+	return keypadPage{
+		name: "units",
+		rows: [][]tokenWithShortcut{
+			{
+				unitKey("m"),
+				unitKey("km"),
+				unitKey("cm"),
+				unitKey("mi"),
+				unitKey("ft"),
+				unitKey("inch"),
+			}, {
+				unitKey("g"),
+				unitKey("kg"),
+				unitKey("lb"),
+				unitKey("L"),
+				unitKey("J"),
+				unitKey("W"),
+			}, {
+				unitKey("s"),
+				unitKey("min"),
+				unitKey("h"),
+				unitKey("d"),
+				unitKey("Hz"),
+				unitKey("K"),
+			}, {
+				unitKey("B"),
+				unitKey("kB"),
+				unitKey("MB"),
+				unitKey("GB"),
+				unitKey("KiB"),
+				unitKey("GiB"),
+			}, {
+				// the conversion keyword, as in "90 min to h"
+				unitKey("to"),
+				{Token: arith.Token{Op: opP(arith.OpDivide)}},
+				{Token: arith.Token{Op: opP(arith.OpPower)}},
+			},
+		},
+	}
+}
+
+func datePage() keypadPage {
+	return keypadPage{
+		name: "date",
+		rows: [][]tokenWithShortcut{
+			{
+				functionKey("date"),
+				functionKey("now"),
+				functionKey("workdays"),
+				functionKey("workday"),
+				{
+					Token:        arith.Token{Op: opP(arith.OpComma)},
+					shortcutRune: ',',
+				},
+				{
+					Token: arith.Token{Op: opP(arith.OpCloseParen)},
+				},
+			}, {
+				unitKey("wk"),
+				unitKey("d"),
+				unitKey("h"),
+				unitKey("min"),
+				unitKey("s"),
+				unitKey("to"),
+			}, {
+				zoneKey(),
+			},
+		},
+	}
+}
+
+// zones are the time zones zoneKey cycles through, with their labels.
+var zones = []struct {
+	label string
+	name  string
+}{
+	{"UTC", "UTC"},
+	{"local", "Local"},
+	{"NY", "America/New_York"},
+	{"LDN", "Europe/London"},
+	{"TYO", "Asia/Tokyo"},
+}
+
+// zoneKey cycles the time zone dates are read and written in.
+func zoneKey() tokenWithShortcut {
+	choice := 0
+	label := zones[choice].label
+	return tokenWithShortcut{
+		label: &label,
+		press: func(disp *arithmeticDisplay) {
+			choice = (choice + 1) % len(zones)
+			loc, err := time.LoadLocation(zones[choice].name)
+			if err != nil {
+				// fall back to UTC rather than leave the label wrong
+				loc, choice = time.UTC, 0
+			}
+			label = zones[choice].label
+			disp.SetLocation(loc)
+		},
+	}
+}
+
+// commonCurrencies are the currencies the finance page has keys for,
+// when the exchange rates include them.
+var commonCurrencies = []string{"USD", "EUR", "GBP", "JPY", "CNY"}
+
+func financePage(units *arith.UnitRegistry) keypadPage {
+	currencies := []tokenWithShortcut{}
+	for _, code := range commonCurrencies {
+		if _, ok := units.Lookup(code); ok {
+			currencies = append(currencies, unitKey(code))
+		}
+	}
+	currencies = append(currencies, unitKey("to"))
+	schedLabel := "sched"
+	return keypadPage{
+		name: "fin",
+		rows: [][]tokenWithShortcut{
+			{
+				functionKey("pmt"),
+				functionKey("pv"),
+				functionKey("fv"),
+				functionKey("npv"),
+				functionKey("irr"),
+				{
+					Token:        arith.Token{Op: opP(arith.OpComma)},
+					shortcutRune: ',',
+				},
+			}, {
+				functionKey("ipmt"),
+				functionKey("ppmt"),
+				functionKey("compound"),
+				{
+					// shows the schedule of the pmt call being typed
+					label: &schedLabel,
+					press: func(disp *arithmeticDisplay) {
+						disp.Amortize()
+					},
+				},
+				{Token: arith.Token{Op: opP(arith.OpModulo)}},
+				{
+					Token: arith.Token{Op: opP(arith.OpCloseParen)},
+				},
+			},
+			currencies,
+		},
+	}
+}
+
+func statisticsPage() keypadPage {
+	pushLabel, popLabel, clearLabel := "push", "pop", "clr"
+	data := dataName
+	return keypadPage{
+		name:       "stat",
+		statistics: true,
+		rows: [][]tokenWithShortcut{
+			{
+				{
+					Token:        arith.Token{Op: opP(arith.OpOpenBracket)},
+					shortcutRune: '[',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpCloseBracket)},
+					shortcutRune: ']',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpComma)},
+					shortcutRune: ',',
+				},
+				{
+					// adds the current expression to the dataset
+					label: &pushLabel,
+					press: func(disp *arithmeticDisplay) {
+						disp.PushData()
+					},
+				},
+				{
+					label: &popLabel,
+					press: func(disp *arithmeticDisplay) {
+						disp.PopData()
+					},
+				},
+				{
+					label: &clearLabel,
+					press: func(disp *arithmeticDisplay) {
+						disp.ClearData()
+					},
+				},
+			}, {
+				functionKey("mean"),
+				functionKey("median"),
+				functionKey("mode"),
+				functionKey("stddev"),
+				functionKey("variance"),
+				functionKey("percentile"),
+			}, {
+				functionKey("sum"),
+				functionKey("count"),
+				functionKey("linreg"),
+				functionKey("corr"),
+				{
+					// the dataset, for use in expressions
+					label: &data,
+					press: func(disp *arithmeticDisplay) {
+						disp.Insert(arith.Token{Ident: &data})
+					},
+				},
+				{
+					Token: arith.Token{Op: opP(arith.OpCloseParen)},
+				},
+			},
+		},
+	}
+}
+
+func matrixPage() keypadPage {
+	return keypadPage{
+		name: "mat",
+		rows: [][]tokenWithShortcut{
+			{
+				{
+					Token:        arith.Token{Op: opP(arith.OpOpenBracket)},
+					shortcutRune: '[',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpCloseBracket)},
+					shortcutRune: ']',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpComma)},
+					shortcutRune: ',',
+				},
+				{
+					// the matrix product; * multiplies element by element
+					Token:        arith.Token{Op: opP(arith.OpMatMul)},
+					shortcutRune: '@',
+				},
+				{
+					Token: arith.Token{Op: opP(arith.OpCloseParen)},
+				},
+			}, {
+				functionKey("transpose"),
+				functionKey("det"),
+				functionKey("inv"),
+				functionKey("linsolve"),
+			}, {
+				functionKey("trace"),
+				functionKey("identity"),
+				functionKey("dot"),
+				functionKey("cross"),
+			},
+		},
+	}
+}
+
+func programmerPage() keypadPage {
+	wordLabel := "64 bit"
+	signLabel := "signed"
+	return keypadPage{
+		name:       "prog",
+		programmer: true,
+		rows: [][]tokenWithShortcut{
+			{
+				hexKey("A"),
+				hexKey("B"),
+				hexKey("C"),
+				hexKey("D"),
+				hexKey("E"),
+				hexKey("F"),
+			}, {
+				digitKey(7),
+				digitKey(8),
+				digitKey(9),
+				{Token: arith.Token{Op: opP(arith.OpDivide)}},
+				{
+					Token:        arith.Token{Op: opP(arith.OpAnd)},
+					shortcutRune: '&',
+				},
+				hexKey(""),
+			}, {
+				digitKey(4),
+				digitKey(5),
+				digitKey(6),
+				{Token: arith.Token{Op: opP(arith.OpMultiply)}},
+				{
+					Token:        arith.Token{Op: opP(arith.OpOr)},
+					shortcutRune: '|',
+				},
+				{Token: arith.Token{Op: opP(arith.OpXor)}},
+			}, {
+				digitKey(1),
+				digitKey(2),
+				digitKey(3),
+				{Token: arith.Token{Op: opP(arith.OpMinus)}},
+				{
+					Token:        arith.Token{Op: opP(arith.OpNot)},
+					shortcutRune: '~',
+				},
+				{
+					Token:        arith.Token{Op: opP(arith.OpShiftLeft)},
+					shortcutRune: '<',
+				},
+			}, {
+				digitKey(0),
+				{
+					label: &wordLabel,
+					press: func(disp *arithmeticDisplay) {
+						w := disp.WordSize()
+						w.Bits *= 2
+						if w.Bits > 64 {
+							w.Bits = 8
+						}
+						disp.SetWordSize(w)
+						wordLabel = strconv.Itoa(int(w.Bits)) + " bit"
+					},
+				},
+				{
+					label: &signLabel,
+					press: func(disp *arithmeticDisplay) {
+						w := disp.WordSize()
+						w.Signed = !w.Signed
+						disp.SetWordSize(w)
+						if w.Signed {
+							signLabel = "signed"
+						} else {
+							signLabel = "unsigned"
+						}
+					},
+				},
+				{Token: arith.Token{Op: opP(arith.OpPlus)}},
+				{Token: arith.Token{Op: opP(arith.OpEquals)}},
+				{
+					Token:        arith.Token{Op: opP(arith.OpShiftRight)},
+					shortcutRune: '>',
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,99 @@
+package calc
+
+import (
+	"github.com/200sc/oakcalc/internal/arith"
+	"github.com/oakmound/oak/v3/render"
+	"golang.org/x/image/colornames"
+)
+
+// Matrices larger than this are written to the history on one line.
+const (
+	maxGridRows = 8
+	maxGridCols = 6
+)
+
+// addResultToHistory writes a result to the history, as a grid if it is
+// a matrix.
+func (disp *arithmeticDisplay) addResultToHistory(v arith.Value) {
+	if cells, ok := disp.matrixCells(v); ok {
+		disp.addMatrixToHistory(cells)
+		return
+	}
+	disp.AddToHistory(" = " + disp.format.Format(v))
+}
+
+// matrixCells returns the formatted entries of v, row by row, if v is a
+// matrix small enough to write as a grid.
+func (disp *arithmeticDisplay) matrixCells(v arith.Value) ([][]string, bool) {
+	l, ok := v.(arith.List)
+	if !ok || len(l) == 0 || len(l) > maxGridRows {
+		return nil, false
+	}
+	cells := make([][]string, len(l))
+	for i, e := range l {
+		row, ok := e.(arith.List)
+		if !ok || len(row) == 0 || len(row) > maxGridCols || (i > 0 && len(row) != len(cells[0])) {
+			return nil, false
+		}
+		cells[i] = make([]string, len(row))
+		for j, x := range row {
+			if _, ok := x.(arith.List); ok {
+				return nil, false
+			}
+			cells[i][j] = disp.format.Format(x)
+		}
+	}
+	return cells, true
+}
+
+// addMatrixToHistory writes a matrix to the history as a grid: a line per
+// row, with each column right aligned, between drawn brackets.
+func (disp *arithmeticDisplay) addMatrixToHistory(cells [][]string) {
+	const (
+		colSpacing   = 12
+		bracketSerif = 4
+	)
+	rowHeight := disp.fnt.Height() + 4
+	widths := make([]float64, len(cells[0]))
+	for _, row := range cells {
+		for j, cell := range row {
+			if w := float64(disp.fnt.MeasureString(cell).Round()); w > widths[j] {
+				widths[j] = w
+			}
+		}
+	}
+	n := float64(len(cells))
+	// the rows end where a line of text would
+	top := historyY - (n-1)*rowHeight
+	var rs []render.Renderable
+	eq := disp.fnt.NewText(" = ", historyX, top+(n-1)*rowHeight/2)
+	rs = append(rs, eq)
+
+	left := historyX + float64(disp.fnt.MeasureString(" = ").Round())
+	x := left + colSpacing
+	for j, w := range widths {
+		for i, row := range cells {
+			cellX := x + w - float64(disp.fnt.MeasureString(row[j]).Round())
+			rs = append(rs, disp.fnt.NewText(row[j], cellX, top+float64(i)*rowHeight))
+		}
+		x += w + colSpacing
+	}
+	right := x
+	bracketY, bracketH := top-2, n*rowHeight
+	rs = append(rs,
+		bracketBox(left, bracketY, 1, bracketH),
+		bracketBox(left, bracketY, bracketSerif, 1),
+		bracketBox(left, bracketY+bracketH-1, bracketSerif, 1),
+		bracketBox(right, bracketY, 1, bracketH),
+		bracketBox(right-bracketSerif+1, bracketY, bracketSerif, 1),
+		bracketBox(right-bracketSerif+1, bracketY+bracketH-1, bracketSerif, 1),
+	)
+	disp.addToHistory(n*rowHeight+historyLineHeight-rowHeight, rs...)
+}
+
+// bracketBox is one stroke of a matrix bracket.
+func bracketBox(x, y, w, h float64) render.Renderable {
+	box := render.NewColorBox(int(w), int(h), colornames.White)
+	box.SetPos(x, y)
+	return box
+}
@@ -0,0 +1,119 @@
+package calc
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/200sc/oakcalc/internal/arith"
+	"github.com/oakmound/oak/v3/entities/x/btn"
+	"github.com/oakmound/oak/v3/event"
+	"github.com/oakmound/oak/v3/mouse"
+)
+
+// SetProgrammerMode switches between computing exactly and computing with
+// wrapping integers of the display's word size. In programmer mode the
+// side panel shows the last result in several bases instead of the
+// session's variables.
+func (disp *arithmeticDisplay) SetProgrammerMode(on bool) {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	disp.programmer = on
+	if !on {
+		disp.ev.Backend = arith.BackendRational
+		disp.ev.Word = arith.WordSize{}
+		disp.showPanel()
+		return
+	}
+	disp.ev.Backend = arith.BackendInteger
+	disp.ev.Word = disp.word
+	disp.showProgrammer()
+}
+
+// SetWordSize changes the word size used in programmer mode, wrapping the
+// last result to fit.
+func (disp *arithmeticDisplay) SetWordSize(w arith.WordSize) {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	disp.word = w
+	if disp.programmer {
+		disp.ev.Word = w
+		disp.showProgrammer()
+	}
+}
+
+// WordSize returns the word size used in programmer mode.
+func (disp *arithmeticDisplay) WordSize() arith.WordSize {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	return disp.word
+}
+
+// unsigned is v as the unsigned word with the same bits.
+func (disp *arithmeticDisplay) unsigned(v *big.Int) *big.Int {
+	return arith.WordSize{Bits: disp.word.Bits}.Wrap(v)
+}
+
+// showProgrammer shows the last result in hexadecimal, decimal and octal,
+// and a row of toggles for each of its bits.
+func (disp *arithmeticDisplay) showProgrammer() {
+	const bitWidth = 9
+	const bitHeight = 14
+	const bitsPerRow = 32
+	const bitsY = panelY + 3*panelLineHeight + 2
+	disp.clearPanel()
+	if disp.value == nil {
+		disp.value = new(big.Int)
+	}
+	disp.value = disp.word.Wrap(disp.value)
+	u := disp.unsigned(disp.value)
+	disp.showLines(0,
+		"HEX "+strings.ToUpper(u.Text(16)),
+		"DEC "+disp.value.String(),
+		"OCT "+u.Text(8),
+	)
+	bits := int(disp.word.Bits)
+	for i := 0; i < bits; i++ {
+		// most significant bit first, with a gap between nibbles
+		bit := bits - 1 - i
+		col := i % bitsPerRow
+		x := float64(panelX + col*(bitWidth+1) + col/4*3)
+		y := float64(bitsY + i/bitsPerRow*(bitHeight+4))
+		disp.bitLabels[bit] = strconv.Itoa(int(u.Bit(bit)))
+		disp.bits = append(disp.bits, btn.New(
+			btn.TextPtr(&disp.bitLabels[bit]),
+			btn.Font(disp.fnt),
+			btn.TxtOff(2, 1),
+			btn.Pos(x, y),
+			btn.Width(bitWidth),
+			btn.Height(bitHeight),
+			btn.Color(btnColor),
+			btn.Layers(1),
+			btn.Click(mouse.Binding(func(c event.CID, e *mouse.Event) int {
+				disp.toggleBit(bit)
+				return 0
+			})),
+		))
+	}
+}
+
+// toggleBit flips a bit of the last result, making the new value the
+// current operation.
+func (disp *arithmeticDisplay) toggleBit(bit int) {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	v := new(big.Int).Set(disp.unsigned(disp.value))
+	v.SetBit(v, bit, v.Bit(bit)^1)
+	disp.value = disp.word.Wrap(v)
+	disp.bitLabels[bit] = strconv.Itoa(int(v.Bit(bit)))
+
+	u := disp.unsigned(disp.value)
+	disp.panel[0].SetString("HEX " + strings.ToUpper(u.Text(16)))
+	disp.panel[1].SetString("DEC " + disp.value.String())
+	disp.panel[2].SetString("OCT " + u.Text(8))
+
+	disp.currentOperation = []arith.Token{{Number: new(big.Rat).SetInt(u)}}
+	disp.setEntry("0x" + u.Text(16))
+	disp.current.SetString(strings.Join(disp.tokenStrings(), " "))
+	disp.clearError()
+}
@@ -0,0 +1,131 @@
+package calc
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/200sc/oakcalc/internal/arith"
+)
+
+// dataName is the variable the statistics page collects its dataset in.
+// It is an ordinary list variable, so it can also be assigned and used in
+// expressions like "mean(data)".
+const dataName = "data"
+
+// SetStatisticsMode switches the side panel between the session's
+// variables and statistics of the dataset.
+func (disp *arithmeticDisplay) SetStatisticsMode(on bool) {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	disp.statistics = on
+	disp.showPanel()
+}
+
+// data returns the dataset, which is empty if data is not a list.
+func (disp *arithmeticDisplay) data() arith.List {
+	v, _ := disp.ev.Env.Get(dataName)
+	l, _ := v.(arith.List)
+	return l
+}
+
+// PushData evaluates the current operation and adds its result to the
+// end of the dataset, or each of its elements if it is a list.
+func (disp *arithmeticDisplay) PushData() {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	if len(disp.currentOperation) == 0 {
+		return
+	}
+	tree, err := disp.parser().Parse(disp.currentOperation)
+	var perr *arith.ParseError
+	if errors.As(err, &perr) {
+		disp.AddToHistory("Error: " + perr.Kind.String())
+		disp.markError(perr.Index)
+		return
+	}
+	if err != nil {
+		return
+	}
+	disp.AddToHistory(dataName + " ← " + disp.format.Pretty(tree))
+	v, err := disp.ev.Eval(tree)
+	var everr *arith.EvalError
+	if errors.As(err, &everr) {
+		disp.AddToHistory("Error: " + everr.Err.Error())
+		return
+	}
+	data := append(arith.List{}, disp.data()...)
+	if l, ok := v.(arith.List); ok {
+		data = append(data, l...)
+	} else {
+		data = append(data, v)
+	}
+	disp.ev.Env.Set(dataName, data)
+	disp.currentOperation = []arith.Token{}
+	disp.entry = ""
+	disp.current.SetString("")
+	disp.clearError()
+	disp.showPanel()
+}
+
+// PopData removes the last value of the dataset.
+func (disp *arithmeticDisplay) PopData() {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	data := disp.data()
+	if len(data) == 0 {
+		return
+	}
+	disp.ev.Env.Set(dataName, data[:len(data)-1:len(data)-1])
+	disp.showPanel()
+}
+
+// ClearData empties the dataset.
+func (disp *arithmeticDisplay) ClearData() {
+	disp.mu.Lock()
+	defer disp.mu.Unlock()
+	disp.ev.Env.Set(dataName, arith.List{})
+	disp.showPanel()
+}
+
+// panelStatistics are the functions of the dataset the statistics panel
+// shows.
+var panelStatistics = []string{"count", "sum", "mean", "median", "stddev"}
+
+// showStatistics lists the dataset and its statistics in the side panel.
+// Statistics the dataset has none of, such as the deviation of a single
+// value, are shown as "-".
+func (disp *arithmeticDisplay) showStatistics() {
+	const maxValues = 4
+	disp.clearPanel()
+	data := disp.data()
+	strs := make([]string, 0, maxValues+1)
+	for i, v := range data {
+		if i == maxValues {
+			strs = append(strs, "...")
+			break
+		}
+		strs = append(strs, disp.format.Format(v))
+	}
+	lines := []string{dataName + " = [" + strings.Join(strs, ", ") + "]"}
+	for _, name := range panelStatistics {
+		result := "-"
+		v, err := disp.ev.Eval(arith.CallNode{Name: name, Args: []arith.Node{arith.VariableNode{Name: dataName}}})
+		if err == nil {
+			result = disp.format.Format(v)
+		}
+		lines = append(lines, name+" = "+result)
+	}
+	disp.showLines(0, lines...)
+}
+
+// showPanel refreshes the side panel for the display's mode. The
+// programmer panel is left alone; it follows the last result.
+func (disp *arithmeticDisplay) showPanel() {
+	switch {
+	case disp.programmer:
+	case disp.statistics:
+		disp.showStatistics()
+	default:
+		disp.showVariables()
+	}
+}